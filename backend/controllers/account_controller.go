@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,11 +12,20 @@ import (
 )
 
 func CreateAccount(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	var body models.Account
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Users open accounts for themselves; staff may open one for anyone
+	if !canManageAnyAccount(c) || body.UserID == 0 {
+		body.UserID = userID
+	}
 	if err := services.CreateAccount(&body); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -23,16 +33,35 @@ func CreateAccount(c *gin.Context) {
 	c.JSON(http.StatusCreated, body)
 }
 func GetAllAccounts(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	accounts, err := services.GetAllAccounts()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	// Users only see their own accounts
+	if !canReadAnyAccount(c) {
+		own := accounts[:0]
+		for _, acc := range accounts {
+			if acc.UserID == userID {
+				own = append(own, acc)
+			}
+		}
+		accounts = own
+	}
 	c.JSON(http.StatusOK, accounts)
 }
 
 func GetAccountsBalance(c *gin.Context) {
 	id := c.Param("id")
+	if !authorizeAccount(c, id) {
+		return
+	}
 
 	accounts, err := services.GetAccountBalance(id)
 	if err != nil {
@@ -61,8 +90,18 @@ func GetAccountDetails(c *gin.Context) {
 
 
 
+// GetAccountByID lists the accounts of the user with the given ID.
 func GetAccountByID(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	id, _ := strconv.Atoi(c.Param("id"))
+	if uint(id) != userID && !canReadAnyAccount(c) {
+		authzError(c, services.ErrForbidden)
+		return
+	}
 	acc, err := services.GetAccountsByUserID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -72,12 +111,24 @@ func GetAccountByID(c *gin.Context) {
 }
 
 func UpdateAccount(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorizeAccountID(c, uint(id)) {
+		return
+	}
 	var body models.Account
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Only staff can hand an account to another user
+	if !canManageAnyAccount(c) {
+		body.UserID = userID
+	}
 	if err := services.UpdateAccount(uint(id), &body); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -85,9 +136,47 @@ func UpdateAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Updated"})
 }
 
+// PUT /admin/accounts/:id/type
+func ChangeAccountType(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid account ID"})
+		return
+	}
+	var input struct {
+		AccountTypeID uint `json:"account_type_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ChangeAccountType(uint(id), input.AccountTypeID, adminID); err != nil {
+		if isAuthzError(err) {
+			authzError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account type changed"})
+}
+
 func DeleteAccount(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorizeAccountID(c, uint(id)) {
+		return
+	}
 	if err := services.DeleteAccount(uint(id)); err != nil {
+		if errors.Is(err, services.ErrAccountInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete failed"})
 		return
 	}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -49,6 +50,10 @@ func UpdateAccountType(c *gin.Context) {
 		return
 	}
 	if err := services.UpdateAccountType(uint(id), &body); err != nil {
+		if errors.Is(err, services.ErrAccountTypeCurrencyInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
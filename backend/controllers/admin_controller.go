@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bank/services"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -17,8 +18,14 @@ type AssignRolesInput struct {
 
 // Create a new role
 func CreateRole(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	var input struct {
-		Name string `json:"name" binding:"required"`
+		Name        string   `json:"name" binding:"required"`
+		Permissions []string `json:"permissions"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -26,7 +33,7 @@ func CreateRole(c *gin.Context) {
 		return
 	}
 
-	role, err := services.CreateRole(input.Name)
+	role, err := services.CreateRole(input.Name, input.Permissions, adminID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -34,14 +41,75 @@ func CreateRole(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{"role": role})
 }
+// GET /admin/permissions
+func GetPermissions(c *gin.Context) {
+	permissions, err := services.GetPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": permissions})
+}
+
+// GET /admin/roles
+func GetRoles(c *gin.Context) {
+	roles, err := services.GetRolesWithPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": roles})
+}
+
+// PUT /admin/roles/:id/permissions replaces what a role grants.
+func SetRolePermissions(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role ID"})
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.SetRolePermissions(uint(id), input.Permissions, adminID); err != nil {
+		if errors.Is(err, services.ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role permissions updated"})
+}
+
 func AssignRoles(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	var input AssignRolesInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := services.AssignRolesToUser(input.UserID, input.RoleNames); err != nil {
+	if err := services.AssignRolesToUser(input.UserID, input.RoleNames, adminID); err != nil {
+		if errors.Is(err, services.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -53,6 +121,11 @@ type StatusToggleRequest struct {
 	IsActive bool `json:"is_active"`
 }
 func ActivateDeactivateUser(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	userIDStr := c.Param("id")
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
@@ -66,7 +139,7 @@ func ActivateDeactivateUser(c *gin.Context) {
 		return
 	}
 
-	err = services.ActivateDeactivateUser(uint(userID), req.IsActive)
+	err = services.ActivateDeactivateUser(uint(userID), req.IsActive, adminID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -81,12 +154,19 @@ func ActivateDeactivateUser(c *gin.Context) {
 
 func GetUserList(c *gin.Context) {
   
-    users, err := services.GetUsersWithRoles()
+    pageReq, err := pageRequest(c)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    users, err := services.GetUsersWithRoles(pageReq)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        pageError(c, err)
         return
     }
-    c.JSON(http.StatusOK, users)
+    setPageHeaders(c, users)
+    c.JSON(http.StatusOK, users.Items)
 }
 
 func GetAdminDashboard(c *gin.Context) {
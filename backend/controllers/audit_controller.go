@@ -9,15 +9,28 @@ import (
 
 // GET /audit-logs
 func GetAuditLogs(c *gin.Context) {
-	logs, err := services.GetAllAuditLogs()
+	pageReq, err := pageRequest(c)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logs, err := services.GetAllAuditLogs(pageReq)
+	if err != nil {
+		if services.IsInvalidPageRequest(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch audit logs",
 		})
 		return
 	}
 
+	setPageHeaders(c, logs)
 	c.JSON(http.StatusOK, gin.H{
-		"audit_logs": logs,
+		"audit_logs":  logs.Items,
+		"next_cursor": logs.NextCursor,
+		"total":       logs.Total,
 	})
 }
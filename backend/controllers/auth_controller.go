@@ -4,7 +4,10 @@ import (
 	"bank/models"
 	"bank/services"
 	"bank/utils"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -54,18 +57,88 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	userID, role, err := services.Authenticate(input.Email, input.Password)
+	userID, roles, err := services.Authenticate(input.Email, input.Password, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAccountDeactivated):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		}
+		return
+	}
+
+	// With 2FA on, the password only earns a challenge for the second step
+	enabled, err := services.TOTPEnabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if enabled {
+		challenge, err := services.CreateLoginChallenge(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      int64(services.LoginChallengeTTL() / time.Second),
+		})
+		return
+	}
+
+	loginResponse(c, userID, roles)
+}
+
+type LoginTOTPInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// POST /login/2fa completes a login with an authenticator or recovery code.
+func LoginTOTP(c *gin.Context) {
+	var input LoginTOTPInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, roles, err := services.CompleteLoginChallenge(input.ChallengeToken, input.Code, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		if errors.As(err, &throttled) {
+			c.Header("Retry-After", strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	token, err := utils.GenerateJWT(userID, role)
+	loginResponse(c, userID, roles)
+}
+
+// loginResponse opens a session and answers with its tokens and the user.
+func loginResponse(c *gin.Context, userID uint, roles []string) {
+	tokens, err := services.StartSession(userID, roles, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
+	permissions, err := services.UserPermissions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Fetch full user details
 	user, err := services.GetUserByID(userID)
 	if err != nil {
@@ -74,17 +147,34 @@ func Login(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
+		"token": tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in": tokens.ExpiresIn,
 		"user": gin.H{
 			"id":   user.ID,
 			"name": user.FullName,
 			"number": user.PhoneNumber,
 			"address": user.Address,
-			"role": role,
+			"role": primaryRole(roles),
+			"roles": roles,
+			"permissions": permissions,
 		},
 	})
 }
 
+// primaryRole is the single role older clients switch their UI on.
+func primaryRole(roles []string) string {
+	for _, r := range roles {
+		if r == "Admin" {
+			return r
+		}
+	}
+	if len(roles) == 0 {
+		return ""
+	}
+	return roles[0]
+}
+
 func ResetPassword(c *gin.Context) {
 	userIDVal, exists := c.Get("userID")
 	if !exists {
@@ -107,7 +197,165 @@ func ResetPassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordWithTokenInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// POST /password/forgot always answers the same, whether or not the email
+// belongs to a user.
+func ForgotPassword(c *gin.Context) {
+	var input ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.RequestPasswordReset(input.Email, c.ClientIP()); err != nil {
+		if errors.Is(err, services.ErrTooManyResetRequests) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request password reset"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+// POST /password/reset
+func ResetForgottenPassword(c *gin.Context) {
+	var input ResetPasswordWithTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.ResetPasswordWithToken(input.Token, input.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset; please log in again"})
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// POST /token/refresh
+func RefreshToken(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := services.RefreshSession(input.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// GET /api/login-history
+func GetLoginHistory(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+	getLoginHistory(c, userID)
+}
+
+// GET /admin/users/:id/login-history
+func GetUserLoginHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	getLoginHistory(c, uint(id))
+}
+
+func getLoginHistory(c *gin.Context, userID uint) {
+	pageReq, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, err := services.GetLoginHistory(userID, pageReq)
+	if err != nil {
+		pageError(c, err)
+		return
+	}
+
+	setPageHeaders(c, history)
+	c.JSON(http.StatusOK, gin.H{
+		"data":        history.Items,
+		"next_cursor": history.NextCursor,
+		"total":       history.Total,
+	})
+}
+
+// POST /admin/users/:id/unlock
+func UnlockUserLogin(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if err := services.UnlockLogin(uint(id), adminID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Login unlocked"})
+}
+
+// GET /.well-known/jwks.json
+func JWKS(c *gin.Context) {
+	keys, err := utils.JWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// POST /api/logout ends the current session; ?all=true ends every session
+// of the user.
 func Logout(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	sessionID, ok := c.Get("sessionID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var err error
+	if c.Query("all") == "true" {
+		err = services.RevokeUserSessions(userID.(uint), "logout")
+	} else {
+		err = services.RevokeSession(sessionID.(uint), "logout")
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
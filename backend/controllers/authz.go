@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bank/middlewares"
+	"bank/models"
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The acting user always comes from the JWT, never from the request.
+
+var errUnauthorized = errors.New("Unauthorized")
+
+// actingUser returns the authenticated user, answering 401 when there is none.
+func actingUser(c *gin.Context) (uint, bool) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errUnauthorized.Error()})
+		return 0, false
+	}
+	return userID.(uint), true
+}
+
+// canReadAnyAccount and canManageAnyAccount lift the ownership checks for
+// staff; everyone else is limited to their own accounts.
+func canReadAnyAccount(c *gin.Context) bool {
+	return middlewares.HasPermission(c, models.PermAccountsReadAll) || canManageAnyAccount(c)
+}
+
+func canManageAnyAccount(c *gin.Context) bool {
+	return middlewares.HasPermission(c, models.PermAccountsManageAll)
+}
+
+// checkAccountAccess allows the acting user to act on an account they own;
+// holders of accounts:manage_all may act on any account.
+func checkAccountAccess(c *gin.Context, accountNumber string) error {
+	return checkAccess(c, canManageAnyAccount(c), func(userID uint) error { return services.AuthorizeAccount(accountNumber, userID) })
+}
+
+func checkAccess(c *gin.Context, bypass bool, check func(userID uint) error) error {
+	userID, ok := c.Get("userID")
+	if !ok {
+		return errUnauthorized
+	}
+	if bypass {
+		return nil
+	}
+	return check(userID.(uint))
+}
+
+// authorizeAccount lets the acting user read an account they own, or any
+// account with accounts:read_all, and answers otherwise.
+func authorizeAccount(c *gin.Context, accountNumber string) bool {
+	err := checkAccess(c, canReadAnyAccount(c), func(userID uint) error { return services.AuthorizeAccount(accountNumber, userID) })
+	if err != nil {
+		authzError(c, err)
+		return false
+	}
+	return true
+}
+
+// authorizeAccountID lets the acting user change an account they own, by
+// its numeric ID, and answers otherwise.
+func authorizeAccountID(c *gin.Context, id uint) bool {
+	err := checkAccess(c, canManageAnyAccount(c), func(userID uint) error { return services.AuthorizeAccountID(id, userID) })
+	if err != nil {
+		authzError(c, err)
+		return false
+	}
+	return true
+}
+
+// scopedUserID resolves the ?user_id of a listing. Holders of
+// accounts:read_all may ask for any user or, by leaving it out, for
+// everyone; other users only see their own data and get 403 for anyone
+// else's.
+func scopedUserID(c *gin.Context) (*uint, bool) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	var requested *uint
+	if s := c.Query("user_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return nil, false
+		}
+		uid := uint(id)
+		requested = &uid
+	}
+
+	if canReadAnyAccount(c) {
+		return requested, true
+	}
+	if requested != nil && *requested != userID {
+		authzError(c, services.ErrForbidden)
+		return nil, false
+	}
+	return &userID, true
+}
+
+// isAuthzError reports whether err is an authorization failure.
+func isAuthzError(err error) bool {
+	return errors.Is(err, errUnauthorized) || errors.Is(err, services.ErrForbidden) || errors.Is(err, services.ErrAccountNotFound)
+}
+
+// authzResponse maps an authorization failure to 401, 403 or 404; anything
+// else is a 500.
+func authzResponse(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, errUnauthorized):
+		return http.StatusUnauthorized, gin.H{"error": err.Error()}
+	case errors.Is(err, services.ErrForbidden):
+		return http.StatusForbidden, gin.H{"error": err.Error()}
+	case errors.Is(err, services.ErrAccountNotFound):
+		return http.StatusNotFound, gin.H{"error": err.Error()}
+	}
+	return http.StatusInternalServerError, gin.H{"error": err.Error()}
+}
+
+func authzError(c *gin.Context, err error) {
+	c.JSON(authzResponse(err))
+}
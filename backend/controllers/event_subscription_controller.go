@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bank/dtos"
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /admin/event-subscriptions answers with the signing secret; it is
+// not shown again.
+func CreateEventSubscription(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	var input dtos.EventSubscriptionRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, err := services.CreateEventSubscription(input, adminID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": subscription})
+}
+
+// GET /admin/event-subscriptions
+func GetEventSubscriptions(c *gin.Context) {
+	subscriptions, err := services.GetEventSubscriptions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": subscriptions})
+}
+
+// DELETE /admin/event-subscriptions/:id
+func DeleteEventSubscription(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event subscription ID"})
+		return
+	}
+
+	if err := services.DeleteEventSubscription(uint(id), adminID); err != nil {
+		if errors.Is(err, services.ErrEventSubscriptionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Event subscription deleted"})
+}
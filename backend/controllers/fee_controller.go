@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bank/models"
+	"bank/money"
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /user/transfers/quote?from=ACC1&to=ACC2&amount=100&exchange_rate_id=7
+func QuoteTransfer(c *gin.Context) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	amount, err := money.Parse(c.Query("amount"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rateID *uint
+	if s := c.Query("exchange_rate_id"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exchange_rate_id"})
+			return
+		}
+		uid := uint(id)
+		rateID = &uid
+	}
+
+	quote, err := services.QuoteTransfer(c.Query("from"), c.Query("to"), amount, rateID, userID.(uint))
+	if err != nil {
+		if isAuthzError(err) {
+			authzError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": quote})
+}
+
+// POST /admin/fee-rules
+func CreateFeeRule(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var rule models.FeeRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.CreateFeeRule(&rule, adminID.(uint)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": rule})
+}
+
+// GET /admin/fee-rules
+func GetFeeRules(c *gin.Context) {
+	rules, err := services.GetFeeRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// PUT /admin/fee-rules/:id
+func UpdateFeeRule(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fee rule ID"})
+		return
+	}
+
+	// is_active is optional here; leaving it out keeps the rule's state
+	var input struct {
+		models.FeeRule
+		IsActive *bool `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule := input.FeeRule
+
+	if err := services.UpdateFeeRule(uint(id), &rule, input.IsActive, adminID.(uint)); err != nil {
+		if errors.Is(err, services.ErrFeeRuleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rule})
+}
+
+// DELETE /admin/fee-rules/:id
+func DeleteFeeRule(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fee rule ID"})
+		return
+	}
+
+	if err := services.DeleteFeeRule(uint(id), adminID.(uint)); err != nil {
+		if errors.Is(err, services.ErrFeeRuleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Fee rule deleted"})
+}
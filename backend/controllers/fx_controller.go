@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"bank/models"
+	"bank/money"
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /admin/exchange-rates
+func PublishExchangeRate(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var rate models.ExchangeRate
+	if err := c.ShouldBindJSON(&rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.PublishExchangeRate(&rate, adminID.(uint)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": rate})
+}
+
+// GET /exchange-rates?base=USD&quote=SOS
+func GetExchangeRates(c *gin.Context) {
+	rates, err := services.GetExchangeRates(c.Query("base"), c.Query("quote"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rates})
+}
+
+// PUT /admin/exchange-rates/:id/expire
+func ExpireExchangeRate(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid exchange rate ID"})
+		return
+	}
+
+	if err := services.ExpireExchangeRate(uint(id), adminID.(uint)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate expired"})
+}
+
+// GET /user/fx/quote?from=USD&to=SOS&amount=100
+func GetFXQuote(c *gin.Context) {
+	amount, err := money.Parse(c.Query("amount"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quote, err := services.GetFXQuote(c.Query("from"), c.Query("to"), amount)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": quote})
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"bank/models"
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// requestFingerprint hashes the endpoint and the JSON body. The body is
+// re-encoded first so that key order and whitespace don't matter.
+func requestFingerprint(endpoint string, body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+
+	sum := sha256.Sum256(append([]byte(endpoint+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyScope is the key a request runs under, nil record when the
+// request has none.
+type idempotencyScope struct {
+	record *models.IdempotencyKey
+	stored bool
+}
+
+// completeWith returns a hook for the service's transaction that stores the
+// response under the key, so a retry can never find the change committed
+// but the key still open. response is rendered inside the transaction, once
+// the change is made.
+func (s *idempotencyScope) completeWith(status int, response func() gin.H) func(*sql.Tx) error {
+	return func(dbtx *sql.Tx) error {
+		if s.record == nil {
+			return nil
+		}
+		encoded, err := json.Marshal(response())
+		if err != nil {
+			return err
+		}
+		if err := services.CompleteIdempotencyKeyTx(dbtx, s.record, status, string(encoded)); err != nil {
+			return err
+		}
+		s.stored = true
+		return nil
+	}
+}
+
+// idempotent runs handle at most once per Idempotency-Key. A retry with the
+// same key and payload gets the original response back; the same key with a
+// different payload is rejected with 422. Requests without the header are
+// handled as before. Responses the handler didn't store through the scope
+// are stored once it returns; server errors are never stored.
+func idempotent(c *gin.Context, endpoint string, handle func(scope *idempotencyScope) (int, gin.H)) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.JSON(handle(&idempotencyScope{}))
+		return
+	}
+	if len(key) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return
+	}
+
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	record, replay, err := services.ReserveIdempotencyKey(userIDVal.(uint), endpoint, key, requestFingerprint(endpoint, body))
+	if errors.Is(err, services.ErrIdempotencyKeyReused) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrIdempotencyKeyInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if replay {
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(record.StatusCode, "application/json; charset=utf-8", []byte(record.ResponseBody))
+		return
+	}
+
+	scope := &idempotencyScope{record: record}
+	status, response := handle(scope)
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		_ = services.ReleaseIdempotencyKey(record)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Server errors are not cached so the client can retry with the same key
+	switch {
+	case status >= http.StatusInternalServerError:
+		err = services.ReleaseIdempotencyKey(record)
+	case !scope.stored:
+		err = services.CompleteIdempotencyKey(record, status, string(encoded))
+	}
+	if err != nil {
+		log.Printf("Failed to store idempotency key %d: %v", record.ID, err)
+	}
+
+	c.Data(status, "application/json; charset=utf-8", encoded)
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /user/interest?account_number=
+func GetAccruedInterest(c *gin.Context) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	accountNumber := c.Query("account_number")
+	if accountNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_number is required"})
+		return
+	}
+
+	interest, err := services.GetAccruedInterest(accountNumber, userID.(uint))
+	if err != nil {
+		if isAuthzError(err) {
+			authzError(c, err)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": interest})
+}
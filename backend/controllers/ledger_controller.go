@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /admin/ledger/verify
+func VerifyLedger(c *gin.Context) {
+	report, err := services.VerifyLedger()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// GET /admin/ledger/accounts/:account_number/postings
+func GetAccountPostings(c *gin.Context) {
+	accountNumber := c.Param("account_number")
+
+	postings, err := services.GetAccountPostings(accountNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := services.GetLedgerBalance(accountNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_number": accountNumber,
+		"ledger_balance": balance,
+		"data":           postings,
+	})
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bank/models"
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitErrorResponse maps a LimitError to 422 with its code.
+func limitErrorResponse(err error) (int, gin.H, bool) {
+	var limitErr *services.LimitError
+	if !errors.As(err, &limitErr) {
+		return 0, nil, false
+	}
+	return http.StatusUnprocessableEntity, gin.H{
+		"error":     limitErr.Error(),
+		"code":      limitErr.Code,
+		"limit":     limitErr.Limit,
+		"remaining": limitErr.Remaining,
+	}, true
+}
+
+// GET /user/limits?account_number=
+func GetAccountLimits(c *gin.Context) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	accountNumber := c.Query("account_number")
+	if accountNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_number is required"})
+		return
+	}
+
+	limits, err := services.GetAccountLimits(accountNumber, userID.(uint))
+	if err != nil {
+		if isAuthzError(err) {
+			authzError(c, err)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": limits})
+}
+
+// PUT /admin/limits/accounts/:account_number
+func SetAccountLimitOverride(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var override models.LimitOverride
+	if err := c.ShouldBindJSON(&override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.SetAccountLimitOverride(c.Param("account_number"), &override, adminID.(uint)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": override})
+}
+
+// DELETE /admin/limits/accounts/:account_number
+func DeleteAccountLimitOverride(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := services.DeleteAccountLimitOverride(c.Param("account_number"), adminID.(uint)); err != nil {
+		deleteLimitOverrideError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Limit override removed"})
+}
+
+// PUT /admin/limits/users/:id
+func SetUserLimitOverride(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var override models.LimitOverride
+	if err := c.ShouldBindJSON(&override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.SetUserLimitOverride(uint(id), &override, adminID.(uint)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": override})
+}
+
+// DELETE /admin/limits/users/:id
+func DeleteUserLimitOverride(c *gin.Context) {
+	adminID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if err := services.DeleteUserLimitOverride(uint(id), adminID.(uint)); err != nil {
+		deleteLimitOverrideError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Limit override removed"})
+}
+
+func deleteLimitOverrideError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrLimitOverrideNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bank/dtos"
+	"bank/middlewares"
+	"bank/services"
+	"bank/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationSocket streams the authenticated user's notifications,
+// replaying those missed since the client last connected.
+var NotificationSocket = websocket.Handler(websocket.DefaultHub, middlewares.AuthenticateToken, services.NotificationBacklog{})
+
+// GetFilteredNotifications lists notifications, optionally narrowed by
+// filter (requests or alert), type and unread=true. Messages are rendered in
+// the language of ?lang= or Accept-Language.
+func GetFilteredNotifications(c *gin.Context) {
+	scoped, ok := scopedUserID(c)
+	if !ok {
+		return
+	}
+	if scoped == nil {
+		c.JSON(400, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	pageReq, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	notifications, err := services.GetNotifications(services.NotificationFilter{
+		UserID:      *scoped,
+		Category:    c.Query("filter"),
+		Type:        strings.ToUpper(c.Query("type")),
+		UnreadOnly:  c.Query("unread") == "true",
+		Locale:      requestLocale(c),
+		PageRequest: pageReq,
+	})
+	if err != nil {
+		if services.IsInvalidPageRequest(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Error fetching notifications: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+
+	setPageHeaders(c, notifications)
+	c.JSON(200, notifications.Items)
+}
+
+func GetUnreadNotificationCount(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	count, err := services.CountUnreadNotifications(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	changeNotification(c, services.MarkNotificationRead, "Notification marked as read")
+}
+
+func DeleteNotification(c *gin.Context) {
+	changeNotification(c, services.DeleteNotification, "Notification deleted")
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	updated, err := services.MarkAllNotificationsRead(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read", "updated": updated})
+}
+
+func changeNotification(c *gin.Context, change func(id, userID uint) error, successMessage string) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification ID"})
+		return
+	}
+
+	err = change(uint(id), userID)
+	if errors.Is(err, services.ErrNotificationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": successMessage})
+}
+
+// requestLocale is ?lang= if given, else the first language of
+// Accept-Language, reduced to its primary tag ("fr-CA;q=0.9" is "fr").
+func requestLocale(c *gin.Context) string {
+	lang := c.Query("lang")
+	if lang == "" {
+		lang = strings.Split(c.GetHeader("Accept-Language"), ",")[0]
+	}
+	lang = strings.Split(lang, ";")[0]
+	lang = strings.Split(lang, "-")[0]
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return services.DefaultLocale
+	}
+	return lang
+}
+
+func GetNotificationPreferences(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	preferences, err := services.GetNotificationPreferences(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, preferences)
+}
+
+// UpdateNotificationPreferences takes {"preferences": [{"type", "channel", "enabled"}]}.
+func UpdateNotificationPreferences(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Preferences []dtos.NotificationPreferenceUpdate `json:"preferences" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.SetNotificationPreferences(userID, input.Preferences); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preferences, err := services.GetNotificationPreferences(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, preferences)
+}
+
+// SetNotificationWebhook answers with the signing secret; it is not shown
+// again.
+func SetNotificationWebhook(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		URL string `json:"url" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := services.SetNotificationWebhook(userID, input.URL)
+	if errors.Is(err, services.ErrInvalidWebhookURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, webhook)
+}
+
+func DeleteNotificationWebhook(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteNotificationWebhook(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook removed"})
+}
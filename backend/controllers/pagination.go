@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Paginated listings keep their response body and report the position of
+// the next page in headers, so existing clients keep working.
+const (
+	nextCursorHeader = "X-Next-Cursor"
+	totalCountHeader = "X-Total-Count"
+)
+
+// pageRequest reads ?limit, ?cursor, ?sort, ?order=asc|desc and
+// ?include_total=true.
+func pageRequest(c *gin.Context) (services.PageRequest, error) {
+	req := services.PageRequest{
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort"),
+	}
+
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return req, errors.New("limit must be a positive number")
+		}
+		req.Limit = limit
+	}
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		req.Ascending = true
+	case "desc":
+	default:
+		return req, errors.New("order must be asc or desc")
+	}
+
+	req.WithTotal = c.Query("include_total") == "true"
+	return req, nil
+}
+
+// pageError answers 400 for a bad cursor or sort and 500 otherwise.
+func pageError(c *gin.Context, err error) {
+	if services.IsInvalidPageRequest(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func setPageHeaders[T any](c *gin.Context, page *services.Page[T]) {
+	c.Header(nextCursorHeader, page.NextCursor)
+	if page.Total != nil {
+		c.Header(totalCountHeader, strconv.FormatInt(*page.Total, 10))
+	}
+}
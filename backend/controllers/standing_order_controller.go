@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bank/models"
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /user/standing-orders
+func CreateStandingOrder(c *gin.Context) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var order models.StandingOrder
+	if err := c.ShouldBindJSON(&order); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order.UserID = userID.(uint)
+
+	if err := services.CreateStandingOrder(&order); err != nil {
+		if isAuthzError(err) {
+			authzError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": order})
+}
+
+// GET /user/standing-orders
+func GetStandingOrders(c *gin.Context) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	orders, err := services.GetStandingOrdersByUserID(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": orders})
+}
+
+// PUT /user/standing-orders/:id/pause
+func PauseStandingOrder(c *gin.Context) {
+	changeStandingOrder(c, services.PauseStandingOrder, "Standing order paused")
+}
+
+// PUT /user/standing-orders/:id/resume
+func ResumeStandingOrder(c *gin.Context) {
+	changeStandingOrder(c, services.ResumeStandingOrder, "Standing order resumed")
+}
+
+// PUT /user/standing-orders/:id/cancel
+func CancelStandingOrder(c *gin.Context) {
+	changeStandingOrder(c, services.CancelStandingOrder, "Standing order cancelled")
+}
+
+func changeStandingOrder(c *gin.Context, change func(id, userID uint) error, successMessage string) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid standing order ID"})
+		return
+	}
+
+	err = change(uint(id), userID.(uint))
+	if errors.Is(err, services.ErrStandingOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": successMessage})
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"bank/dtos"
+	"bank/services"
+	"bank/statement"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /user/statement?account_number=&from=2025-01-01&to=2025-01-31&format=pdf
+func GetAccountStatement(c *gin.Context) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	renderStatement(c, func(accountNumber string, from, to time.Time) (*dtos.Statement, error) {
+		return services.GetUserAccountStatement(accountNumber, userID.(uint), from, to)
+	})
+}
+
+// GET /admin/statement?account_number=&from=&to=&format=
+func GetAnyAccountStatement(c *gin.Context) {
+	renderStatement(c, services.GetAccountStatement)
+}
+
+// renderStatement reads the period (default: this month so far) and writes
+// the statement as JSON, CSV or PDF depending on ?format.
+func renderStatement(c *gin.Context, load func(accountNumber string, from, to time.Time) (*dtos.Statement, error)) {
+	accountNumber := c.Query("account_number")
+	if accountNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "account_number is required"})
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var err error
+	if s := c.Query("from"); s != "" {
+		if from, err = time.Parse("2006-01-02", s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date like 2025-01-31"})
+			return
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = time.Parse("2006-01-02", s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date like 2025-01-31"})
+			return
+		}
+	}
+
+	st, err := load(accountNumber, from, to)
+	if err != nil {
+		if isAuthzError(err) {
+			authzError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s", st.AccountNumber, from.Format("20060102"), to.Format("20060102"))
+	var buf bytes.Buffer
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, gin.H{"data": st})
+	case "csv":
+		if err := statement.WriteCSV(&buf, st); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	case "pdf":
+		if err := statement.WritePDF(&buf, st); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, filename))
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, csv or pdf"})
+	}
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bank/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// totpError maps the 2FA errors a user can cause to 4xx.
+func totpError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTOTPCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTOTPAlreadyEnabled), errors.Is(err, services.ErrTOTPNotEnabled), errors.Is(err, services.ErrTOTPNotStarted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GET /api/2fa
+func GetTOTPStatus(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	enabled, err := services.TOTPEnabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": enabled})
+}
+
+// POST /api/2fa/enroll
+func BeginTOTPEnrollment(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := services.BeginTOTPEnrollment(userID)
+	if err != nil {
+		totpError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": enrollment})
+}
+
+// POST /api/2fa/confirm
+func ConfirmTOTPEnrollment(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := services.ConfirmTOTPEnrollment(userID, input.Code)
+	if err != nil {
+		totpError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// POST /api/2fa/disable
+func DisableTOTP(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.DisableTOTP(userID, input.Code); err != nil {
+		totpError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// POST /api/2fa/recovery-codes
+func RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(userID, input.Code)
+	if err != nil {
+		totpError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DELETE /admin/users/:id/2fa
+func ResetUserTOTP(c *gin.Context) {
+	adminID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if err := services.ResetTOTP(uint(id), adminID); err != nil {
+		if errors.Is(err, services.ErrTOTPNotEnabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
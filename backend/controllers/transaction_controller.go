@@ -1,59 +1,153 @@
 package controllers
 
 import (
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"bank/models"
+	"bank/money"
 	"bank/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 func MoneyTransfer(c *gin.Context) {
-	var tx models.Transaction
+	idempotent(c, "money-transfer", func(scope *idempotencyScope) (int, gin.H) {
+		var tx models.Transaction
 
-	if err := c.ShouldBindJSON(&tx); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+		if err := c.ShouldBindJSON(&tx); err != nil {
+			return http.StatusBadRequest, gin.H{"error": err.Error()}
+		}
 
-	if err := services.MoneyTransfer(&tx); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+		// Only the owner of the source account may move money out of it
+		if err := checkAccountAccess(c, tx.AccountID); err != nil {
+			return authzResponse(err)
+		}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "Transfer successful",
-		"transaction": tx,
+		success := func() gin.H {
+			return gin.H{
+				"message":     "Transfer successful",
+				"transaction": tx,
+			}
+		}
+		if err := services.MoneyTransfer(&tx, scope.completeWith(http.StatusOK, success)); err != nil {
+			return transferErrorResponse(err)
+		}
+
+		return http.StatusOK, success()
 	})
 }
 
 func MoneyRequest(c *gin.Context) {
-	var mr models.MoneyRequest
+	idempotent(c, "money-request", func(scope *idempotencyScope) (int, gin.H) {
+		var mr models.MoneyRequest
+
+		if err := c.ShouldBindJSON(&mr); err != nil {
+			return http.StatusBadRequest, gin.H{"error": err.Error()}
+		}
+
+		userID, ok := c.Get("userID")
+		if !ok {
+			return authzResponse(errUnauthorized)
+		}
+		mr.UserID = userID.(uint)
+
+		success := func() gin.H {
+			return gin.H{
+				"message": "Money Requst successful",
+				"Money":   mr,
+			}
+		}
+		if err := services.MoneyRequest(&mr, scope.completeWith(http.StatusOK, success)); err != nil {
+			return transferErrorResponse(err)
+		}
+
+		return http.StatusOK, success()
+	})
+}
+
+// transferErrorResponse answers a failed transfer or request: 400 for a
+// request the service refused, 422 for a limit, 401/403/404 for an
+// authorization failure and 500 for anything else, which idempotent won't
+// cache.
+func transferErrorResponse(err error) (int, gin.H) {
+	if status, body, ok := limitErrorResponse(err); ok {
+		return status, body
+	}
+	if isAuthzError(err) {
+		return authzResponse(err)
+	}
+	var invalid *services.ValidationError
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	}
+	return http.StatusInternalServerError, gin.H{"error": err.Error()}
+}
 
-	if err := c.ShouldBindJSON(&mr); err != nil {
+type CashInput struct {
+	AccountID   string       `json:"account_id" binding:"required"`
+	Amount      money.Amount `json:"amount" binding:"required"`
+	Description string       `json:"description"`
+}
+
+// POST /admin/accounts/deposit
+func Deposit(c *gin.Context) {
+	postCash(c, services.Deposit, "Deposit successful")
+}
+
+// POST /admin/accounts/withdraw
+func Withdraw(c *gin.Context) {
+	postCash(c, services.Withdraw, "Withdrawal successful")
+}
+
+func postCash(c *gin.Context, post func(*models.Transaction, uint) error, successMessage string) {
+	tellerID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var input CashInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := services.MoneyRequest(&mr); err != nil {
+	tx := models.Transaction{
+		AccountID:   input.AccountID,
+		Amount:      input.Amount,
+		Description: input.Description,
+	}
+	if err := post(&tx, tellerID.(uint)); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Money Requst successful",
-		"Money":   mr,
+		"message":     successMessage,
+		"transaction": tx,
 	})
 }
 
 func AcceptMoneyRequest(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	id, _ := strconv.Atoi(c.Param("id"))
-	err := services.AcceptMoneyRequest(uint(id))
+	err := services.AcceptMoneyRequest(uint(id), userID)
 	if err != nil {
+		if status, body, ok := limitErrorResponse(err); ok {
+			c.JSON(status, body)
+			return
+		}
+		if errors.Is(err, services.ErrForbidden) {
+			authzError(c, err)
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
@@ -61,9 +155,18 @@ func AcceptMoneyRequest(c *gin.Context) {
 }
 
 func DeclineMoneyRequest(c *gin.Context) {
+	userID, ok := actingUser(c)
+	if !ok {
+		return
+	}
+
 	id, _ := strconv.Atoi(c.Param("id"))
-	err := services.DeclineMoneyRequest(uint(id))
+	err := services.DeclineMoneyRequest(uint(id), userID)
 	if err != nil {
+		if errors.Is(err, services.ErrForbidden) {
+			authzError(c, err)
+			return
+		}
 		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
 		return
 	}
@@ -73,25 +176,35 @@ func DeclineMoneyRequest(c *gin.Context) {
 func GetTransactionHistoryHandler(c *gin.Context) {
 	var filter services.TransactionFilter
 
-	if userIDStr := c.Query("user_id"); userIDStr != "" {
-		if userID, err := strconv.Atoi(userIDStr); err == nil {
-			uid := uint(userID)
-			filter.UserID = &uid
-		}
+	pageReq, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	filter.PageRequest = pageReq
+
+	userID, ok := scopedUserID(c)
+	if !ok {
+		return
+	}
+	filter.UserID = userID
+
 	if accountID := c.Query("account_id"); accountID != "" {
+		if !authorizeAccount(c, accountID) {
+			return
+		}
 		filter.AccountID = &accountID
 	}
 	if transactionType := c.Query("transaction_type"); transactionType != "" {
 		filter.TransactionType = &transactionType
 	}
 	if minAmountStr := c.Query("min_amount"); minAmountStr != "" {
-		if minAmount, err := strconv.ParseFloat(minAmountStr, 64); err == nil {
+		if minAmount, err := money.Parse(minAmountStr); err == nil {
 			filter.MinAmount = &minAmount
 		}
 	}
 	if maxAmountStr := c.Query("max_amount"); maxAmountStr != "" {
-		if maxAmount, err := strconv.ParseFloat(maxAmountStr, 64); err == nil {
+		if maxAmount, err := money.Parse(maxAmountStr); err == nil {
 			filter.MaxAmount = &maxAmount
 		}
 	}
@@ -111,52 +224,42 @@ func GetTransactionHistoryHandler(c *gin.Context) {
 
 	transactions, err := services.GetTransactionHistory(filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		pageError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": transactions})
+	setPageHeaders(c, transactions)
+	c.JSON(http.StatusOK, gin.H{
+		"data":        transactions.Items,
+		"next_cursor": transactions.NextCursor,
+		"total":       transactions.Total,
+	})
 }
 
 func GetMoneyRequestsByUserID(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	if userIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+	userID, ok := scopedUserID(c)
+	if !ok {
 		return
 	}
-
-	userID, err := strconv.ParseUint(userIDStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+	if userID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
 		return
 	}
 
-	requests, err := services.GetMoneyRequestsByUserID(uint(userID))
+	pageReq, err := pageRequest(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, requests)
-}
-
-func GetFilteredNotifications(c *gin.Context) {
-	userID := c.Query("user_id")
-	filter := c.Query("filter") // all, requests, alert
-
-	if userID == "" {
-		c.JSON(400, gin.H{"error": "user_id is required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	notifications, err := services.GetFilteredNotifications(userID, filter)
+	requests, err := services.GetMoneyRequestsByUserID(*userID, pageReq)
 	if err != nil {
-		log.Printf("Error fetching notifications: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to retrieve notifications"})
+		pageError(c, err)
 		return
 	}
 
-	c.JSON(200, notifications)
+	setPageHeaders(c, requests)
+	c.JSON(http.StatusOK, requests.Items)
 }
 
 // GetDashboard returns summary data for the user's dashboard
@@ -197,3 +300,59 @@ func GetMonthlyTransactionVolume(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, data)
 }
+
+type CompensationInput struct {
+	Amount *money.Amount `json:"amount"` // defaults to everything not yet given back
+	Reason string        `json:"reason"`
+}
+
+// POST /admin/transactions/:id/reverse
+func ReverseTransaction(c *gin.Context) {
+	compensate(c, services.ReverseTransaction, "Transaction reversed")
+}
+
+// POST /user/transactions/:id/refund
+func RefundTransaction(c *gin.Context) {
+	compensate(c, services.RefundTransaction, "Transaction refunded")
+}
+
+func compensate(c *gin.Context, run func(uint, *money.Amount, string, uint) (*models.Transaction, error), successMessage string) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transaction ID"})
+		return
+	}
+
+	var input CompensationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := run(uint(id), input.Amount, input.Reason, userID.(uint))
+	switch {
+	case errors.Is(err, services.ErrNotRefundable):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNotATransfer):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrAlreadyReversed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     successMessage,
+		"transaction": tx,
+	})
+}
@@ -19,18 +19,8 @@ func Connect() {
         log.Fatal("Error loading .env file")
     }
 
-    // Format DSN
-    dsn := fmt.Sprintf(
-        "host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-        os.Getenv("DB_HOST"),
-        os.Getenv("DB_USER"),
-        os.Getenv("DB_PASSWORD"),
-        os.Getenv("DB_NAME"),
-        os.Getenv("DB_PORT"),
-    )
-
     // Open database connection
-    DB, err = sql.Open("postgres", dsn)
+    DB, err = sql.Open("postgres", DSN())
     if err != nil {
         log.Fatal("Failed to open database connection:", err)
     }
@@ -44,6 +34,18 @@ func Connect() {
     fmt.Println("Database connection established using raw SQL")
 }
 
+// DSN is the connection string built from the DB_* environment variables.
+func DSN() string {
+    return fmt.Sprintf(
+        "host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+        os.Getenv("DB_HOST"),
+        os.Getenv("DB_USER"),
+        os.Getenv("DB_PASSWORD"),
+        os.Getenv("DB_NAME"),
+        os.Getenv("DB_PORT"),
+    )
+}
+
 func GetDB() *sql.DB {
 	if DB == nil {
 		log.Fatal("Database not connected. Call db.Connect() first.")
@@ -1,10 +1,13 @@
 package db
 
 import (
+	"bank/models"
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func RunMigrations(db *sql.DB) error {
@@ -104,6 +107,522 @@ func RunMigrations(db *sql.DB) error {
 			CONSTRAINT fk_account_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 			CONSTRAINT fk_account_type FOREIGN KEY (account_type_id) REFERENCES account_types(id) ON DELETE RESTRICT
 		);`,
+
+		`CREATE TABLE IF NOT EXISTS journal_entries (
+			id SERIAL PRIMARY KEY,
+			reference VARCHAR(100) NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Postings are keyed by account number so that bank-owned ledger
+		// accounts (BANK-*) can sit next to customer accounts.
+		`CREATE TABLE IF NOT EXISTS postings (
+			id SERIAL PRIMARY KEY,
+			journal_entry_id INTEGER NOT NULL,
+			account_number VARCHAR(255) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL CHECK (amount <> 0),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT fk_posting_journal_entry FOREIGN KEY (journal_entry_id) REFERENCES journal_entries(id) ON DELETE RESTRICT
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_postings_account_number ON postings (account_number);`,
+
+		// Entries must balance per currency, so every posting carries one.
+		`ALTER TABLE postings ADD COLUMN IF NOT EXISTS currency VARCHAR(10);`,
+
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS journal_entry_id INTEGER REFERENCES journal_entries(id);`,
+
+		// Postings can never be changed or removed, only compensated.
+		`CREATE OR REPLACE FUNCTION postings_immutable() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'postings are immutable';
+		END;
+		$$ LANGUAGE plpgsql;`,
+
+		`DROP TRIGGER IF EXISTS postings_no_update_delete ON postings;`,
+
+		`CREATE TRIGGER postings_no_update_delete
+			BEFORE UPDATE OR DELETE ON postings
+			FOR EACH ROW EXECUTE FUNCTION postings_immutable();`,
+
+		// Every journal entry must sum to zero by the time its transaction commits.
+		`CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+		BEGIN
+			IF EXISTS (
+				SELECT 1 FROM postings
+				WHERE journal_entry_id = NEW.journal_entry_id
+				GROUP BY currency
+				HAVING SUM(amount) <> 0
+			) THEN
+				RAISE EXCEPTION 'journal entry % is not balanced', NEW.journal_entry_id;
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;`,
+
+		`DROP TRIGGER IF EXISTS postings_balanced ON postings;`,
+
+		`CREATE CONSTRAINT TRIGGER postings_balanced
+			AFTER INSERT ON postings
+			DEFERRABLE INITIALLY DEFERRED
+			FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();`,
+
+		// Bring balances that existed before the ledger into it once, funded
+		// from the bank cash account.
+		`WITH je AS (
+			INSERT INTO journal_entries (reference, description)
+			SELECT 'LEDGER-OPENING', 'Opening balances carried over from accounts.balance'
+			WHERE NOT EXISTS (SELECT 1 FROM journal_entries WHERE reference = 'LEDGER-OPENING')
+			  AND EXISTS (SELECT 1 FROM accounts WHERE balance <> 0)
+			RETURNING id
+		),
+		balances AS (
+			SELECT a.account_number, a.balance, at.currency
+			FROM accounts a
+			JOIN account_types at ON at.id = a.account_type_id
+			WHERE a.balance <> 0
+		)
+		INSERT INTO postings (journal_entry_id, account_number, amount, currency)
+		SELECT je.id, b.account_number, b.balance, b.currency FROM je, balances b
+		UNION ALL
+		SELECT je.id, 'BANK-CASH', -SUM(b.balance), b.currency FROM je, balances b
+		GROUP BY je.id, b.currency HAVING SUM(b.balance) <> 0;`,
+
+		// Postings written before they carried a currency take it from their
+		// account, and bank-side postings from the rest of their entry.
+		`ALTER TABLE postings DISABLE TRIGGER postings_no_update_delete;`,
+
+		`UPDATE postings p SET currency = at.currency
+		FROM accounts a
+		JOIN account_types at ON at.id = a.account_type_id
+		WHERE p.account_number = a.account_number AND p.currency IS NULL;`,
+
+		`UPDATE postings p SET currency = e.currency
+		FROM (
+			SELECT journal_entry_id, MIN(currency) AS currency
+			FROM postings
+			WHERE currency IS NOT NULL
+			GROUP BY journal_entry_id
+		) e
+		WHERE p.journal_entry_id = e.journal_entry_id AND p.currency IS NULL;`,
+
+		`ALTER TABLE postings ENABLE TRIGGER postings_no_update_delete;`,
+
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			idempotency_key VARCHAR(255) NOT NULL,
+			endpoint VARCHAR(255) NOT NULL,
+			request_hash VARCHAR(64) NOT NULL,
+			status_code INTEGER,
+			response_body TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			CONSTRAINT uq_idempotency_key UNIQUE (user_id, endpoint, idempotency_key),
+			CONSTRAINT fk_idempotency_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);`,
+
+		// 1 base_currency = rate quote_currency. spread is the fraction of the
+		// converted amount the bank keeps.
+		`CREATE TABLE IF NOT EXISTS exchange_rates (
+			id SERIAL PRIMARY KEY,
+			base_currency VARCHAR(10) NOT NULL,
+			quote_currency VARCHAR(10) NOT NULL,
+			rate NUMERIC(20,10) NOT NULL CHECK (rate > 0),
+			spread NUMERIC(8,6) NOT NULL DEFAULT 0 CHECK (spread >= 0 AND spread < 1),
+			valid_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			valid_to TIMESTAMP,
+			created_by INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT fk_exchange_rate_user FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+			CONSTRAINT chk_exchange_rate_window CHECK (valid_to IS NULL OR valid_to > valid_from)
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_exchange_rates_pair ON exchange_rates (base_currency, quote_currency, valid_from DESC);`,
+
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency VARCHAR(10);`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS counter_amount DECIMAL(15,2);`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS counter_currency VARCHAR(10);`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate NUMERIC(20,10);`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_spread DECIMAL(15,2);`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS exchange_rate_id INTEGER REFERENCES exchange_rates(id);`,
+
+		`UPDATE transactions t SET currency = at.currency
+		FROM accounts a
+		JOIN account_types at ON at.id = a.account_type_id
+		WHERE t.account_id = a.account_number AND t.currency IS NULL;`,
+
+		// Reversals and refunds point at the DEBIT row of the transfer they
+		// compensate, which keeps a running total of what was given back.
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversal_of_id INTEGER REFERENCES transactions(id);`,
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversed_amount DECIMAL(15,2) NOT NULL DEFAULT 0;`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_reversal_of_id ON transactions (reversal_of_id);`,
+
+		`CREATE TABLE IF NOT EXISTS standing_orders (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			from_account_id VARCHAR(255) NOT NULL,
+			to_account_id VARCHAR(255) NOT NULL,
+			amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+			description TEXT,
+			frequency VARCHAR(20) NOT NULL,
+			start_at TIMESTAMP NOT NULL,
+			end_date TIMESTAMP,
+			max_runs INTEGER,
+			occurrences INTEGER NOT NULL DEFAULT 0,
+			next_run_at TIMESTAMP NOT NULL,
+			retry_at TIMESTAMP,
+			retry_count INTEGER NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE',
+			last_run_at TIMESTAMP,
+			last_error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT fk_standing_order_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_standing_orders_due ON standing_orders (status, next_run_at);`,
+
+		// Transfer limits; NULL means unlimited.
+		`ALTER TABLE account_types ADD COLUMN IF NOT EXISTS per_transaction_limit DECIMAL(15,2);`,
+		`ALTER TABLE account_types ADD COLUMN IF NOT EXISTS daily_limit DECIMAL(15,2);`,
+		`ALTER TABLE account_types ADD COLUMN IF NOT EXISTS monthly_limit DECIMAL(15,2);`,
+
+		// Admin overrides for one account or for every account of a user. A
+		// NULL column falls through to the next level.
+		`CREATE TABLE IF NOT EXISTS limit_overrides (
+			id SERIAL PRIMARY KEY,
+			account_number VARCHAR(255) UNIQUE,
+			user_id INTEGER UNIQUE,
+			per_transaction_limit DECIMAL(15,2),
+			daily_limit DECIMAL(15,2),
+			monthly_limit DECIMAL(15,2),
+			set_by INTEGER,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT chk_limit_override_target CHECK ((account_number IS NULL) <> (user_id IS NULL)),
+			CONSTRAINT fk_limit_override_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			CONSTRAINT fk_limit_override_set_by FOREIGN KEY (set_by) REFERENCES users(id) ON DELETE SET NULL
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_transactions_account_date ON transactions (account_id, transaction_date);`,
+
+		// Transfer pricing. The most specific active rule whose amount band
+		// contains the transfer applies; several bands make a tiered tariff.
+		`CREATE TABLE IF NOT EXISTS fee_rules (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			account_type_id INTEGER,
+			scope VARCHAR(20) NOT NULL DEFAULT 'ALL',
+			min_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+			max_amount DECIMAL(15,2),
+			flat_fee DECIMAL(15,2) NOT NULL DEFAULT 0,
+			percentage NUMERIC(9,6) NOT NULL DEFAULT 0,
+			min_fee DECIMAL(15,2),
+			max_fee DECIMAL(15,2),
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_by INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT chk_fee_rule_scope CHECK (scope IN ('ALL', 'INTERNAL', 'EXTERNAL')),
+			CONSTRAINT fk_fee_rule_account_type FOREIGN KEY (account_type_id) REFERENCES account_types(id) ON DELETE CASCADE,
+			CONSTRAINT fk_fee_rule_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+		);`,
+
+		// FEE rows point at the DEBIT row of the transfer they were charged on
+		`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee_of_id INTEGER REFERENCES transactions(id);`,
+
+		// Interest configuration; a zero rate means the type pays no interest.
+		`ALTER TABLE account_types ADD COLUMN IF NOT EXISTS interest_rate NUMERIC(9,6) NOT NULL DEFAULT 0;`,
+		`ALTER TABLE account_types ADD COLUMN IF NOT EXISTS day_count VARCHAR(10) NOT NULL DEFAULT 'ACT/365';`,
+		`ALTER TABLE account_types ADD COLUMN IF NOT EXISTS compounding VARCHAR(10) NOT NULL DEFAULT 'NONE';`,
+		`ALTER TABLE account_types ADD COLUMN IF NOT EXISTS interest_posting VARCHAR(10) NOT NULL DEFAULT 'MONTHLY';`,
+
+		// One row per account and day. Amounts keep sub-cent precision until
+		// the period's total is rounded and paid.
+		`CREATE TABLE IF NOT EXISTS interest_accruals (
+			id SERIAL PRIMARY KEY,
+			account_number VARCHAR(255) NOT NULL,
+			accrual_date DATE NOT NULL,
+			balance DECIMAL(15,2) NOT NULL,
+			rate NUMERIC(9,6) NOT NULL,
+			amount NUMERIC(24,10) NOT NULL,
+			posted_transaction_id INTEGER REFERENCES transactions(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			CONSTRAINT uq_interest_accrual_day UNIQUE (account_number, accrual_date)
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_interest_accruals_unposted ON interest_accruals (account_number) WHERE posted_transaction_id IS NULL;`,
+
+		// Login sessions. Access tokens carry the session id and stop working
+		// once the session is revoked.
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			user_agent TEXT,
+			ip_address VARCHAR(64),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			revoked_at TIMESTAMP,
+			revoked_reason VARCHAR(100)
+		);`,
+
+		// Only hashes of refresh tokens are stored. A token is used once; a
+		// second use means it leaked and revokes its session.
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id SERIAL PRIMARY KEY,
+			session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) NOT NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (user_id) WHERE revoked_at IS NULL;`,
+
+		// TOTP second factor. The secret is pending until the user confirms
+		// a first code; last_used_step stops a code from being used twice.
+		`CREATE TABLE IF NOT EXISTS user_totp (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			secret VARCHAR(64) NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			last_used_step BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			confirmed_at TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS recovery_codes (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash VARCHAR(64) NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Issued by the password step of a login when 2FA is on; exchanged
+		// together with a code for the session tokens.
+		`CREATE TABLE IF NOT EXISTS login_challenges (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) NOT NULL UNIQUE,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Forgotten-password tokens, stored hashed and usable once.
+		`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) NOT NULL UNIQUE,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP,
+			requested_ip VARCHAR(64),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Login history; failed rows from an IP also drive the per-IP block.
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			email VARCHAR(255) NOT NULL,
+			ip_address VARCHAR(64) NOT NULL,
+			user_agent TEXT,
+			success BOOLEAN NOT NULL,
+			failure_reason VARCHAR(50),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts (ip_address, created_at) WHERE NOT success;`,
+		`CREATE INDEX IF NOT EXISTS idx_login_attempts_user ON login_attempts (user_id, created_at);`,
+
+		// Consecutive failures per email, known or not, so lockouts do not
+		// reveal which emails are registered.
+		`CREATE TABLE IF NOT EXISTS login_lockouts (
+			email VARCHAR(255) PRIMARY KEY,
+			failed_attempts INTEGER NOT NULL DEFAULT 0,
+			locked_until TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Permission-based access control. Roles grant permissions and a user
+		// holds the union of the permissions of all their roles.
+		`CREATE TABLE IF NOT EXISTS permissions (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL UNIQUE,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS role_permissions (
+			role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+			permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+			PRIMARY KEY (role_id, permission_id)
+		);`,
+
+		`DELETE FROM user_roles a USING user_roles b
+		WHERE a.id > b.id AND a.user_id = b.user_id AND a.role_id = b.role_id;`,
+
+		`CREATE UNIQUE INDEX IF NOT EXISTS uq_user_roles ON user_roles (user_id, role_id);`,
+
+		`INSERT INTO roles (name, created_at) VALUES ('User', NOW()), ('Admin', NOW()) ON CONFLICT (name) DO NOTHING;`,
+
+		seedPermissions(),
+
+		// Notifications are pushed with their id so clients can resume after
+		// a reconnect and acknowledge what they received. Rows that predate
+		// acknowledgements count as delivered.
+		`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS type VARCHAR(50) NOT NULL DEFAULT 'GENERAL';`,
+		`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;`,
+		`ALTER TABLE notifications ALTER COLUMN delivered_at DROP DEFAULT;`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, id);`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_undelivered ON notifications (user_id, id) WHERE delivered_at IS NULL;`,
+
+		// Typed notifications carry their data as a JSON payload and are
+		// rendered from per-locale templates. Older rows, stored as plain
+		// text, are classified from their message.
+		`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS payload JSONB NOT NULL DEFAULT '{}';`,
+		`UPDATE notifications n SET type = c.type
+		FROM (
+			SELECT id, CASE
+				WHEN message ILIKE 'Standing order%failed%' THEN 'STANDING_ORDER_FAILED'
+				WHEN message ILIKE '%requested%' THEN 'REQUEST_RECEIVED'
+				WHEN message ILIKE '%declined%' THEN 'REQUEST_DECLINED'
+				WHEN message ILIKE '%expired%' THEN 'REQUEST_EXPIRED'
+				WHEN message ILIKE '%was reversed' OR message ILIKE '%was refunded' THEN 'TRANSFER_REVERSED'
+				WHEN message ILIKE 'You received%' THEN 'TRANSFER_RECEIVED'
+				WHEN message ILIKE '%was deposited%' THEN 'CASH_DEPOSIT'
+				WHEN message ILIKE '%was withdrawn%' THEN 'CASH_WITHDRAWAL'
+				WHEN message ILIKE '%interest was paid%' THEN 'INTEREST_PAID'
+				ELSE 'GENERAL'
+			END AS type
+			FROM notifications
+			WHERE type IN ('GENERAL', 'TRANSFER', 'MONEY_REQUEST', 'CASH', 'REVERSAL', 'INTEREST', 'STANDING_ORDER')
+		) c
+		WHERE n.id = c.id AND n.type <> c.type;`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE is_read = FALSE;`,
+
+		// Per-user notification channels. Only choices that differ from the
+		// defaults need a row.
+		`CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			type VARCHAR(50) NOT NULL,
+			channel VARCHAR(20) NOT NULL,
+			enabled BOOLEAN NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, type, channel)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS notification_webhooks (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			url TEXT NOT NULL,
+			secret VARCHAR(128) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Outbox of email, SMS and webhook deliveries, written in the same
+		// transaction as the notification and retried with backoff.
+		`CREATE TABLE IF NOT EXISTS notification_deliveries (
+			id SERIAL PRIMARY KEY,
+			notification_id INTEGER NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+			channel VARCHAR(20) NOT NULL,
+			destination TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			sent_at TIMESTAMP,
+			UNIQUE (notification_id, channel)
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_notification_deliveries_due ON notification_deliveries (next_attempt_at) WHERE status = 'PENDING';`,
+
+		// Transactional outbox. Services write events in the transaction of
+		// the change; the relay hands each one to every consumer, and a
+		// consumer's effects commit together with its consumption row so
+		// no event is applied twice.
+		`CREATE TABLE IF NOT EXISTS domain_events (
+			id BIGSERIAL PRIMARY KEY,
+			type VARCHAR(100) NOT NULL,
+			aggregate_type VARCHAR(50) NOT NULL,
+			aggregate_id VARCHAR(100) NOT NULL,
+			actor_id INTEGER,
+			payload JSONB NOT NULL DEFAULT '{}',
+			occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS domain_event_consumptions (
+			consumer VARCHAR(100) NOT NULL,
+			event_id BIGINT NOT NULL REFERENCES domain_events(id) ON DELETE CASCADE,
+			status VARCHAR(10) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (consumer, event_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS event_subscriptions (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			url TEXT NOT NULL,
+			secret VARCHAR(128) NOT NULL,
+			event_types TEXT[] NOT NULL DEFAULT '{}',
+			start_after_event_id BIGINT NOT NULL DEFAULT 0,
+			created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		// Notifications stored with the in-app channel off are never
+		// replayed, not even to a client that asks from an older id. Older
+		// rows of that kind were marked delivered in the insert itself.
+		`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS in_app BOOLEAN;`,
+		`UPDATE notifications SET in_app = delivered_at IS DISTINCT FROM created_at WHERE in_app IS NULL;`,
+		`ALTER TABLE notifications ALTER COLUMN in_app SET DEFAULT TRUE;`,
+		`ALTER TABLE notifications ALTER COLUMN in_app SET NOT NULL;`,
+
+		// Every forgotten-password request, known email or not, for the
+		// per-email and per-IP limits.
+		`CREATE TABLE IF NOT EXISTS password_reset_requests (
+			id SERIAL PRIMARY KEY,
+			email VARCHAR(255) NOT NULL,
+			ip_address VARCHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_password_reset_requests_email ON password_reset_requests (email, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_password_reset_requests_ip ON password_reset_requests (ip_address, created_at);`,
+
+		// The transaction that recorded each event. A relay keeps, per
+		// consumer, a transaction id below which it has seen every event,
+		// so it only looks at events of later transactions and at retries.
+		// Events from before this column count as one old transaction.
+		`ALTER TABLE domain_events ADD COLUMN IF NOT EXISTS txid BIGINT;`,
+		`UPDATE domain_events SET txid = 0 WHERE txid IS NULL;`,
+		`ALTER TABLE domain_events ALTER COLUMN txid SET DEFAULT txid_current();`,
+		`ALTER TABLE domain_events ALTER COLUMN txid SET NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_domain_events_txid ON domain_events (txid);`,
+
+		`CREATE TABLE IF NOT EXISTS domain_event_watermarks (
+			consumer VARCHAR(100) PRIMARY KEY,
+			txid BIGINT NOT NULL
+		);`,
+
+		`CREATE INDEX IF NOT EXISTS idx_domain_event_consumptions_due ON domain_event_consumptions (consumer, processed_at) WHERE status IN ('RETRY', 'SENDING');`,
+
+		// Fee amounts are in the currency of the rule. Account type rules
+		// take the currency of their type; global rules only carried over
+		// while every account type shared one currency, the others have to
+		// be given one before they apply again.
+		`ALTER TABLE fee_rules ADD COLUMN IF NOT EXISTS currency VARCHAR(10);`,
+		`UPDATE fee_rules f SET currency = UPPER(at.currency)
+		FROM account_types at
+		WHERE f.account_type_id = at.id AND f.currency IS NULL;`,
+		`UPDATE fee_rules SET currency = (
+			SELECT UPPER(MIN(currency)) FROM account_types HAVING COUNT(DISTINCT UPPER(currency)) = 1)
+		WHERE account_type_id IS NULL AND currency IS NULL;`,
 	}
 
 	for _, stmt := range statements {
@@ -115,3 +634,33 @@ func RunMigrations(db *sql.DB) error {
 	log.Println("All tables created successfully.")
 	return nil
 }
+
+// seedPermissions creates the permissions the code knows about. Default
+// grants are only made for permissions created by this run, so grants an
+// admin removed stay removed.
+func seedPermissions() string {
+	values := make([]string, 0, len(models.PermissionSeeds))
+	for _, p := range models.PermissionSeeds {
+		roles := make([]string, 0, len(p.DefaultRoles))
+		for _, r := range p.DefaultRoles {
+			roles = append(roles, pq.QuoteLiteral(r))
+		}
+		values = append(values, fmt.Sprintf("(%s, %s, ARRAY[%s]::text[])",
+			pq.QuoteLiteral(p.Name), pq.QuoteLiteral(p.Description), strings.Join(roles, ", ")))
+	}
+
+	return `WITH seed (name, description, roles) AS (
+			VALUES ` + strings.Join(values, ",\n\t\t\t\t") + `
+		),
+		created AS (
+			INSERT INTO permissions (name, description, created_at)
+			SELECT name, description, NOW() FROM seed
+			ON CONFLICT (name) DO NOTHING
+			RETURNING id, name
+		)
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT r.id, c.id FROM created c
+		JOIN seed s ON s.name = c.name
+		JOIN roles r ON r.name = ANY (s.roles)
+		ON CONFLICT DO NOTHING;`
+}
@@ -1,9 +1,11 @@
 package dtos
 
+import "bank/money"
+
 type AccountResponse struct {
 	ID             uint    `json:"id"`
 	AccountNumber  string  `json:"account_number"`
-	Balance        float64 `json:"balance"`
+	Balance        money.Amount `json:"balance"`
 	UserID         uint    `json:"user_id"`
 	AccountTypeID  uint    `json:"account_type_id"`
 	TypeName       string  `json:"type_name"`
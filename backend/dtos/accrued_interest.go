@@ -0,0 +1,20 @@
+package dtos
+
+import (
+	"bank/money"
+	"time"
+)
+
+// AccruedInterest is interest earned by an account but not yet paid. Accrued
+// is rounded to cents; AccruedExact keeps the precision used for accrual.
+type AccruedInterest struct {
+	AccountNumber   string      `json:"account_number"`
+	InterestRate    string      `json:"interest_rate"`
+	DayCount        string      `json:"day_count"`
+	Compounding     string      `json:"compounding"`
+	InterestPosting string      `json:"interest_posting"`
+	Accrued         money.Money `json:"accrued"`
+	AccruedExact    string      `json:"accrued_exact"`
+	From            *time.Time  `json:"from,omitempty"`
+	Through         *time.Time  `json:"through,omitempty"`
+}
@@ -0,0 +1,9 @@
+package dtos
+
+// EventSubscriptionRequest registers an endpoint for domain events. An
+// empty EventTypes subscribes to every type.
+type EventSubscriptionRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types"`
+}
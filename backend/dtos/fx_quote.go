@@ -0,0 +1,17 @@
+package dtos
+
+import (
+	"bank/money"
+	"time"
+)
+
+// FXQuote describes how an amount converts between two currencies at a
+// published rate. Pass RateID back as exchange_rate_id to transfer at it.
+type FXQuote struct {
+	RateID     uint        `json:"rate_id"`
+	From       money.Money `json:"from"`
+	To         money.Money `json:"to"`
+	Rate       string      `json:"rate"`
+	Spread     money.Money `json:"spread"`
+	ValidUntil *time.Time  `json:"valid_until,omitempty"`
+}
@@ -0,0 +1,16 @@
+package dtos
+
+import "bank/money"
+
+type LedgerDiscrepancy struct {
+	AccountNumber string       `json:"account_number"`
+	StoredBalance money.Amount `json:"stored_balance"`
+	LedgerBalance money.Amount `json:"ledger_balance"`
+}
+
+type LedgerReport struct {
+	Balanced          bool                `json:"balanced"`
+	LedgerTotals      []money.Money       `json:"ledger_totals"`
+	UnbalancedEntries []uint              `json:"unbalanced_entries"`
+	Discrepancies     []LedgerDiscrepancy `json:"discrepancies"`
+}
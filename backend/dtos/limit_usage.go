@@ -0,0 +1,19 @@
+package dtos
+
+import "bank/money"
+
+// LimitUsage shows one limit of an account and how much of it is left.
+// Limit and Remaining are nil when the limit is unlimited.
+type LimitUsage struct {
+	Limit     *money.Amount `json:"limit"`
+	Used      money.Amount  `json:"used"`
+	Remaining *money.Amount `json:"remaining"`
+}
+
+type AccountLimits struct {
+	AccountNumber  string        `json:"account_number"`
+	Currency       string        `json:"currency"`
+	PerTransaction *money.Amount `json:"per_transaction"`
+	Daily          LimitUsage    `json:"daily"`
+	Monthly        LimitUsage    `json:"monthly"`
+}
@@ -0,0 +1,26 @@
+package dtos
+
+// NotificationPreferences is a user's type × channel matrix, with the
+// defaults filled in for anything never set.
+type NotificationPreferences struct {
+	Preferences []NotificationTypePreferences `json:"preferences"`
+	Webhook     *NotificationWebhook          `json:"webhook"`
+}
+
+type NotificationTypePreferences struct {
+	Type     string          `json:"type"`
+	Channels map[string]bool `json:"channels"`
+}
+
+type NotificationPreferenceUpdate struct {
+	Type    string `json:"type" binding:"required"`
+	Channel string `json:"channel" binding:"required"`
+	Enabled bool   `json:"enabled"`
+}
+
+// NotificationWebhook is the endpoint webhook notifications are posted to.
+// Secret is only returned when the endpoint is set.
+type NotificationWebhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
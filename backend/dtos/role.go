@@ -0,0 +1,9 @@
+package dtos
+
+// RoleWithPermissions is a role and everything it grants.
+type RoleWithPermissions struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	UserCount   int      `json:"user_count"`
+}
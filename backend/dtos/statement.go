@@ -0,0 +1,30 @@
+package dtos
+
+import (
+	"bank/money"
+	"time"
+)
+
+// Statement lists the ledger movements of an account over [From, To] with
+// the balance before, after and following every line.
+type Statement struct {
+	AccountNumber  string          `json:"account_number"`
+	Currency       string          `json:"currency"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance money.Amount    `json:"opening_balance"`
+	TotalIn        money.Amount    `json:"total_in"`
+	TotalOut       money.Amount    `json:"total_out"`
+	ClosingBalance money.Amount    `json:"closing_balance"`
+	Lines          []StatementLine `json:"lines"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+}
+
+type StatementLine struct {
+	Date          time.Time    `json:"date"`
+	Reference     string       `json:"reference"`
+	Description   string       `json:"description"`
+	TransactionID *uint        `json:"transaction_id,omitempty"`
+	Amount        money.Amount `json:"amount"`
+	Balance       money.Amount `json:"balance"`
+}
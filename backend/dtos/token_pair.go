@@ -0,0 +1,9 @@
+package dtos
+
+// TokenPair is returned by login and refresh. The refresh token is only
+// valid once; the response to using it carries its successor.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds until the access token expires
+}
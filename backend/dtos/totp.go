@@ -0,0 +1,8 @@
+package dtos
+
+// TOTPEnrollment is shown once while setting up an authenticator app. The
+// URI carries the same secret and is usually rendered as a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
@@ -0,0 +1,14 @@
+package dtos
+
+import "bank/money"
+
+// TransferQuote is what a transfer would cost before it is executed. Total
+// is what leaves the sender: the amount plus the fee.
+type TransferQuote struct {
+	Amount    money.Money `json:"amount"`
+	Fee       money.Money `json:"fee"`
+	FeeRuleID *uint       `json:"fee_rule_id,omitempty"`
+	Total     money.Money `json:"total"`
+	Received  money.Money `json:"received"`
+	FX        *FXQuote    `json:"fx,omitempty"`
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"bank/db"
+	"bank/services"
+	"bank/utils"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StartEventRelayJob relays domain events as soon as Postgres reports new
+// ones, and every EVENT_RELAY_INTERVAL (default 5s) in case a notification
+// was missed. Old events are pruned hourly.
+func StartEventRelayJob() {
+	ticker := time.NewTicker(utils.GetEnvDuration("EVENT_RELAY_INTERVAL", 5*time.Second))
+	prune := time.NewTicker(time.Hour)
+
+	listener := pq.NewListener(db.DSN(), 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Domain event listener:", err)
+		}
+	})
+	if err := listener.Listen(services.DomainEventChannel); err != nil {
+		log.Println("Failed to listen for domain events, polling only:", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+			case <-listener.Notify:
+			case <-prune.C:
+				services.PruneDomainEvents()
+				continue
+			}
+			services.RelayDomainEvents()
+		}
+	}()
+}
@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"bank/services"
+	"bank/utils"
+	"log"
+	"time"
+)
+
+// StartIdempotencyCleanupJob periodically deletes expired idempotency keys.
+// The interval is read from IDEMPOTENCY_CLEANUP_INTERVAL (default 1h).
+func StartIdempotencyCleanupJob() {
+	ticker := time.NewTicker(utils.GetEnvDuration("IDEMPOTENCY_CLEANUP_INTERVAL", time.Hour))
+
+	go func() {
+		for range ticker.C {
+			deleted, err := services.DeleteExpiredIdempotencyKeys()
+			if err != nil {
+				log.Println("Idempotency cleanup failed:", err)
+				continue
+			}
+			log.Printf("Idempotency cleanup removed %d expired keys", deleted)
+		}
+	}()
+}
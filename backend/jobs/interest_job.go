@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"bank/services"
+	"bank/utils"
+	"time"
+)
+
+// StartInterestJob accrues and pays interest every INTEREST_ACCRUAL_INTERVAL
+// (default 1h). Each run only handles completed days that are not accrued yet.
+func StartInterestJob() {
+	ticker := time.NewTicker(utils.GetEnvDuration("INTEREST_ACCRUAL_INTERVAL", time.Hour))
+
+	go func() {
+		for range ticker.C {
+			services.AccrueInterest()
+		}
+	}()
+}
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"bank/services"
+	"bank/utils"
+	"time"
+)
+
+// StartNotificationDeliveryJob sends queued email, SMS and webhook
+// notifications every NOTIFICATION_DELIVERY_INTERVAL (default 10s).
+func StartNotificationDeliveryJob() {
+	ticker := time.NewTicker(utils.GetEnvDuration("NOTIFICATION_DELIVERY_INTERVAL", 10*time.Second))
+
+	go func() {
+		for range ticker.C {
+			services.DeliverPendingNotifications()
+		}
+	}()
+}
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"bank/services"
+	"bank/utils"
+	"time"
+)
+
+// StartStandingOrderJob executes due standing orders every
+// STANDING_ORDER_INTERVAL (default 1m).
+func StartStandingOrderJob() {
+	ticker := time.NewTicker(utils.GetEnvDuration("STANDING_ORDER_INTERVAL", time.Minute))
+
+	go func() {
+		for range ticker.C {
+			services.ExecuteDueStandingOrders()
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogSender writes messages to the application log instead of sending them.
+// Tokens in links are masked, since logs are read by more people than the
+// mail they stand in for.
+type LogSender struct{}
+
+var linkToken = regexp.MustCompile(`([?&]token=)[^&\s]+`)
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, linkToken.ReplaceAllString(msg.Body, "${1}REDACTED"))
+	return nil
+}
+
+// FileSender writes each message to its own file in Dir, for inspecting
+// mail while developing.
+type FileSender struct {
+	Dir string
+}
+
+func (s FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", string(filepath.Separator), "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(content), 0o600)
+}
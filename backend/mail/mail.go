@@ -0,0 +1,71 @@
+// Package mail sends the emails the bank writes to its users. The sender is
+// chosen at startup from MAIL_DRIVER so development setups need no mail
+// server.
+package mail
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(msg Message) error
+}
+
+var (
+	mu     sync.RWMutex
+	sender Sender = LogSender{}
+)
+
+// Init picks the sender from the environment:
+//
+//	MAIL_DRIVER=smtp  SMTPSender configured by SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, MAIL_FROM
+//	MAIL_DRIVER=file  FileSender writing to MAIL_DIR (default ./mail-out)
+//	anything else     LogSender
+func Init() {
+	var s Sender
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		s = SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail-out"
+		}
+		s = FileSender{Dir: dir}
+	default:
+		s = LogSender{}
+	}
+	SetSender(s)
+	log.Printf("Mail sender: %T", s)
+}
+
+// SetSender replaces the sender used by Send.
+func SetSender(s Sender) {
+	mu.Lock()
+	defer mu.Unlock()
+	sender = s
+}
+
+// Send delivers msg with the configured sender.
+func Send(msg Message) error {
+	mu.RLock()
+	s := sender
+	mu.RUnlock()
+	return s.Send(msg)
+}
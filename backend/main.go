@@ -3,9 +3,14 @@ package main
 import (
 	"bank/db"
 	"bank/jobs"
+	"bank/mail"
+	"bank/notify"
 	"bank/routes"
+	"bank/services"
+	"bank/utils"
 	"bank/websocket"
 	"log"
+	"os"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -20,18 +25,43 @@ func main() {
 		log.Fatalf("Migration failed: %v", err)
 	}
 
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("Loading JWT signing keys failed: %v", err)
+	}
+	mail.Init()
+	notify.Init()
+	if err := services.LoadNotificationTemplates(); err != nil {
+		log.Fatalf("Loading notification templates failed: %v", err)
+	}
+
 	// Start Background Jobs and WebSocket Dispatcher
 	jobs.StartAutoExpireJob()
-	websocket.StartDispatcher()
+	jobs.StartIdempotencyCleanupJob()
+	jobs.StartStandingOrderJob()
+	jobs.StartInterestJob()
+	jobs.StartNotificationDeliveryJob()
+	jobs.StartEventRelayJob()
+
+	broker, err := websocket.NewBroker(os.Getenv("NOTIFY_BROKER"), db.GetDB(), db.DSN(), services.NotificationBacklog{})
+	if err != nil {
+		log.Fatalf("Notification broker: %v", err)
+	}
+	if err := websocket.StartDispatcher(broker); err != nil {
+		log.Fatalf("Starting notification dispatcher failed: %v", err)
+	}
 
 	// Set up Gin Router
-	r := gin.Default()
+	r := gin.New()
+	// Socket handshakes are left out of the request log; older clients put
+	// their access token in the URL
+	r.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/ws"}}), gin.Recovery())
 
 	// CORS Configuration
 	config := cors.Config{
 		AllowAllOrigins: true,
 		AllowHeaders:    []string{"*"},
 		AllowMethods:    []string{"GET", "POST", "PUT", "DELETE"},
+		ExposeHeaders:   []string{"X-Next-Cursor", "X-Total-Count", "Idempotent-Replayed", "Retry-After"},
 	}
 
 	r.Use(cors.New(config))
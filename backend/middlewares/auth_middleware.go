@@ -1,9 +1,11 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
+	"bank/services"
 	"bank/utils"
 
 	"github.com/gin-gonic/gin"
@@ -19,40 +21,78 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := strings.Split(authHeader, "Bearer ")[1]
-		userID, role, err := utils.ValidateToken(tokenString)
+		claims, err := utils.ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		c.Set("userID", userID)
-		c.Set("role", role)
-		c.Next()
-	}
-}
-
-
-func RoleMiddleware(requiredRole string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-
-		role, exists := c.Get("role")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Role not found"})
+		// Tokens of logged out or revoked sessions are rejected before they
+		// expire; permissions come from the user's current roles
+		permissions, active, err := services.SessionPermissions(claims.SessionID, claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
 			c.Abort()
 			return
 		}
-
-		if role != requiredRole {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: insufficient permissions"})
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
 			c.Abort()
 			return
 		}
 
+		granted := make(map[string]bool, len(permissions))
+		for _, p := range permissions {
+			granted[p] = true
+		}
+
+		c.Set("userID", claims.UserID)
+		c.Set("roles", claims.Roles)
+		c.Set("permissions", granted)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
+	}
+}
 
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// AuthenticateToken validates an access token the way JWTAuthMiddleware
+// does and returns the user it was issued to. It is used where the token
+// does not arrive in the Authorization header, such as WebSocket handshakes.
+func AuthenticateToken(token string) (uint, error) {
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		return 0, err
+	}
+
+	_, active, err := services.SessionPermissions(claims.SessionID, claims.UserID)
+	if err != nil {
+		return 0, err
 	}
+	if !active {
+		return 0, ErrSessionRevoked
+	}
+	return claims.UserID, nil
 }
 
+// HasPermission reports whether the authenticated user holds permission.
+func HasPermission(c *gin.Context, permission string) bool {
+	granted, _ := c.Get("permissions")
+	set, _ := granted.(map[string]bool)
+	return set[permission]
+}
 
+// RequirePermission lets the request through only when the user holds
+// permission; it must run after JWTAuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: missing permission " + permission})
+			c.Abort()
+			return
+		}
 
+		c.Next()
+	}
+}
@@ -1,8 +1,24 @@
 package models
 
+import "bank/money"
+
 type AccountType struct {
 	ID          uint   `gorm:"primaryKey"`
 	TypeName    string `gorm:"unique;not null" json:"type_name"`
 	Description string
 	Currency    string `gorm:"not null" json:"currency"`
-}
\ No newline at end of file
+
+	// Outgoing transfer limits for accounts of this type; nil means unlimited
+	PerTransactionLimit *money.Amount `json:"per_transaction_limit,omitempty"`
+	DailyLimit          *money.Amount `json:"daily_limit,omitempty"`
+	MonthlyLimit        *money.Amount `json:"monthly_limit,omitempty"`
+
+	// Interest paid on positive balances. InterestRate is the annual rate as
+	// a decimal fraction ("0.035"); DayCount is ACT/365, ACT/360 or 30/360;
+	// Compounding is NONE or DAILY (accrued interest earns interest before it
+	// is paid); InterestPosting is MONTHLY, QUARTERLY or ANNUALLY.
+	InterestRate    string `json:"interest_rate"`
+	DayCount        string `json:"day_count"`
+	Compounding     string `json:"compounding"`
+	InterestPosting string `json:"interest_posting"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain event types
+const (
+	EventTransferCompleted    = "TransferCompleted"
+	EventMoneyRequestCreated  = "MoneyRequestCreated"
+	EventMoneyRequestAccepted = "MoneyRequestAccepted"
+	EventMoneyRequestDeclined = "MoneyRequestDeclined"
+	EventMoneyRequestExpired  = "MoneyRequestExpired"
+	EventCashDeposited        = "CashDeposited"
+	EventCashWithdrawn        = "CashWithdrawn"
+	EventTransactionReversed  = "TransactionReversed"
+	EventInterestPaid         = "InterestPaid"
+	EventStandingOrderFailed  = "StandingOrderFailed"
+	EventStandingOrderSkipped = "StandingOrderSkipped"
+	EventAccountCreated       = "AccountCreated"
+	EventAccountUpdated       = "AccountUpdated"
+	EventAccountDeleted       = "AccountDeleted"
+	EventUserActivated        = "UserActivated"
+	EventUserDeactivated      = "UserDeactivated"
+)
+
+// DomainEventTypes lists every event type, for subscription filters.
+var DomainEventTypes = []string{
+	EventTransferCompleted,
+	EventMoneyRequestCreated,
+	EventMoneyRequestAccepted,
+	EventMoneyRequestDeclined,
+	EventMoneyRequestExpired,
+	EventCashDeposited,
+	EventCashWithdrawn,
+	EventTransactionReversed,
+	EventInterestPaid,
+	EventStandingOrderFailed,
+	EventStandingOrderSkipped,
+	EventAccountCreated,
+	EventAccountUpdated,
+	EventAccountDeleted,
+	EventUserActivated,
+	EventUserDeactivated,
+}
+
+// DomainEvent records a business change. It is written in the same
+// transaction as the change and relayed to each consumer exactly once.
+type DomainEvent struct {
+	ID            uint            `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	ActorID       *uint           `json:"actor_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+}
+
+// EventSubscription forwards domain events to an external endpoint. An
+// empty EventTypes means every type.
+type EventSubscription struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	CreatedBy  *uint     `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ExchangeRate publishes that 1 BaseCurrency buys Rate QuoteCurrency during
+// [ValidFrom, ValidTo). Spread is the fraction of a converted amount the bank
+// keeps. Rate and Spread are decimal strings so they stay exact.
+type ExchangeRate struct {
+	ID            uint       `json:"id"`
+	BaseCurrency  string     `json:"base_currency" binding:"required"`
+	QuoteCurrency string     `json:"quote_currency" binding:"required"`
+	Rate          string     `json:"rate" binding:"required"`
+	Spread        string     `json:"spread"`
+	ValidFrom     time.Time  `json:"valid_from"`
+	ValidTo       *time.Time `json:"valid_to,omitempty"`
+	CreatedBy     *uint      `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
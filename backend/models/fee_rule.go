@@ -0,0 +1,28 @@
+package models
+
+import (
+	"bank/money"
+	"time"
+)
+
+// FeeRule prices transfers whose amount lies in [MinAmount, MaxAmount]. The
+// fee is FlatFee plus Percentage (a decimal fraction such as "0.015") of the
+// amount, clamped to MinFee and MaxFee; all amounts are in Currency. A nil
+// AccountTypeID applies to every account type held in Currency; Scope is ALL,
+// INTERNAL (between one user's own accounts) or EXTERNAL (to another user).
+type FeeRule struct {
+	ID            uint          `json:"id"`
+	Name          string        `json:"name" binding:"required"`
+	AccountTypeID *uint         `json:"account_type_id,omitempty"`
+	Currency      string        `json:"currency"`
+	Scope         string        `json:"scope"`
+	MinAmount     money.Amount  `json:"min_amount"`
+	MaxAmount     *money.Amount `json:"max_amount,omitempty"`
+	FlatFee       money.Amount  `json:"flat_fee"`
+	Percentage    string        `json:"percentage"`
+	MinFee        *money.Amount `json:"min_fee,omitempty"`
+	MaxFee        *money.Amount `json:"max_fee,omitempty"`
+	IsActive      bool          `json:"is_active"`
+	CreatedBy     *uint         `json:"created_by,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers the fingerprint of a request sent with an
+// Idempotency-Key header and, once it finished, the response it produced.
+type IdempotencyKey struct {
+	ID           uint      `json:"id"`
+	UserID       uint      `json:"user_id"`
+	Key          string    `json:"idempotency_key"`
+	Endpoint     string    `json:"endpoint"`
+	RequestHash  string    `json:"request_hash"`
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `json:"response_body"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"bank/money"
+	"time"
+)
+
+// JournalEntry groups the postings of a single money movement. The postings
+// of an entry always sum to zero.
+type JournalEntry struct {
+	ID          uint      `json:"id"`
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	Postings    []Posting `json:"postings"`
+}
+
+// Posting is an immutable line of a journal entry. A positive amount credits
+// the account (its balance goes up), a negative amount debits it.
+type Posting struct {
+	ID             uint         `json:"id"`
+	JournalEntryID uint         `json:"journal_entry_id"`
+	AccountNumber  string       `json:"account_number"`
+	Amount         money.Amount `json:"amount"`
+	Currency       string       `json:"currency"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
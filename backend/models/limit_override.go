@@ -0,0 +1,20 @@
+package models
+
+import (
+	"bank/money"
+	"time"
+)
+
+// LimitOverride replaces the account type limits for one account or for all
+// accounts of one user. Exactly one of AccountNumber and UserID is set; a nil
+// limit falls through to the next level.
+type LimitOverride struct {
+	ID                  uint          `json:"id"`
+	AccountNumber       *string       `json:"account_number,omitempty"`
+	UserID              *uint         `json:"user_id,omitempty"`
+	PerTransactionLimit *money.Amount `json:"per_transaction_limit"`
+	DailyLimit          *money.Amount `json:"daily_limit"`
+	MonthlyLimit        *money.Amount `json:"monthly_limit"`
+	SetBy               *uint         `json:"set_by,omitempty"`
+	UpdatedAt           time.Time     `json:"updated_at"`
+}
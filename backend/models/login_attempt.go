@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LoginAttempt is one entry of the login history: every password check,
+// whether it succeeded, and where it came from.
+type LoginAttempt struct {
+	ID            uint      `json:"id"`
+	UserID        *uint     `json:"user_id,omitempty"`
+	Email         string    `json:"email"`
+	IPAddress     string    `json:"ip_address"`
+	UserAgent     string    `json:"user_agent"`
+	Success       bool      `json:"success"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -1,13 +1,16 @@
 package models
 
-import "time"
+import (
+	"bank/money"
+	"time"
+)
 
 type MoneyRequest struct {
 	ID          uint       `gorm:"primaryKey"`
     UserID       uint      `gorm:"uniqueIndex" json:"user_id"` // one-to-one
 	RequesterID string      `gorm:"not null" json:"requester_id"` // who is requesting the money
 	RecipientID string       `gorm:"not null" json:"recipient_id"`  // who is being asked to send money
-	Amount      float64    `gorm:"not null"`
+	Amount      money.Amount `gorm:"not null" json:"amount"`
 	Status      string     // PENDING, ACCEPTED, DECLINED, EXPIRED
 	ExpiresAt   time.Time  // auto-expiry time       // retry count
 	RequesteAt  time.Time // last retry attempt
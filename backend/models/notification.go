@@ -1,11 +1,67 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification types
+const (
+	NotificationGeneral              = "GENERAL"
+	NotificationTransferReceived     = "TRANSFER_RECEIVED"
+	NotificationTransferReversed     = "TRANSFER_REVERSED"
+	NotificationRequestReceived      = "REQUEST_RECEIVED"
+	NotificationRequestDeclined      = "REQUEST_DECLINED"
+	NotificationRequestExpired       = "REQUEST_EXPIRED"
+	NotificationCashDeposit          = "CASH_DEPOSIT"
+	NotificationCashWithdrawal       = "CASH_WITHDRAWAL"
+	NotificationInterestPaid         = "INTEREST_PAID"
+	NotificationStandingOrderFailed  = "STANDING_ORDER_FAILED"
+	NotificationStandingOrderSkipped = "STANDING_ORDER_SKIPPED"
+	NotificationSecurityAlert        = "SECURITY_ALERT"
+)
+
+// NotificationTypes lists every type users can set preferences for.
+var NotificationTypes = []string{
+	NotificationTransferReceived,
+	NotificationTransferReversed,
+	NotificationRequestReceived,
+	NotificationRequestDeclined,
+	NotificationRequestExpired,
+	NotificationCashDeposit,
+	NotificationCashWithdrawal,
+	NotificationInterestPaid,
+	NotificationStandingOrderFailed,
+	NotificationStandingOrderSkipped,
+	NotificationSecurityAlert,
+}
+
+// Channels a notification can be delivered on. In-app notifications are
+// pushed over the WebSocket; the others go through the delivery outbox.
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+)
+
+var NotificationChannels = []string{ChannelInApp, ChannelEmail, ChannelSMS, ChannelWebhook}
+
+// Events reported by SECURITY_ALERT notifications
+const (
+	SecurityPasswordChanged   = "PASSWORD_CHANGED"
+	SecurityTwoFactorEnabled  = "TWO_FACTOR_ENABLED"
+	SecurityTwoFactorDisabled = "TWO_FACTOR_DISABLED"
+	SecurityLoginLocked       = "LOGIN_LOCKED"
+)
 
 type Notification struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID      uint    `json:"user_id"`
+	Type      string     `json:"type"`
 	Message   string    `gorm:"not null" json:"message"`
+	Payload   json.RawMessage `json:"payload"`
 	IsRead    bool      `gorm:"default:false" json:"is_read"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
-}
\ No newline at end of file
+}
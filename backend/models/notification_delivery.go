@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// NotificationDelivery is a notification queued for an external channel.
+// Status is PENDING until it is sent, or FAILED once retries run out.
+type NotificationDelivery struct {
+	ID             uint       `json:"id"`
+	NotificationID uint       `json:"notification_id"`
+	Channel        string     `json:"channel"`
+	Destination    string     `json:"destination"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty"`
+}
@@ -0,0 +1,58 @@
+package models
+
+// Permission is a single capability granted to roles.
+type Permission struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Permissions checked by the API.
+const (
+	PermAccountsRead        = "accounts:read"
+	PermAccountsWrite       = "accounts:write"
+	PermAccountsReadAll     = "accounts:read_all"
+	PermAccountsManageAll   = "accounts:manage_all"
+	PermAccountTypesManage  = "account_types:manage"
+	PermTransactionsRead    = "transactions:read"
+	PermTransfersCreate     = "transfers:create"
+	PermTransactionsReverse = "transactions:reverse"
+	PermCashManage          = "cash:manage"
+	PermReportsRead         = "reports:read"
+	PermUsersManage         = "users:manage"
+	PermRolesManage         = "roles:manage"
+	PermAuditRead           = "audit:read"
+	PermFXManage            = "fx:manage"
+	PermLimitsManage        = "limits:manage"
+	PermFeesManage          = "fees:manage"
+	PermEventsManage        = "events:manage"
+)
+
+// PermissionSeed describes a permission the application knows about and
+// the built-in roles that receive it when it is first created. Later
+// changes made by admins are never overwritten.
+type PermissionSeed struct {
+	Name         string
+	Description  string
+	DefaultRoles []string
+}
+
+var PermissionSeeds = []PermissionSeed{
+	{PermAccountsRead, "View own accounts, balances, limits, interest and statements", []string{"User"}},
+	{PermAccountsWrite, "Open, update and close own accounts", []string{"User"}},
+	{PermAccountsReadAll, "View the accounts and transactions of any user", []string{"Admin"}},
+	{PermAccountsManageAll, "Act on accounts of any user", []string{"Admin"}},
+	{PermAccountTypesManage, "Create, update and delete account types", []string{"Admin"}},
+	{PermTransactionsRead, "View own transactions, money requests and notifications", []string{"User"}},
+	{PermTransfersCreate, "Send, request and refund money and manage standing orders", []string{"User"}},
+	{PermTransactionsReverse, "Reverse posted transactions", []string{"Admin"}},
+	{PermCashManage, "Post cash deposits and withdrawals", []string{"Admin"}},
+	{PermReportsRead, "View bank-wide dashboards", []string{"Admin"}},
+	{PermUsersManage, "List, activate, unlock and assign roles to users", []string{"Admin"}},
+	{PermRolesManage, "Create roles and change their permissions", []string{"Admin"}},
+	{PermAuditRead, "Read audit logs and verify the ledger", []string{"Admin"}},
+	{PermFXManage, "Publish and expire exchange rates", []string{"Admin"}},
+	{PermLimitsManage, "Override transfer limits", []string{"Admin"}},
+	{PermFeesManage, "Manage transfer fee rules", []string{"Admin"}},
+	{PermEventsManage, "Manage external domain event subscriptions", []string{"Admin"}},
+}
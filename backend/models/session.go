@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is one login. Its refresh tokens rotate on every use and all of
+// them belong to the session, so revoking it ends the whole token family
+// and invalidates the access tokens issued for it.
+type Session struct {
+	ID            uint       `json:"id"`
+	UserID        uint       `json:"user_id"`
+	UserAgent     string     `json:"user_agent"`
+	IPAddress     string     `json:"ip_address"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUsedAt    time.Time  `json:"last_used_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	RevokedReason string     `json:"revoked_reason,omitempty"`
+}
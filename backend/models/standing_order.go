@@ -0,0 +1,29 @@
+package models
+
+import (
+	"bank/money"
+	"time"
+)
+
+// StandingOrder is a transfer a user scheduled ahead of time, either once
+// (ONCE) or repeatedly (DAILY, WEEKLY, MONTHLY) until EndDate or MaxRuns.
+type StandingOrder struct {
+	ID            uint         `json:"id"`
+	UserID        uint         `json:"user_id"`
+	FromAccountID string       `json:"from_account_id" binding:"required"`
+	ToAccountID   string       `json:"to_account_id" binding:"required"`
+	Amount        money.Amount `json:"amount" binding:"required"`
+	Description   string       `json:"description"`
+	Frequency     string       `json:"frequency" binding:"required"` // ONCE, DAILY, WEEKLY, MONTHLY
+	StartAt       time.Time    `json:"start_at"`
+	EndDate       *time.Time   `json:"end_date,omitempty"`
+	MaxRuns       *int         `json:"max_runs,omitempty"`
+	Occurrences   int          `json:"occurrences"` // runs executed or given up on so far
+	NextRunAt     time.Time    `json:"next_run_at"`
+	RetryAt       *time.Time   `json:"retry_at,omitempty"`
+	RetryCount    int          `json:"retry_count"`
+	Status        string       `json:"status"` // ACTIVE, PAUSED, CANCELLED, COMPLETED, FAILED
+	LastRunAt     *time.Time   `json:"last_run_at,omitempty"`
+	LastError     *string      `json:"last_error,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
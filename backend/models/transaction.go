@@ -1,14 +1,35 @@
 package models
 
-import "time"
+import (
+	"bank/money"
+	"time"
+)
 
 type Transaction struct {
 	ID              uint      `gorm:"primaryKey" json:"id"`
 	UserID          uint       `json:"user_id"`  // Foreign Key to Users
 	AccountID       string      `json:"account_id"`
-	TransactionType string    `gorm:"type:varchar(20);not null" json:"transaction_type"` 
-	ToAccountID     *string  `json:"to_account_id,omitempty"`  // Destination account (only for TRANSFER) // DEPOSIT, WITHDRAW, TRANSFER
-	Amount          float64   `gorm:"type:decimal(15,2);not null" json:"amount"`
+	TransactionType string    `gorm:"type:varchar(20);not null" json:"transaction_type"` // DEBIT, CREDIT, DEPOSIT, WITHDRAWAL, REVERSAL, REFUND, FEE, INTEREST
+	ToAccountID     *string  `json:"to_account_id,omitempty"`  // Destination account (only for DEBIT/CREDIT)
+	Amount          money.Amount `gorm:"type:decimal(15,2);not null" json:"amount"`
 	TransactionDate time.Time `gorm:"autoCreateTime" json:"transaction_date"`
 	Description     string    `json:"description"`
+	Currency        string    `json:"currency,omitempty"`
+
+	// Set on transfers between accounts of different currencies
+	CounterAmount   *money.Amount `json:"counter_amount,omitempty"`
+	CounterCurrency *string       `json:"counter_currency,omitempty"`
+	FXRate          *string       `json:"fx_rate,omitempty"`
+	FXSpread        *money.Amount `json:"fx_spread,omitempty"`
+	ExchangeRateID  *uint         `json:"exchange_rate_id,omitempty"` // rate from a quote the client wants to lock in
+
+	// REVERSAL and REFUND rows point at the DEBIT row they compensate;
+	// that row tracks how much of it has been given back so far
+	ReversalOfID   *uint        `json:"reversal_of_id,omitempty"`
+	ReversedAmount money.Amount `json:"reversed_amount"`
+
+	// FEE rows point at the DEBIT row of the transfer they were charged on.
+	// Fee is only filled in on the transfer returned to the client.
+	FeeOfID *uint         `json:"fee_of_id,omitempty"`
+	Fee     *money.Amount `json:"fee,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,262 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places stored for every amount. It matches
+// the DECIMAL(15,2) columns used throughout the schema.
+const Scale = 2
+
+const unit = 100 // 10^Scale
+
+var (
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrTooPrecise       = fmt.Errorf("amount has more than %d decimal places", Scale)
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Amount is an exact monetary amount held in minor units (cents). It scans
+// from NUMERIC/DECIMAL columns, is written to the database as a decimal
+// string and is encoded in JSON as a string such as "12.50".
+type Amount int64
+
+// Zero is the zero amount.
+const Zero Amount = 0
+
+// FromMinor builds an amount from minor units.
+func FromMinor(minor int64) Amount {
+	return Amount(minor)
+}
+
+// Parse reads a decimal string such as "12", "12.5" or "-0.05". It rejects
+// values with more than Scale decimal places.
+func Parse(s string) (Amount, error) {
+	return parse(s, false)
+}
+
+// parse converts a plain decimal string to minor units. When round is set,
+// extra decimal places are rounded half away from zero instead of rejected.
+func parse(s string, round bool) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || !isDigits(frac) || len(whole) > 16 {
+		return 0, ErrInvalidAmount
+	}
+
+	roundUp := false
+	if len(frac) > Scale {
+		if !round {
+			if strings.Trim(frac[Scale:], "0") != "" {
+				return 0, ErrTooPrecise
+			}
+		} else {
+			roundUp = frac[Scale] >= '5'
+		}
+		frac = frac[:Scale]
+	}
+	frac += strings.Repeat("0", Scale-len(frac))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	cents, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+
+	minor := units*unit + cents
+	if roundUp {
+		minor++
+	}
+	if negative {
+		minor = -minor
+	}
+	return Amount(minor), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Minor returns the amount in minor units.
+func (a Amount) Minor() int64 { return int64(a) }
+
+func (a Amount) Add(b Amount) Amount { return a + b }
+func (a Amount) Sub(b Amount) Amount { return a - b }
+func (a Amount) Neg() Amount         { return -a }
+
+func (a Amount) IsZero() bool     { return a == 0 }
+func (a Amount) IsPositive() bool { return a > 0 }
+func (a Amount) IsNegative() bool { return a < 0 }
+
+// Cmp returns -1, 0 or +1 depending on whether a is less than, equal to or
+// greater than b.
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Rat returns the amount in major units as an exact rational.
+func (a Amount) Rat() *big.Rat {
+	return big.NewRat(int64(a), unit)
+}
+
+// FromRat rounds an exact rational in major units to the nearest minor unit,
+// halves away from zero.
+func FromRat(r *big.Rat) Amount {
+	scaled := new(big.Rat).Mul(r, big.NewRat(unit, 1))
+	num, den := scaled.Num(), scaled.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	// |rem| * 2 >= den means round away from zero
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return Amount(quo.Int64())
+}
+
+// MulRat multiplies the amount by r and rounds to the nearest minor unit.
+func (a Amount) MulRat(r *big.Rat) Amount {
+	return FromRat(new(big.Rat).Mul(a.Rat(), r))
+}
+
+// String formats the amount with exactly Scale decimals, e.g. "-12.05".
+func (a Amount) String() string {
+	minor := int64(a)
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/unit, minor%unit)
+}
+
+// Value implements driver.Valuer. The decimal string keeps NUMERIC columns exact.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan implements sql.Scanner for NUMERIC, DECIMAL and integer columns.
+func (a *Amount) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case []byte:
+		*a, err = parse(string(v), true)
+	case string:
+		*a, err = parse(v, true)
+	case int64:
+		*a = Amount(v * unit)
+	case float64:
+		*a, err = parse(strconv.FormatFloat(v, 'f', -1, 64), true)
+	default:
+		err = fmt.Errorf("cannot scan %T into money.Amount", src)
+	}
+	return err
+}
+
+// MarshalJSON encodes the amount as a JSON string.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON accepts both "12.50" and 12.50. Numbers are read from their
+// textual form, never through float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Money is an amount tagged with its ISO currency code. Arithmetic between
+// different currencies is refused.
+type Money struct {
+	Amount   Amount `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// New builds a Money value.
+func New(amount Amount, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}, nil
+}
+
+// Cmp compares two amounts of the same currency.
+func (m Money) Cmp(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	return m.Amount.Cmp(o.Amount), nil
+}
+
+// String formats the value as "12.50 USD".
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Amount.String()
+	}
+	return m.Amount.String() + " " + m.Currency
+}
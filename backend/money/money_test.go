@@ -0,0 +1,181 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{"12", 1200, nil},
+		{"12.5", 1250, nil},
+		{"12.50", 1250, nil},
+		{"0.05", 5, nil},
+		{".05", 5, nil},
+		{"1.", 100, nil},
+		{"+3.10", 310, nil},
+		{"-0.05", -5, nil},
+		{"-12.34", -1234, nil},
+		{" 7.00 ", 700, nil},
+		{"1.2300", 123, nil},
+		{"9999999999999999.99", 999999999999999999, nil},
+		{"1.234", 0, ErrTooPrecise},
+		{"0.001", 0, ErrTooPrecise},
+		{"", 0, ErrInvalidAmount},
+		{"-", 0, ErrInvalidAmount},
+		{".", 0, ErrInvalidAmount},
+		{"abc", 0, ErrInvalidAmount},
+		{"1,00", 0, ErrInvalidAmount},
+		{"1e3", 0, ErrInvalidAmount},
+		{"--1", 0, ErrInvalidAmount},
+		{"12345678901234567", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		minor int64
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1250, "12.50"},
+		{-1234, "-12.34"},
+		{100000001, "1000000.01"},
+	}
+	for _, tt := range tests {
+		a := FromMinor(tt.minor)
+		if got := a.String(); got != tt.want {
+			t.Errorf("FromMinor(%d).String() = %q, want %q", tt.minor, got, tt.want)
+		}
+		back, err := Parse(a.String())
+		if err != nil || back != a {
+			t.Errorf("Parse(%q) = %d, %v; want %d", a.String(), back, err, a)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src     interface{}
+		want    Amount
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{[]byte("12.34"), 1234, false},
+		{"12.34", 1234, false},
+		{"-0.50", -50, false},
+		{int64(7), 700, false},
+		{float64(1.25), 125, false},
+		// NUMERIC with more places than we keep rounds half away from zero
+		{"0.005", 1, false},
+		{"-0.005", -1, false},
+		{"0.0049", 0, false},
+		{"2.675", 268, false},
+		{"not a number", 0, true},
+		{[]byte(""), 0, true},
+		{true, 0, true},
+	}
+	for _, tt := range tests {
+		a := Amount(999)
+		err := a.Scan(tt.src)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Scan(%#v) error = %v, wantErr %v", tt.src, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && a != tt.want {
+			t.Errorf("Scan(%#v) = %d, want %d", tt.src, a, tt.want)
+		}
+	}
+}
+
+func TestFromRatRoundsHalfAwayFromZero(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		want     Amount
+	}{
+		{1, 200, 1},   // 0.005
+		{-1, 200, -1}, // -0.005
+		{1, 201, 0},   // just under half a cent
+		{1, 3, 33},
+		{2, 3, 67},
+		{-2, 3, -67},
+		{5, 1, 500},
+	}
+	for _, tt := range tests {
+		if got := FromRat(big.NewRat(tt.num, tt.den)); got != tt.want {
+			t.Errorf("FromRat(%d/%d) = %d, want %d", tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(FromMinor(-1205))
+	if err != nil || string(data) != `"-12.05"` {
+		t.Fatalf("Marshal = %s, %v; want \"-12.05\"", data, err)
+	}
+
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{`"12.50"`, 1250, false},
+		{`12.50`, 1250, false},
+		{`"-0.01"`, -1, false},
+		{`0.1`, 10, false},
+		{`"1.005"`, 0, true},
+		{`"abc"`, 0, true},
+	}
+	for _, tt := range tests {
+		var a Amount
+		err := json.Unmarshal([]byte(tt.in), &a)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && a != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, a, tt.want)
+		}
+	}
+
+	a := Amount(42)
+	if err := json.Unmarshal([]byte("null"), &a); err != nil || a != 42 {
+		t.Errorf("Unmarshal(null) = %d, %v; want amount left alone", a, err)
+	}
+}
+
+func TestMoneyCurrencyMismatch(t *testing.T) {
+	usd := New(100, "usd")
+	eur := New(100, "EUR")
+	if usd.Currency != "USD" {
+		t.Errorf("New did not upper-case the currency: %q", usd.Currency)
+	}
+	if _, err := usd.Add(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies: error = %v", err)
+	}
+	if _, err := usd.Sub(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub across currencies: error = %v", err)
+	}
+	sum, err := usd.Add(New(50, "USD"))
+	if err != nil || sum.String() != "1.50 USD" {
+		t.Errorf("Add = %v, %v; want 1.50 USD", sum, err)
+	}
+}
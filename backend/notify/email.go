@@ -0,0 +1,12 @@
+package notify
+
+import "bank/mail"
+
+// MailEmailSender sends through the mail package, so email notifications
+// use the same driver as every other email (MAIL_DRIVER=file for local
+// files).
+type MailEmailSender struct{}
+
+func (MailEmailSender) SendEmail(to, subject, body string) error {
+	return mail.Send(mail.Message{To: to, Subject: subject, Body: body})
+}
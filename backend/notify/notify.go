@@ -0,0 +1,110 @@
+// Package notify delivers notifications outside the app: by email, SMS and
+// webhook. Each channel has a sender interface and the senders are chosen at
+// startup from the environment, with local adapters that write to files so
+// development setups need no providers.
+package notify
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// EmailSender delivers an email to one address.
+type EmailSender interface {
+	SendEmail(to, subject, body string) error
+}
+
+// SMSSender delivers a text message to one phone number.
+type SMSSender interface {
+	SendSMS(to, body string) error
+}
+
+// WebhookSender posts a JSON body to a user's endpoint. secret signs the
+// body so the receiver can check it came from us.
+type WebhookSender interface {
+	PostWebhook(url, secret string, body []byte) error
+}
+
+// webhookTimeout bounds one webhook call, connecting included.
+const webhookTimeout = 10 * time.Second
+
+var (
+	mu      sync.RWMutex
+	email   EmailSender   = MailEmailSender{}
+	sms     SMSSender     = LogSMSSender{}
+	webhook WebhookSender = NewHTTPWebhookSender(webhookTimeout, false)
+)
+
+// Init picks the senders from the environment:
+//
+//	email               always through the mail package, configured by MAIL_DRIVER
+//	SMS_DRIVER=file     FileSMSSender writing to SMS_DIR (default ./sms-out)
+//	SMS_DRIVER=log      LogSMSSender (default)
+//	WEBHOOK_DRIVER=file FileWebhookSender writing to WEBHOOK_DIR (default ./webhook-out)
+//	WEBHOOK_DRIVER=http HTTPWebhookSender (default); WEBHOOK_ALLOW_PRIVATE=true lets it reach internal addresses
+func Init() {
+	var s SMSSender = LogSMSSender{}
+	if os.Getenv("SMS_DRIVER") == "file" {
+		s = FileSMSSender{Dir: envOr("SMS_DIR", "sms-out")}
+	}
+
+	var w WebhookSender = NewHTTPWebhookSender(webhookTimeout, os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true")
+	if os.Getenv("WEBHOOK_DRIVER") == "file" {
+		w = FileWebhookSender{Dir: envOr("WEBHOOK_DIR", "webhook-out")}
+	}
+
+	mu.Lock()
+	sms, webhook = s, w
+	mu.Unlock()
+	log.Printf("Notification senders: SMS %T, webhook %T", s, w)
+}
+
+// SetEmailSender, SetSMSSender and SetWebhookSender replace a channel's
+// sender.
+func SetEmailSender(s EmailSender) {
+	mu.Lock()
+	defer mu.Unlock()
+	email = s
+}
+
+func SetSMSSender(s SMSSender) {
+	mu.Lock()
+	defer mu.Unlock()
+	sms = s
+}
+
+func SetWebhookSender(s WebhookSender) {
+	mu.Lock()
+	defer mu.Unlock()
+	webhook = s
+}
+
+func Email(to, subject, body string) error {
+	mu.RLock()
+	s := email
+	mu.RUnlock()
+	return s.SendEmail(to, subject, body)
+}
+
+func SMS(to, body string) error {
+	mu.RLock()
+	s := sms
+	mu.RUnlock()
+	return s.SendSMS(to, body)
+}
+
+func Webhook(url, secret string, body []byte) error {
+	mu.RLock()
+	s := webhook
+	mu.RUnlock()
+	return s.PostWebhook(url, secret, body)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,34 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogSMSSender writes text messages to the application log.
+type LogSMSSender struct{}
+
+func (LogSMSSender) SendSMS(to, body string) error {
+	log.Printf("SMS to %s: %s", to, body)
+	return nil
+}
+
+// FileSMSSender writes each text message to its own file in Dir.
+type FileSMSSender struct {
+	Dir string
+}
+
+func (s FileSMSSender) SendSMS(to, body string) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("+", "", " ", "", "/", "_", string(filepath.Separator), "_").Replace(to)
+	name := fmt.Sprintf("%s-%s.txt", time.Now().Format("20060102T150405.000000000"), recipient)
+	content := fmt.Sprintf("To: %s\n\n%s\n", to, body)
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(content), 0o600)
+}
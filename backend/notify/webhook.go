@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with the webhook secret; TimestampHeader carries the Unix timestamp.
+const (
+	SignatureHeader = "X-Bank-Signature"
+	TimestampHeader = "X-Bank-Timestamp"
+)
+
+// Sign returns the signature of body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HTTPWebhookSender POSTs to the endpoint; any non-2xx answer is a failure.
+// Endpoints are chosen by users, so unless allowPrivate is set it refuses
+// to connect to loopback, private and link-local addresses.
+type HTTPWebhookSender struct {
+	client *http.Client
+}
+
+// errPrivateAddress is returned when an endpoint resolves to an internal
+// address.
+var errPrivateAddress = errors.New("webhook endpoint resolves to a private address")
+
+// NewHTTPWebhookSender builds the sender and the client it shares between
+// calls, so connections to an endpoint are reused.
+func NewHTTPWebhookSender(timeout time.Duration, allowPrivate bool) *HTTPWebhookSender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// Checked on the resolved address so DNS cannot point around it
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	return &HTTPWebhookSender{client: &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// A redirect could lead anywhere; treat it as a failed delivery
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+func (s *HTTPWebhookSender) PostWebhook(url, secret string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// FileWebhookSender writes each call to its own file in Dir instead of
+// posting it.
+type FileWebhookSender struct {
+	Dir string
+}
+
+func (s FileWebhookSender) PostWebhook(url, secret string, body []byte) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	name := fmt.Sprintf("%s.http", time.Now().Format("20060102T150405.000000000"))
+	content := fmt.Sprintf("POST %s\n%s: %d\n%s: %s\n\n%s\n", url, TimestampHeader, timestamp, SignatureHeader, Sign(secret, timestamp, body), body)
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(content), 0o600)
+}
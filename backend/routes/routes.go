@@ -3,7 +3,7 @@ package routes
 import (
 	"bank/controllers"
 	"bank/middlewares"
-	"bank/websocket"
+	"bank/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,59 +11,117 @@ import (
 func AuthRoutes(r *gin.Engine) {
 	r.POST("/register", controllers.Register)
 	r.POST("/login", controllers.Login)
-    r.GET("/ws", websocket.WebSocketHandler)
+	r.POST("/login/2fa", controllers.LoginTOTP)
+	r.POST("/token/refresh", controllers.RefreshToken)
+	r.POST("/password/forgot", controllers.ForgotPassword)
+	r.POST("/password/reset", controllers.ResetForgottenPassword)
+	r.GET("/ws", controllers.NotificationSocket)
+	r.GET("/.well-known/jwks.json", controllers.JWKS)
 	api := r.Group("/api")
 	api.Use(middlewares.JWTAuthMiddleware()) // Only authenticated
 
+	// Every route below names the permission it needs
+	can := middlewares.RequirePermission
+
 	{
+		api.POST("/logout", controllers.Logout)
+		api.GET("/login-history", controllers.GetLoginHistory)
+		api.GET("/2fa", controllers.GetTOTPStatus)
+		api.POST("/2fa/enroll", controllers.BeginTOTPEnrollment)
+		api.POST("/2fa/confirm", controllers.ConfirmTOTPEnrollment)
+		api.POST("/2fa/disable", controllers.DisableTOTP)
+		api.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+		api.GET("/notification-preferences", controllers.GetNotificationPreferences)
+		api.PUT("/notification-preferences", controllers.UpdateNotificationPreferences)
+		api.PUT("/notification-preferences/webhook", controllers.SetNotificationWebhook)
+		api.DELETE("/notification-preferences/webhook", controllers.DeleteNotificationWebhook)
 
 		user := api.Group("/user")
-		user.Use(middlewares.RoleMiddleware("User"))
 		{
- 
+
 			user.POST("/password-reset", controllers.ResetPassword)
-			user.POST("/accounts", controllers.CreateAccount)
-			user.PUT("/accounts/:id", controllers.UpdateAccount)
-			user.GET("/accounts", controllers.GetAllAccounts)
-			user.GET("/accounts/:id", controllers.GetAccountByID)
-			user.GET("/account-blance/:id", controllers.GetAccountsBalance)
-			user.DELETE("/accounts/:id", controllers.DeleteAccount)
-			
-			user.POST("/account-types", controllers.CreateAccountType)
-			user.GET("/account-types", controllers.GetAllAccountTypes)
-			user.GET("/account-types/:id", controllers.GetAccountTypeByID)
-			user.PUT("/account-types/:id", controllers.UpdateAccountType)
-			user.DELETE("/account-types/:id", controllers.DeleteAccountType)
-			
-         	user.POST("/money-transer", controllers.MoneyTransfer)
-			user.GET("/transactions/money-request", controllers.GetMoneyRequestsByUserID)
-			user.GET("/transactions/history", controllers.GetTransactionHistoryHandler)
-			user.POST("/money-request", controllers.MoneyRequest)
-			user.PUT("/accept-money-request/:id", controllers.AcceptMoneyRequest)
-			user.PUT("/decline-money-request/:id", controllers.DeclineMoneyRequest)
-			user.GET("/notifications",controllers.GetFilteredNotifications)
-			user.GET("/dashboard/transactions-summary", controllers.GetDashboard)
-			user.GET("/dashboard/monthly-transactions", controllers.GetMonthlyTransactionVolume)
-			user.GET("/account-details", controllers.GetAccountDetails)
+			user.POST("/accounts", can(models.PermAccountsWrite), controllers.CreateAccount)
+			user.PUT("/accounts/:id", can(models.PermAccountsWrite), controllers.UpdateAccount)
+			user.GET("/accounts", can(models.PermAccountsRead), controllers.GetAllAccounts)
+			user.GET("/accounts/:id", can(models.PermAccountsRead), controllers.GetAccountByID)
+			user.GET("/account-blance/:id", can(models.PermAccountsRead), controllers.GetAccountsBalance)
+			user.DELETE("/accounts/:id", can(models.PermAccountsWrite), controllers.DeleteAccount)
+
+			user.POST("/account-types", can(models.PermAccountTypesManage), controllers.CreateAccountType)
+			user.GET("/account-types", can(models.PermAccountsRead), controllers.GetAllAccountTypes)
+			user.GET("/account-types/:id", can(models.PermAccountsRead), controllers.GetAccountTypeByID)
+			user.PUT("/account-types/:id", can(models.PermAccountTypesManage), controllers.UpdateAccountType)
+			user.DELETE("/account-types/:id", can(models.PermAccountTypesManage), controllers.DeleteAccountType)
 
+			user.POST("/money-transer", can(models.PermTransfersCreate), controllers.MoneyTransfer)
+			user.GET("/transactions/money-request", can(models.PermTransactionsRead), controllers.GetMoneyRequestsByUserID)
+			user.GET("/transactions/history", can(models.PermTransactionsRead), controllers.GetTransactionHistoryHandler)
+			user.POST("/money-request", can(models.PermTransfersCreate), controllers.MoneyRequest)
+			user.PUT("/accept-money-request/:id", can(models.PermTransfersCreate), controllers.AcceptMoneyRequest)
+			user.PUT("/decline-money-request/:id", can(models.PermTransfersCreate), controllers.DeclineMoneyRequest)
+			user.POST("/transactions/:id/refund", can(models.PermTransfersCreate), controllers.RefundTransaction)
+			user.POST("/standing-orders", can(models.PermTransfersCreate), controllers.CreateStandingOrder)
+			user.GET("/standing-orders", can(models.PermTransactionsRead), controllers.GetStandingOrders)
+			user.PUT("/standing-orders/:id/pause", can(models.PermTransfersCreate), controllers.PauseStandingOrder)
+			user.PUT("/standing-orders/:id/resume", can(models.PermTransfersCreate), controllers.ResumeStandingOrder)
+			user.PUT("/standing-orders/:id/cancel", can(models.PermTransfersCreate), controllers.CancelStandingOrder)
+			user.GET("/notifications", can(models.PermTransactionsRead), controllers.GetFilteredNotifications)
+			user.GET("/notifications/unread-count", can(models.PermTransactionsRead), controllers.GetUnreadNotificationCount)
+			user.PUT("/notifications/read-all", can(models.PermTransactionsRead), controllers.MarkAllNotificationsRead)
+			user.PUT("/notifications/:id/read", can(models.PermTransactionsRead), controllers.MarkNotificationRead)
+			user.DELETE("/notifications/:id", can(models.PermTransactionsRead), controllers.DeleteNotification)
+			user.GET("/dashboard/transactions-summary", can(models.PermTransactionsRead), controllers.GetDashboard)
+			user.GET("/dashboard/monthly-transactions", can(models.PermTransactionsRead), controllers.GetMonthlyTransactionVolume)
+			user.GET("/account-details", can(models.PermAccountsRead), controllers.GetAccountDetails)
+			user.GET("/exchange-rates", can(models.PermAccountsRead), controllers.GetExchangeRates)
+			user.GET("/fx/quote", can(models.PermAccountsRead), controllers.GetFXQuote)
+			user.GET("/limits", can(models.PermAccountsRead), controllers.GetAccountLimits)
+			user.GET("/transfers/quote", can(models.PermTransfersCreate), controllers.QuoteTransfer)
+			user.GET("/interest", can(models.PermAccountsRead), controllers.GetAccruedInterest)
+			user.GET("/statement", can(models.PermAccountsRead), controllers.GetAccountStatement)
 
 		}
 
 		admin := api.Group("/admin")
-		admin.Use(middlewares.RoleMiddleware("Admin"))
 		{
 
-			admin.GET("/transactions/history", controllers.GetTransactionHistoryHandler)
-			admin.GET("/accounts", controllers.GetAllAccounts)
-			admin.GET("/admindashboard/monthly-transactions", controllers.GetMonthlyTransaction)
-			admin.GET("/admindashboard/transactions-summary", controllers.GetAdminDashboard)
-			admin.POST("/assign-roles", controllers.AssignRoles)
-			admin.PUT("/users/:id/status", controllers.ActivateDeactivateUser)
-			admin.POST("/create-role", controllers.CreateRole)
-			admin.GET("/users", controllers.GetUserList)
-			admin.GET("/audit-logs", controllers.GetAuditLogs)
+			admin.GET("/transactions/history", can(models.PermAccountsReadAll), controllers.GetTransactionHistoryHandler)
+			admin.POST("/transactions/:id/reverse", can(models.PermTransactionsReverse), controllers.ReverseTransaction)
+			admin.GET("/accounts", can(models.PermAccountsReadAll), controllers.GetAllAccounts)
+			admin.PUT("/accounts/:id/type", can(models.PermAccountsManageAll), controllers.ChangeAccountType)
+			admin.POST("/accounts/deposit", can(models.PermCashManage), controllers.Deposit)
+			admin.POST("/accounts/withdraw", can(models.PermCashManage), controllers.Withdraw)
+			admin.GET("/admindashboard/monthly-transactions", can(models.PermReportsRead), controllers.GetMonthlyTransaction)
+			admin.GET("/admindashboard/transactions-summary", can(models.PermReportsRead), controllers.GetAdminDashboard)
+			admin.POST("/assign-roles", can(models.PermUsersManage), controllers.AssignRoles)
+			admin.PUT("/users/:id/status", can(models.PermUsersManage), controllers.ActivateDeactivateUser)
+			admin.POST("/create-role", can(models.PermRolesManage), controllers.CreateRole)
+			admin.GET("/roles", can(models.PermRolesManage), controllers.GetRoles)
+			admin.PUT("/roles/:id/permissions", can(models.PermRolesManage), controllers.SetRolePermissions)
+			admin.GET("/permissions", can(models.PermRolesManage), controllers.GetPermissions)
+			admin.GET("/users", can(models.PermUsersManage), controllers.GetUserList)
+			admin.DELETE("/users/:id/2fa", can(models.PermUsersManage), controllers.ResetUserTOTP)
+			admin.POST("/users/:id/unlock", can(models.PermUsersManage), controllers.UnlockUserLogin)
+			admin.GET("/users/:id/login-history", can(models.PermUsersManage), controllers.GetUserLoginHistory)
+			admin.GET("/audit-logs", can(models.PermAuditRead), controllers.GetAuditLogs)
+			admin.GET("/ledger/verify", can(models.PermAuditRead), controllers.VerifyLedger)
+			admin.GET("/ledger/accounts/:account_number/postings", can(models.PermAuditRead), controllers.GetAccountPostings)
+			admin.POST("/exchange-rates", can(models.PermFXManage), controllers.PublishExchangeRate)
+			admin.GET("/exchange-rates", can(models.PermFXManage), controllers.GetExchangeRates)
+			admin.PUT("/exchange-rates/:id/expire", can(models.PermFXManage), controllers.ExpireExchangeRate)
+			admin.PUT("/limits/accounts/:account_number", can(models.PermLimitsManage), controllers.SetAccountLimitOverride)
+			admin.DELETE("/limits/accounts/:account_number", can(models.PermLimitsManage), controllers.DeleteAccountLimitOverride)
+			admin.PUT("/limits/users/:id", can(models.PermLimitsManage), controllers.SetUserLimitOverride)
+			admin.DELETE("/limits/users/:id", can(models.PermLimitsManage), controllers.DeleteUserLimitOverride)
+			admin.POST("/fee-rules", can(models.PermFeesManage), controllers.CreateFeeRule)
+			admin.GET("/fee-rules", can(models.PermFeesManage), controllers.GetFeeRules)
+			admin.PUT("/fee-rules/:id", can(models.PermFeesManage), controllers.UpdateFeeRule)
+			admin.DELETE("/fee-rules/:id", can(models.PermFeesManage), controllers.DeleteFeeRule)
+			admin.POST("/event-subscriptions", can(models.PermEventsManage), controllers.CreateEventSubscription)
+			admin.GET("/event-subscriptions", can(models.PermEventsManage), controllers.GetEventSubscriptions)
+			admin.DELETE("/event-subscriptions/:id", can(models.PermEventsManage), controllers.DeleteEventSubscription)
+			admin.GET("/statement", can(models.PermAccountsReadAll), controllers.GetAnyAccountStatement)
 
-			
 		}
 	}
 
@@ -4,6 +4,8 @@ import (
 	"bank/db"
 	"bank/dtos"
 	"bank/models"
+	"bank/money"
+	"database/sql"
 	"errors"
 
 	"github.com/lib/pq"
@@ -11,9 +13,16 @@ import (
 
 
 func CreateAccount(acc *models.Account) error {
+	// Accounts always start at zero; money only enters through a deposit
+	dbtx, err := db.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
 	query := `INSERT INTO accounts (account_number, balance, user_id, account_type_id, created_at)
-	          VALUES ($1, $2, $3, $4, NOW()) RETURNING id`
-	err := db.GetDB().QueryRow(query, acc.AccountNumber, acc.Balance, acc.UserID, acc.AccountTypeID).
+	          VALUES ($1, 0, $2, $3, NOW()) RETURNING id`
+	err = dbtx.QueryRow(query, acc.AccountNumber, acc.UserID, acc.AccountTypeID).
 		Scan(&acc.ID)
 	if err != nil {
 		// Check for PostgreSQL unique constraint violation
@@ -26,15 +35,58 @@ func CreateAccount(acc *models.Account) error {
 		return err
 	}
 
-	// Log audit for create
-	_ = LogAudit(&acc.UserID, "CREATE", "accounts", acc.ID, "Account created")
+	err = recordEvent(dbtx, models.EventAccountCreated, "account", acc.ID, &acc.UserID, map[string]interface{}{
+		"account_id":      acc.ID,
+		"account_number":  acc.AccountNumber,
+		"user_id":         acc.UserID,
+		"account_type_id": acc.AccountTypeID,
+	})
+	if err != nil {
+		return err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	acc.Balance = money.Zero
 	return nil
 }
 
 
+var (
+	ErrAccountNotFound = errors.New("account not found")
+	ErrForbidden       = errors.New("you are not allowed to act on this resource")
+)
+
+// AuthorizeAccount fails with ErrAccountNotFound when the account does not
+// exist and with ErrForbidden when it belongs to someone other than userID.
+func AuthorizeAccount(accountNumber string, userID uint) error {
+	return authorizeAccountOwner(`account_number = $1`, accountNumber, userID)
+}
+
+// AuthorizeAccountID is AuthorizeAccount for an account's numeric ID.
+func AuthorizeAccountID(id uint, userID uint) error {
+	return authorizeAccountOwner(`id = $1`, id, userID)
+}
+
+func authorizeAccountOwner(where string, key interface{}, userID uint) error {
+	var owner uint
+	err := db.DB.QueryRow(`SELECT user_id FROM accounts WHERE `+where, key).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return ErrForbidden
+	}
+	return nil
+}
+
 // Get balance for a specific account by account ID
-func GetAccountBalance(id string) (float64, error) {
-	var balance float64
+func GetAccountBalance(id string) (money.Amount, error) {
+	var balance money.Amount
 	query := `SELECT balance FROM accounts WHERE account_number = $1`
 	err := db.GetDB().QueryRow(query, id).Scan(&balance)
 	if err != nil {
@@ -115,41 +167,148 @@ func GetAccountsByUserID(userID uint) ([]dtos.AccountResponse, error) {
 
 
 
-// Update an account
+// Update an account. Only the owner can change here: the balance moves
+// through ledger postings, postings are keyed by the account number, and
+// the account type fixes the currency (see ChangeAccountType).
 func UpdateAccount(id uint, updated *models.Account) error {
-	query := `UPDATE accounts 
-	          SET account_number = $1, balance = $2, user_id = $3, account_type_id = $4
-	          WHERE id = $5`
-	result, err := db.GetDB().Exec(query, updated.AccountNumber, updated.Balance, updated.UserID, updated.AccountTypeID, id)
+	dbtx, err := db.GetDB().Begin()
 	if err != nil {
 		return err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	defer dbtx.Rollback()
+
+	query := `UPDATE accounts 
+	          SET user_id = $1
+	          WHERE id = $2
+	          RETURNING account_number, account_type_id`
+	err = dbtx.QueryRow(query, updated.UserID, id).Scan(&updated.AccountNumber, &updated.AccountTypeID)
+	if err == sql.ErrNoRows {
 		return errors.New("no record updated")
 	}
+	if err != nil {
+		return err
+	}
 
-	// Log audit for update
-	_ = LogAudit(&updated.UserID, "UPDATE", "accounts", id, "Account updated")
-	return nil
+	err = recordEvent(dbtx, models.EventAccountUpdated, "account", id, &updated.UserID, map[string]interface{}{
+		"account_id":      id,
+		"account_number":  updated.AccountNumber,
+		"user_id":         updated.UserID,
+		"account_type_id": updated.AccountTypeID,
+	})
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
 }
 
+var ErrAccountTypeCurrency = errors.New("an account can only move to a type in another currency while it holds no money")
 
-// Delete an account
+// ChangeAccountType moves an account to another type. Nothing is
+// converted, so a type in another currency is only allowed while the
+// account has no balance and no unpaid interest.
+func ChangeAccountType(id, accountTypeID, adminID uint) error {
+	dbtx, err := db.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	var acc models.Account
+	err = dbtx.QueryRow(`SELECT a.account_number, a.balance, a.user_id, at.currency
+	                     FROM accounts a JOIN account_types at ON at.id = a.account_type_id
+	                     WHERE a.id = $1 FOR UPDATE OF a`, id).
+		Scan(&acc.AccountNumber, &acc.Balance, &acc.UserID, &acc.AccountType.Currency)
+	if err == sql.ErrNoRows {
+		return ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var currency string
+	err = dbtx.QueryRow(`SELECT currency FROM account_types WHERE id = $1`, accountTypeID).Scan(&currency)
+	if err == sql.ErrNoRows {
+		return errors.New("account type not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if currency != acc.AccountType.Currency {
+		if !acc.Balance.IsZero() {
+			return ErrAccountTypeCurrency
+		}
+		unpaid, err := unpaidInterest(dbtx, acc.AccountNumber)
+		if err != nil {
+			return err
+		}
+		if unpaid.Sign() != 0 {
+			return ErrAccountTypeCurrency
+		}
+	}
+
+	if _, err := dbtx.Exec(`UPDATE accounts SET account_type_id = $1 WHERE id = $2`, accountTypeID, id); err != nil {
+		return err
+	}
+	err = recordEvent(dbtx, models.EventAccountUpdated, "account", id, &adminID, map[string]interface{}{
+		"account_id":      id,
+		"account_number":  acc.AccountNumber,
+		"user_id":         acc.UserID,
+		"account_type_id": accountTypeID,
+	})
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+
+var ErrAccountInUse = errors.New("an account with a balance or ledger history cannot be deleted")
+
+// Delete an account that never held money. Once it has postings it stays,
+// or the ledger would no longer add up.
 func DeleteAccount(id uint) error {
-	query := `DELETE FROM accounts WHERE id = $1`
-	result, err := db.GetDB().Exec(query, id)
+	dbtx, err := db.GetDB().Begin()
 	if err != nil {
 		return err
 	}
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	defer dbtx.Rollback()
+
+	var accountNumber string
+	var userID uint
+	var balance money.Amount
+	err = dbtx.QueryRow(`SELECT account_number, user_id, balance FROM accounts WHERE id = $1 FOR UPDATE`, id).
+		Scan(&accountNumber, &userID, &balance)
+	if err == sql.ErrNoRows {
 		return errors.New("no record deleted")
 	}
+	if err != nil {
+		return err
+	}
 
-	// Log audit for delete 
-	_ = LogAudit(nil, "DELETE", "accounts", id, "Account deleted")
-	return nil
+	// A posting in flight waits on the row lock and fails once it is gone
+	var hasPostings bool
+	err = dbtx.QueryRow(`SELECT EXISTS (SELECT 1 FROM postings WHERE account_number = $1)`, accountNumber).Scan(&hasPostings)
+	if err != nil {
+		return err
+	}
+	if hasPostings || !balance.IsZero() {
+		return ErrAccountInUse
+	}
+
+	if _, err := dbtx.Exec(`DELETE FROM accounts WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	err = recordEvent(dbtx, models.EventAccountDeleted, "account", id, nil, map[string]interface{}{
+		"account_id":     id,
+		"account_number": accountNumber,
+		"user_id":        userID,
+	})
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
 }
 
 
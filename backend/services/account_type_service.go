@@ -6,12 +6,27 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 )
 
+const accountTypeColumns = `id, type_name, description, currency, per_transaction_limit, daily_limit, monthly_limit,
+	interest_rate, day_count, compounding, interest_posting`
+
+func scanAccountType(row interface{ Scan(...interface{}) error }, at *models.AccountType) error {
+	return row.Scan(&at.ID, &at.TypeName, &at.Description, &at.Currency, &at.PerTransactionLimit, &at.DailyLimit, &at.MonthlyLimit,
+		&at.InterestRate, &at.DayCount, &at.Compounding, &at.InterestPosting)
+}
+
 func CreateAccountType(at *models.AccountType) error {
-	query := `INSERT INTO account_types (type_name, description, currency)
-	          VALUES ($1, $2, $3) RETURNING id`
-	err := db.DB.QueryRow(query, at.TypeName, at.Description, at.Currency).Scan(&at.ID)
+	if err := validateInterestConfig(at); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO account_types (type_name, description, currency, per_transaction_limit, daily_limit, monthly_limit,
+	                                     interest_rate, day_count, compounding, interest_posting)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+	err := db.DB.QueryRow(query, at.TypeName, at.Description, at.Currency, at.PerTransactionLimit, at.DailyLimit, at.MonthlyLimit,
+		at.InterestRate, at.DayCount, at.Compounding, at.InterestPosting).Scan(&at.ID)
 	if err != nil {
 		return err
 	}
@@ -22,7 +37,7 @@ func CreateAccountType(at *models.AccountType) error {
 	return nil
 }
 func GetAllAccountTypes() ([]*models.AccountType, error) {
-	query := `SELECT id, type_name, description, currency FROM account_types`
+	query := `SELECT ` + accountTypeColumns + ` FROM account_types`
 
 	rows, err := db.DB.Query(query)
 	if err != nil {
@@ -34,7 +49,7 @@ func GetAllAccountTypes() ([]*models.AccountType, error) {
 
 	for rows.Next() {
 		var at models.AccountType
-		err := rows.Scan(&at.ID, &at.TypeName, &at.Description, &at.Currency)
+		err := scanAccountType(rows, &at)
 		if err != nil {
 			return nil, err
 		}
@@ -49,10 +64,10 @@ func GetAllAccountTypes() ([]*models.AccountType, error) {
 }
 
 func GetAccountTypeByID(id uint) (*models.AccountType, error) {
-	query := `SELECT id, type_name, description, currency FROM account_types WHERE id = $1`
+	query := `SELECT ` + accountTypeColumns + ` FROM account_types WHERE id = $1`
 
 	var at models.AccountType
-	err := db.DB.QueryRow(query, id).Scan(&at.ID, &at.TypeName, &at.Description, &at.Currency)
+	err := scanAccountType(db.DB.QueryRow(query, id), &at)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("account type with ID %d not found", id)
@@ -63,22 +78,79 @@ func GetAccountTypeByID(id uint) (*models.AccountType, error) {
 	return &at, nil
 }
 
+var ErrAccountTypeCurrencyInUse = errors.New("the currency of an account type can only change while none of its accounts has a balance, postings or unpaid interest")
+
+// UpdateAccountType replaces the settings of an account type. Balances are
+// not converted, so the currency can only change while no account of the
+// type has ever held money.
 func UpdateAccountType(id uint, updated *models.AccountType) error {
-	query := `UPDATE account_types SET type_name = $1, description = $2, currency = $3 WHERE id = $4`
-	result, err := db.DB.Exec(query, updated.TypeName, updated.Description, updated.Currency, id)
+	if err := validateInterestConfig(updated); err != nil {
+		return err
+	}
+
+	dbtx, err := db.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer dbtx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	// Locking the type keeps new accounts from being opened in it meanwhile
+	var currency string
+	err = dbtx.QueryRow(`SELECT currency FROM account_types WHERE id = $1 FOR UPDATE`, id).Scan(&currency)
+	if err == sql.ErrNoRows {
 		return errors.New("no record updated")
 	}
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(currency, updated.Currency) {
+		// Lock the accounts of the type too, so nothing is posted to them
+		// between the check and the update
+		if _, err := dbtx.Exec(`SELECT 1 FROM accounts WHERE account_type_id = $1 FOR UPDATE`, id); err != nil {
+			return err
+		}
+		var inUse bool
+		err = dbtx.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM accounts a
+				WHERE a.account_type_id = $1
+				  AND (a.balance <> 0
+				       OR EXISTS(SELECT 1 FROM postings p WHERE p.account_number = a.account_number)
+				       OR EXISTS(SELECT 1 FROM interest_accruals ia
+				                 WHERE ia.account_number = a.account_number AND ia.posted_transaction_id IS NULL AND ia.amount <> 0)))
+		`, id).Scan(&inUse)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrAccountTypeCurrencyInUse
+		}
+
+		// Fee rules of the type are priced in its currency
+		if _, err := dbtx.Exec(`UPDATE fee_rules SET currency = UPPER($1) WHERE account_type_id = $2`, updated.Currency, id); err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE account_types
+	          SET type_name = $1, description = $2, currency = $3,
+	              per_transaction_limit = $4, daily_limit = $5, monthly_limit = $6,
+	              interest_rate = $7, day_count = $8, compounding = $9, interest_posting = $10
+	          WHERE id = $11`
+	_, err = dbtx.Exec(query, updated.TypeName, updated.Description, updated.Currency,
+		updated.PerTransactionLimit, updated.DailyLimit, updated.MonthlyLimit,
+		updated.InterestRate, updated.DayCount, updated.Compounding, updated.InterestPosting, id)
+	if err != nil {
+		return err
+	}
 
 	// Log audit for update action
-	_ = LogAudit(nil, "UPDATE", "account_types", id, "Account type updated")
+	if err := logAudit(dbtx, nil, "UPDATE", "account_types", id, "Account type updated"); err != nil {
+		return err
+	}
 
-	return nil
+	return dbtx.Commit()
 }
 
 func DeleteAccountType(id uint) error {
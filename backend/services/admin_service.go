@@ -6,24 +6,39 @@ import (
 	"bank/models"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/lib/pq"
 )
 
 
 
-// Create a new role
-func CreateRole(roleName string) (*models.Role, error) {
-	query := `INSERT INTO roles (name, created_at) VALUES ($1, NOW()) RETURNING id`
+// Create a new role granting the given permissions
+func CreateRole(roleName string, permissions []string, adminID uint) (*models.Role, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO roles (name, created_at) VALUES ($1, NOW()) RETURNING id, created_at`
 
 	var role models.Role
 	role.Name = roleName
 
-	err := db.DB.QueryRow(query, roleName).Scan(&role.ID)
+	err = tx.QueryRow(query, roleName).Scan(&role.ID, &role.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := setRolePermissions(tx, role.ID, permissions); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	_ = LogAudit(&adminID, "CREATE", "roles", role.ID, fmt.Sprintf("Created role %q with permissions [%s]", roleName, strings.Join(permissions, ", ")))
 	return &role, nil
 }
 
@@ -51,8 +66,10 @@ func GetAllRoles() ([]models.Role, error) {
 	return roles, nil
 }
 
-// Assign a role to a user
-func AssignRolesToUser(userID uint, roleNames []string) error {
+// AssignRolesToUser replaces the roles of a user. The acting admin can only
+// hand out or take away roles whose permissions they hold themselves, and
+// someone must keep roles:manage afterwards.
+func AssignRolesToUser(userID uint, roleNames []string, adminID uint) error {
 	tx, err := db.DB.Begin()
 	if err != nil {
 		return err
@@ -85,10 +102,33 @@ func AssignRolesToUser(userID uint, roleNames []string) error {
 		}
 		roleIDs = append(roleIDs, id)
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
 	if len(roleIDs) == 0 {
 		return errors.New("roles not found")
 	}
 
+	// Permissions of the roles being granted or taken away that the acting
+	// admin doesn't hold
+	var beyond pq.StringArray
+	err = tx.QueryRow(`
+		SELECT COALESCE(array_agg(DISTINCT p.name ORDER BY p.name), '{}')
+		FROM role_permissions rp
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE (rp.role_id = ANY($1) OR rp.role_id IN (SELECT role_id FROM user_roles WHERE user_id = $2))
+		  AND rp.permission_id NOT IN (
+		      SELECT arp.permission_id FROM user_roles aur
+		      JOIN role_permissions arp ON arp.role_id = aur.role_id
+		      WHERE aur.user_id = $3)
+	`, pq.Array(roleIDs), userID, adminID).Scan(&beyond)
+	if err != nil {
+		return err
+	}
+	if len(beyond) > 0 {
+		return fmt.Errorf("%w: you do not hold %s", ErrForbidden, strings.Join(beyond, ", "))
+	}
+
 	// Remove existing roles
 	_, err = tx.Exec(`DELETE FROM user_roles WHERE user_id = $1`, userID)
 	if err != nil {
@@ -108,14 +148,30 @@ func AssignRolesToUser(userID uint, roleNames []string) error {
 		}
 	}
 
+	if err := ensureRoleManager(tx); err != nil {
+		return err
+	}
+
+	err = logAudit(tx, &adminID, "UPDATE", "user_roles", userID,
+		fmt.Sprintf("Set roles of user %d to [%s]", userID, strings.Join(roleNames, ", ")))
+	if err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
 
 // ToggleUserStatus updates the active status of a user.
-func ActivateDeactivateUser(userID uint, isActive bool) error {
+func ActivateDeactivateUser(userID uint, isActive bool, adminID uint) error {
+	dbtx, err := db.GetDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
 	query := `UPDATE users SET is_active = $1 WHERE id = $2`
-	result, err := db.GetDB().Exec(query, isActive, userID)
+	result, err := dbtx.Exec(query, isActive, userID)
 	if err != nil {
 		return err
 	}
@@ -125,39 +181,80 @@ func ActivateDeactivateUser(userID uint, isActive bool) error {
 		return fmt.Errorf("user with ID %d not found", userID)
 	}
 
-	// Log the action
-	status := "deactivated"
-	if isActive {
-		status = "activated"
+	// A deactivated user is signed out everywhere
+	eventType := models.EventUserActivated
+	if !isActive {
+		eventType = models.EventUserDeactivated
+		if err := revokeSessions(dbtx, `user_id = $1`, userID, "user deactivated"); err != nil {
+			return err
+		}
+	}
+
+	if err := recordEvent(dbtx, eventType, "user", userID, &adminID, map[string]interface{}{"user_id": userID}); err != nil {
+		return err
 	}
-	_ = LogAudit(&userID, "UPDATE", "users", userID, fmt.Sprintf("User %d %s", userID, status))
+	return dbtx.Commit()
+}
 
-	return nil
+var userSorts = map[string]sortKey{
+	"created_at": {column: "u.created_at", cast: "timestamp"},
+	"full_name":  {column: "u.full_name", cast: "text"},
 }
 
-func GetUsersWithRoles() ([]dtos.UserWithRoleDTO, error) {
+// GetUsersWithRoles returns a page of users; a user with several roles gets
+// them comma-separated.
+func GetUsersWithRoles(req PageRequest) (*Page[dtos.UserWithRoleDTO], error) {
+    keys, err := newKeyset(req, userSorts, "created_at", "u.id")
+    if err != nil {
+        return nil, err
+    }
+
+    var total *int64
+    if req.WithTotal {
+        var count int64
+        if err := db.DB.QueryRow(`SELECT COUNT(DISTINCT user_id) FROM user_roles`).Scan(&count); err != nil {
+            return nil, err
+        }
+        total = &count
+    }
+
+    var params []interface{}
+    after, err := keys.where(req.Cursor, &params)
+    if err != nil {
+        return nil, err
+    }
+
     query := `
-        SELECT u.id, u.full_name, u.phone_number, r.name, u.is_active, u.created_at
+        SELECT u.id, u.full_name, u.phone_number, string_agg(r.name, ',' ORDER BY r.name), u.is_active, u.created_at, ` + keys.sortValue() + `
         FROM users u
         JOIN user_roles ur ON u.id = ur.user_id
         JOIN roles r ON ur.role_id = r.id
-    `
-    rows, err :=db.DB.Query(query)
+        WHERE 1=1` + after + `
+        GROUP BY u.id` + keys.orderBy()
+    rows, err :=db.DB.Query(query, params...)
     if err != nil {
         return nil, err
     }
     defer rows.Close()
 
-    var users []dtos.UserWithRoleDTO
+    users := []dtos.UserWithRoleDTO{}
+    var sortValues []string
     for rows.Next() {
         var user dtos.UserWithRoleDTO
-        if err := rows.Scan(&user.ID,&user.Name, &user.Phone, &user.Role, &user.Status, &user.CreatedAt); err != nil {
+        var sortValue string
+        if err := rows.Scan(&user.ID,&user.Name, &user.Phone, &user.Role, &user.Status, &user.CreatedAt, &sortValue); err != nil {
             return nil, err
         }
         users = append(users, user)
+        sortValues = append(sortValues, sortValue)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
     }
 
-    return users, nil
+    result := page(keys, users, sortValues, func(u dtos.UserWithRoleDTO) uint { return u.ID })
+    result.Total = total
+    return &result, nil
 }
 
 func GetAdminDashboardSummary() (*dtos.DashboardSummary, error) {
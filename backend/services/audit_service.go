@@ -9,6 +9,11 @@ import (
 
 // LogAudit inserts an audit log entry using raw SQL
 func LogAudit(userID *uint, actionType, tableName string, recordID uint, description string) error {
+	return logAudit(db.DB, userID, actionType, tableName, recordID, description)
+}
+
+// logAudit is LogAudit inside a caller's transaction.
+func logAudit(q sqlExecutor, userID *uint, actionType, tableName string, recordID uint, description string) error {
 	query := `
 		INSERT INTO audit_logs (user_id, action_type, table_name, record_id, description, action_timestamp)
 		VALUES ($1, $2, $3, $4, $5, $6)
@@ -25,46 +30,70 @@ func LogAudit(userID *uint, actionType, tableName string, recordID uint, descrip
 		uid = sql.NullInt64{Valid: false}
 	}
 
-	_, err := db.DB.Exec(query, uid, actionType, tableName, recordID, description, timestamp)
+	_, err := q.Exec(query, uid, actionType, tableName, recordID, description, timestamp)
 	return err
 }
 
-// GetAllAuditLogs returns all audit logs ordered by timestamp (DESC)
-func GetAllAuditLogs() ([]models.AuditLog, error) {
+var auditLogSorts = map[string]sortKey{
+	"action_timestamp": {column: "al.action_timestamp", cast: "timestamp"},
+}
+
+// GetAllAuditLogs returns a page of audit logs, newest first by default
+func GetAllAuditLogs(req PageRequest) (*Page[models.AuditLog], error) {
+	keys, err := newKeyset(req, auditLogSorts, "action_timestamp", "al.id")
+	if err != nil {
+		return nil, err
+	}
+
+	var total *int64
+	if req.WithTotal {
+		var count int64
+		if err := db.DB.QueryRow(`SELECT COUNT(*) FROM audit_logs`).Scan(&count); err != nil {
+			return nil, err
+		}
+		total = &count
+	}
+
+	var params []interface{}
+	after, err := keys.where(req.Cursor, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	// One account per user keeps a single row per log entry
 	query := `
 		SELECT 
 			al.id,
 			al.user_id,
 			u.full_name,
-			a.account_number,
+			(SELECT a.account_number FROM accounts a WHERE a.user_id = u.id ORDER BY a.id LIMIT 1),
 			al.action_type,
 			al.table_name,
 			al.record_id,
 			al.description,
-			al.action_timestamp
+			al.action_timestamp,
+			` + keys.sortValue() + `
 		FROM 
 			audit_logs al
 		LEFT JOIN 
 			users u ON al.user_id = u.id
-		LEFT JOIN 
-			accounts a ON a.user_id = u.id
-		ORDER BY 
-			al.action_timestamp DESC
-	`
+		WHERE 1=1` + after + keys.orderBy()
 
-	rows, err := db.DB.Query(query)
+	rows, err := db.DB.Query(query, params...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var logs []models.AuditLog
+	logs := []models.AuditLog{}
+	var sortValues []string
 
 	for rows.Next() {
 		var log models.AuditLog
 		var userID sql.NullInt64
 		var fullName sql.NullString
 		var accountNumber sql.NullString
+		var sortValue string
 
 		err := rows.Scan(
 			&log.ID,
@@ -76,6 +105,7 @@ func GetAllAuditLogs() ([]models.AuditLog, error) {
 			&log.RecordID,
 			&log.Description,
 			&log.ActionTimestamp,
+			&sortValue,
 		)
 		if err != nil {
 			return nil, err
@@ -95,7 +125,13 @@ func GetAllAuditLogs() ([]models.AuditLog, error) {
 		}
 
 		logs = append(logs, log)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return logs, rows.Err()
+	result := page(keys, logs, sortValues, func(l models.AuditLog) uint { return l.ID })
+	result.Total = total
+	return &result, nil
 }
@@ -82,49 +82,76 @@ func RegisterUser(input models.User, email, password string) error {
     return nil
 }
 
-// Authenticate email & password and return userID + role
-func Authenticate(email, password string) (uint, string, error) {
+// Authenticate checks email & password and returns userID + roles. Every
+// attempt is written to the login history; repeated failures slow down and
+// then lock the email, and too many failures from one IP block it. Callers
+// only learn ErrInvalidCredentials, never which part was wrong.
+func Authenticate(email, password, ipAddress, userAgent string) (uint, []string, error) {
+    policy := currentLoginPolicy()
+
+    // Step 1: Refuse while throttled, without looking at the password;
+    // otherwise the attempt counts as a failure until it is settled
+    attempt, reason, err := reserveLoginAttempt(policy, email, ipAddress, userAgent)
+    if err != nil {
+        var throttled *LoginThrottledError
+        if errors.As(err, &throttled) {
+            recordLoginAttempt(nil, email, ipAddress, userAgent, false, reason)
+        }
+        return 0, nil, err
+    }
+
+    // Step 2: Find user credentials
     var userID uint
     var passwordHash string
-
-    // Step 1: Find user credentials
-    err := db.DB.QueryRow(`
-        SELECT user_id, password_hash FROM credentials WHERE email = $1
-    `, email).Scan(&userID, &passwordHash)
+    var isActive bool
+    err = db.DB.QueryRow(`
+        SELECT c.user_id, c.password_hash, COALESCE(u.is_active, FALSE)
+        FROM credentials c JOIN users u ON u.id = c.user_id
+        WHERE c.email = $1
+    `, email).Scan(&userID, &passwordHash, &isActive)
     if err == sql.ErrNoRows {
-        return 0, "", errors.New("invalid credentials Of email")
+        // Spend the same time as a real check so unknown emails are not obvious
+        _ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+        attempt.fail(nil, loginUnknownEmail)
+        return 0, nil, ErrInvalidCredentials
     } else if err != nil {
-        return 0, "", err
+        attempt.release(nil, loginError)
+        return 0, nil, err
     }
 
-    // Step 2: Compare password
+    // Step 3: Compare password
     if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
-        return 0, "", errors.New("invalid credentials of password")
+        if attempt.failures == policy.maxFailures {
+            securityAlert(userID, models.SecurityLoginLocked)
+        }
+        attempt.fail(&userID, loginWrongPassword)
+        return 0, nil, ErrInvalidCredentials
+    }
+    if !isActive {
+        attempt.release(&userID, loginDeactivated)
+        return 0, nil, ErrAccountDeactivated
     }
 
-    // Step 3: Find user role
-    var roleID uint
-    err = db.DB.QueryRow(`
-        SELECT role_id FROM user_roles WHERE user_id = $1
-    `, userID).Scan(&roleID)
-    if err == sql.ErrNoRows {
-        return 0, "", errors.New("user role not found")
-    } else if err != nil {
-        return 0, "", err
+    // Step 4: Find user roles
+    roles, err := userRoles(db.DB, userID)
+    if err != nil {
+        attempt.release(&userID, loginError)
+        return 0, nil, err
     }
 
-    // Step 4: Get role name
-    var roleName string
-    err = db.DB.QueryRow(`
-        SELECT name FROM roles WHERE id = $1
-    `, roleID).Scan(&roleName)
-    if err == sql.ErrNoRows {
-        return 0, "", errors.New("role not found")
-    } else if err != nil {
-        return 0, "", err
+    // With 2FA on, failures are only forgotten once the code is right too
+    enabled, err := TOTPEnabled(userID)
+    if err != nil {
+        attempt.release(&userID, loginError)
+        return 0, nil, err
+    }
+    if enabled {
+        attempt.release(&userID, loginSecondFactorRequired)
+        return userID, roles, nil
     }
 
-    return userID, roleName, nil
+    attempt.succeed(userID)
+    return userID, roles, nil
 }
 
 // Reset password
@@ -161,6 +188,7 @@ func ResetUserPassword(userID uint, oldPwd, newPwd string) error {
         return err
     }
 
+    securityAlert(userID, models.SecurityPasswordChanged)
     return nil
 }
 // Get user profile
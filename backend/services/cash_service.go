@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/money"
+	"errors"
+	"fmt"
+)
+
+// Deposit posts cash paid in at the counter to tx.AccountID.
+func Deposit(tx *models.Transaction, tellerID uint) error {
+	return postCash(tx, tellerID, "DEPOSIT")
+}
+
+// Withdraw posts cash paid out at the counter from tx.AccountID.
+func Withdraw(tx *models.Transaction, tellerID uint) error {
+	return postCash(tx, tellerID, "WITHDRAWAL")
+}
+
+// postCash moves money between the bank cash account and a customer account
+// and records it as a DEPOSIT or WITHDRAWAL transaction.
+func postCash(tx *models.Transaction, tellerID uint, transactionType string) error {
+	if !tx.Amount.IsPositive() {
+		return errors.New("invalid amount")
+	}
+
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			dbtx.Rollback()
+			panic(p)
+		}
+	}()
+
+	// Fetch account (locked so a withdrawal can't race a transfer)
+	var account models.Account
+	err = dbtx.QueryRow(`SELECT a.id, a.account_number, a.balance, a.is_active, a.user_id, at.currency
+	                     FROM accounts a JOIN account_types at ON at.id = a.account_type_id
+	                     WHERE a.account_number = $1 FOR UPDATE OF a`, tx.AccountID).
+		Scan(&account.ID, &account.AccountNumber, &account.Balance, &account.IsActive, &account.UserID, &account.AccountType.Currency)
+	if err != nil {
+		dbtx.Rollback()
+		return errors.New("account not found")
+	}
+
+	if !account.IsActive {
+		dbtx.Rollback()
+		return errors.New("account is not active")
+	}
+
+	amount := money.New(tx.Amount, account.AccountType.Currency)
+	change := amount.Amount
+	description := "Cash deposit"
+	eventType := models.EventCashDeposited
+	if transactionType == "WITHDRAWAL" {
+		if account.Balance.Cmp(amount.Amount) < 0 {
+			dbtx.Rollback()
+			return errors.New("insufficient balance")
+		}
+		change = change.Neg()
+		description = "Cash withdrawal"
+		eventType = models.EventCashWithdrawn
+	}
+	if tx.Description != "" {
+		description = tx.Description
+	}
+
+	entry := models.JournalEntry{
+		Reference:   transactionType,
+		Description: fmt.Sprintf("%s for %s", description, account.AccountNumber),
+		Postings: []models.Posting{
+			{AccountNumber: BankCashAccount, Amount: change.Neg(), Currency: amount.Currency},
+			{AccountNumber: account.AccountNumber, Amount: change, Currency: amount.Currency},
+		},
+	}
+	if err := PostJournalEntry(dbtx, &entry); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
+	err = dbtx.QueryRow(`INSERT INTO transactions (account_id, transaction_type, amount, currency, description, user_id, journal_entry_id, transaction_date)
+	                     VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+	                     RETURNING id, transaction_date`,
+		account.AccountNumber, transactionType, amount.Amount, amount.Currency, description, account.UserID, entry.ID).
+		Scan(&tx.ID, &tx.TransactionDate)
+	if err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
+	err = recordEvent(dbtx, eventType, "transaction", tx.ID, &tellerID, map[string]interface{}{
+		"amount":         amount.Amount.String(),
+		"currency":       amount.Currency,
+		"account":        account.AccountNumber,
+		"user_id":        account.UserID,
+		"transaction_id": tx.ID,
+	})
+	if err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	tx.UserID = account.UserID
+	tx.TransactionType = transactionType
+	tx.Currency = amount.Currency
+	tx.Description = description
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"bank/models"
+	"bank/websocket"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// notifyOnEvent turns events into the notifications their users get.
+// They are pushed over WebSocket once the consumer's transaction commits.
+func notifyOnEvent(dbtx *sql.Tx, e models.DomainEvent, p map[string]interface{}) (func(), error) {
+	var sent []websocket.NotificationMessage
+	notify := func(userKey, kind string, payload map[string]interface{}) error {
+		n, err := insertNotification(dbtx, payloadUint(p, userKey), kind, payload)
+		if err == nil {
+			sent = append(sent, n)
+		}
+		return err
+	}
+
+	var err error
+	switch e.Type {
+	case models.EventTransferCompleted:
+		err = notify("receiver_user_id", models.NotificationTransferReceived, map[string]interface{}{
+			"amount":         p["received_amount"],
+			"currency":       p["received_currency"],
+			"from_account":   p["from_account"],
+			"to_account":     p["to_account"],
+			"transaction_id": p["transaction_id"],
+		})
+	case models.EventMoneyRequestCreated:
+		err = notify("recipient_user_id", models.NotificationRequestReceived, pick(p, "request_id", "requester_account", "recipient_account", "amount"))
+	case models.EventMoneyRequestDeclined:
+		err = notify("requester_user_id", models.NotificationRequestDeclined, pick(p, "request_id", "requester_account", "recipient_account", "amount"))
+	case models.EventMoneyRequestExpired:
+		err = notify("requester_user_id", models.NotificationRequestExpired, pick(p, "request_id", "requester_account", "recipient_account", "amount"))
+	case models.EventCashDeposited:
+		err = notify("user_id", models.NotificationCashDeposit, pick(p, "amount", "currency", "account", "transaction_id"))
+	case models.EventCashWithdrawn:
+		err = notify("user_id", models.NotificationCashWithdrawal, pick(p, "amount", "currency", "account", "transaction_id"))
+	case models.EventInterestPaid:
+		err = notify("user_id", models.NotificationInterestPaid, pick(p, "amount", "currency", "account", "transaction_id"))
+	case models.EventStandingOrderFailed:
+		err = notify("user_id", models.NotificationStandingOrderFailed, pick(p, "standing_order_id", "to_account", "reason", "retry_at", "max_retries"))
+	case models.EventStandingOrderSkipped:
+		err = notify("user_id", models.NotificationStandingOrderSkipped, pick(p, "standing_order_id", "to_account", "skipped", "next_run_at"))
+	case models.EventTransactionReversed:
+		// Both parties hear about it, each with their own side
+		for _, side := range []struct{ name, counterparty string }{{"sender", "receiver"}, {"receiver", "sender"}} {
+			err = notify(side.name+"_user_id", models.NotificationTransferReversed, map[string]interface{}{
+				"kind":                 p["kind"],
+				"side":                 side.name,
+				"amount":               p[side.name+"_amount"],
+				"currency":             p[side.name+"_currency"],
+				"counterparty_account": p[side.counterparty+"_account"],
+				"transaction_id":       p["transaction_id"],
+			})
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		for _, n := range sent {
+			pushNotification(n)
+		}
+	}, nil
+}
+
+type auditEntry struct {
+	userID      *uint
+	actionType  string
+	tableName   string
+	recordID    uint
+	description string
+}
+
+// auditOnEvent writes the audit log entries for an event.
+func auditOnEvent(dbtx *sql.Tx, e models.DomainEvent, p map[string]interface{}) (func(), error) {
+	amount := func(amountKey, currencyKey string) string {
+		return payloadString(p, amountKey) + " " + payloadString(p, currencyKey)
+	}
+	actor := func(action, table, idKey, description string) []auditEntry {
+		return []auditEntry{{e.ActorID, action, table, payloadUint(p, idKey), description}}
+	}
+
+	var entries []auditEntry
+	switch e.Type {
+	case models.EventTransferCompleted:
+		sender, receiver := payloadUint(p, "sender_user_id"), payloadUint(p, "receiver_user_id")
+		senderAccount := payloadUint(p, "sender_account_id")
+		entries = append(entries, auditEntry{&sender, "CREATE", "transactions", senderAccount,
+			fmt.Sprintf("Debited %s to %s", amount("amount", "currency"), payloadString(p, "to_account"))})
+		if _, ok := p["fee_amount"]; ok {
+			entries = append(entries, auditEntry{&sender, "CREATE", "transactions", senderAccount,
+				fmt.Sprintf("Charged fee of %s on transfer to %s", amount("fee_amount", "fee_currency"), payloadString(p, "to_account"))})
+		}
+		entries = append(entries, auditEntry{&receiver, "CREATE", "transactions", payloadUint(p, "receiver_account_id"),
+			fmt.Sprintf("Credited %s from %s", amount("received_amount", "received_currency"), payloadString(p, "from_account"))})
+	case models.EventMoneyRequestCreated:
+		entries = actor("CREATE", "money_requests", "request_id", fmt.Sprintf("Money request of %s from %s to %s",
+			payloadString(p, "amount"), payloadString(p, "requester_account"), payloadString(p, "recipient_account")))
+	case models.EventMoneyRequestAccepted:
+		entries = actor("UPDATE", "money_requests", "request_id", fmt.Sprintf("Money request %d accepted", payloadUint(p, "request_id")))
+	case models.EventMoneyRequestDeclined:
+		entries = actor("UPDATE", "money_requests", "request_id", fmt.Sprintf("Money request %d declined", payloadUint(p, "request_id")))
+	case models.EventMoneyRequestExpired:
+		entries = actor("UPDATE", "money_requests", "request_id", fmt.Sprintf("Money request %d expired", payloadUint(p, "request_id")))
+	case models.EventCashDeposited, models.EventCashWithdrawn:
+		kind := "DEPOSIT"
+		if e.Type == models.EventCashWithdrawn {
+			kind = "WITHDRAWAL"
+		}
+		entries = actor("CREATE", "transactions", "transaction_id",
+			fmt.Sprintf("%s of %s on %s", kind, amount("amount", "currency"), payloadString(p, "account")))
+	case models.EventTransactionReversed:
+		entries = actor("CREATE", "transactions", "compensation_id", fmt.Sprintf("%s of %s on transaction %d",
+			payloadString(p, "kind"), amount("sender_amount", "sender_currency"), payloadUint(p, "transaction_id")))
+	case models.EventInterestPaid:
+		entries = actor("CREATE", "transactions", "transaction_id",
+			fmt.Sprintf("Paid %s interest to %s", amount("amount", "currency"), payloadString(p, "account")))
+	case models.EventStandingOrderFailed:
+		entries = actor("UPDATE", "standing_orders", "standing_order_id", "Standing order run failed: "+payloadString(p, "reason"))
+	case models.EventStandingOrderSkipped:
+		entries = actor("UPDATE", "standing_orders", "standing_order_id", fmt.Sprintf("Standing order skipped %d missed runs", payloadUint(p, "skipped")))
+	case models.EventAccountCreated:
+		entries = actor("CREATE", "accounts", "account_id", "Account created")
+	case models.EventAccountUpdated:
+		entries = actor("UPDATE", "accounts", "account_id", "Account updated")
+	case models.EventAccountDeleted:
+		entries = actor("DELETE", "accounts", "account_id", "Account deleted")
+	case models.EventUserActivated:
+		entries = actor("UPDATE", "users", "user_id", fmt.Sprintf("User %d activated", payloadUint(p, "user_id")))
+	case models.EventUserDeactivated:
+		entries = actor("UPDATE", "users", "user_id", fmt.Sprintf("User %d deactivated", payloadUint(p, "user_id")))
+	}
+
+	for _, a := range entries {
+		if err := logAudit(dbtx, a.userID, a.actionType, a.tableName, a.recordID, a.description); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func payloadUint(p map[string]interface{}, key string) uint {
+	n, _ := p[key].(json.Number)
+	v, _ := strconv.ParseUint(n.String(), 10, 64)
+	return uint(v)
+}
+
+func payloadString(p map[string]interface{}, key string) string {
+	s, _ := p[key].(string)
+	return s
+}
+
+func pick(p map[string]interface{}, keys ...string) map[string]interface{} {
+	picked := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		picked[k] = p[k]
+	}
+	return picked
+}
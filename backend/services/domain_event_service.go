@@ -0,0 +1,383 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/utils"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DomainEventChannel is notified whenever a transaction that recorded
+// events commits, so relays need not wait for their next poll.
+const DomainEventChannel = "domain_events"
+
+const eventBatchSize = 100
+
+// recordEvent writes an event to the outbox inside the caller's
+// transaction. aggregateID identifies the changed record.
+func recordEvent(q sqlExecutor, eventType, aggregateType string, aggregateID interface{}, actorID *uint, payload map[string]interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO domain_events (type, aggregate_type, aggregate_id, actor_id, payload, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+	`, eventType, aggregateType, fmt.Sprint(aggregateID), actorID, string(data))
+	if err != nil {
+		return err
+	}
+
+	// Delivered by Postgres only once the transaction commits
+	_, err = q.Exec(`SELECT pg_notify($1, '')`, DomainEventChannel)
+	return err
+}
+
+// eventHandler applies an event inside dbtx, which also records that the
+// consumer has seen it. after, if any, runs once dbtx has committed.
+type eventHandler func(dbtx *sql.Tx, e models.DomainEvent, payload map[string]interface{}) (after func(), err error)
+
+// eventSender hands an event to an external system. It runs outside any
+// transaction; a failure is retried like a failing eventHandler.
+type eventSender func(e models.DomainEvent) error
+
+// An eventConsumer either handles events in the database or sends them out.
+type eventConsumer struct {
+	name string
+	// Events up to this id predate the consumer and are not relayed to it
+	startAfter uint
+	handle     eventHandler
+	send       eventSender
+}
+
+// The consumers every event goes to, besides external subscriptions.
+var builtinConsumers = []eventConsumer{
+	{name: "notifications", handle: notifyOnEvent},
+	{name: "audit", handle: auditOnEvent},
+}
+
+func loadEventPolicy() deliveryPolicy {
+	return deliveryPolicy{
+		maxAttempts: utils.GetEnvInt("EVENT_MAX_ATTEMPTS", 10),
+		retryDelay:  utils.GetEnvDuration("EVENT_RETRY_DELAY", 10*time.Second),
+		maxDelay:    utils.GetEnvDuration("EVENT_MAX_RETRY_DELAY", time.Hour),
+	}
+}
+
+// RelayDomainEvents hands every outstanding event to each consumer. A
+// consumer that fails on an event gets it again with backoff until
+// EVENT_MAX_ATTEMPTS, after which the event is marked FAILED for it.
+func RelayDomainEvents() {
+	consumers := append([]eventConsumer{}, builtinConsumers...)
+	subscriptions, err := subscriptionConsumers()
+	if err != nil {
+		log.Println("Failed to load event subscriptions:", err)
+	}
+	consumers = append(consumers, subscriptions...)
+
+	policy := loadEventPolicy()
+	for _, c := range consumers {
+		relayTo(c, policy)
+	}
+}
+
+// relayTo hands c the events of transactions at or after its watermark
+// that it hasn't seen, and the retries that are due, then moves the
+// watermark up as far as it can.
+func relayTo(c eventConsumer, policy deliveryPolicy) {
+	// Every transaction below the horizon has ended, so no event of theirs
+	// can still turn up
+	var horizon int64
+	if err := db.DB.QueryRow(`SELECT txid_snapshot_xmin(txid_current_snapshot())`).Scan(&horizon); err != nil {
+		log.Printf("Failed to read the event horizon for %s: %v", c.name, err)
+		return
+	}
+	var watermark int64
+	err := db.DB.QueryRow(`SELECT txid FROM domain_event_watermarks WHERE consumer = $1`, c.name).Scan(&watermark)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to load the event watermark of %s: %v", c.name, err)
+		return
+	}
+
+	ok := relayBatches(c, policy, func(after uint) ([]models.DomainEvent, error) {
+		return dueRetries(c.name, after, watermark)
+	})
+	ok = relayBatches(c, policy, func(after uint) ([]models.DomainEvent, error) {
+		return pendingEvents(c.name, after, watermark)
+	}) && ok
+	if !ok || horizon <= watermark {
+		return
+	}
+
+	// Move up to the horizon once every event below it has been tried
+	_, err = db.DB.Exec(`
+		INSERT INTO domain_event_watermarks (consumer, txid)
+		SELECT $1, $3
+		WHERE NOT EXISTS (
+			SELECT 1 FROM domain_events e
+			WHERE e.txid >= $2 AND e.txid < $3 AND e.id > $4 AND NOT EXISTS (
+				SELECT 1 FROM domain_event_consumptions c WHERE c.consumer = $1 AND c.event_id = e.id
+			)
+		)
+		ON CONFLICT (consumer) DO UPDATE SET txid = GREATEST(domain_event_watermarks.txid, EXCLUDED.txid)
+	`, c.name, watermark, horizon, c.startAfter)
+	if err != nil {
+		log.Printf("Failed to move the event watermark of %s: %v", c.name, err)
+	}
+}
+
+// relayBatches consumes what load returns, batch by batch. Each run passes
+// over the events once, so events that keep failing wait for the next run.
+func relayBatches(c eventConsumer, policy deliveryPolicy, load func(after uint) ([]models.DomainEvent, error)) bool {
+	after := c.startAfter
+	for {
+		events, err := load(after)
+		if err != nil {
+			log.Printf("Failed to load events for %s: %v", c.name, err)
+			return false
+		}
+		for _, e := range events {
+			consumeEvent(c, e, policy)
+			after = e.ID
+		}
+		if len(events) < eventBatchSize {
+			return true
+		}
+	}
+}
+
+const domainEventColumns = `e.id, e.type, e.aggregate_type, e.aggregate_id, e.actor_id, e.payload, e.occurred_at`
+
+// pendingEvents lists events of transactions at or after the watermark
+// that consumer has not finished with.
+func pendingEvents(consumer string, after uint, watermark int64) ([]models.DomainEvent, error) {
+	return queryEvents(`
+		SELECT `+domainEventColumns+`
+		FROM domain_events e
+		WHERE e.id > $2 AND e.txid >= $3 AND NOT EXISTS (
+			SELECT 1 FROM domain_event_consumptions c
+			WHERE c.consumer = $1 AND c.event_id = e.id
+			  AND (c.status NOT IN ('RETRY', 'SENDING') OR c.processed_at > NOW())
+		)
+		ORDER BY e.id
+		LIMIT $4
+	`, consumer, after, watermark, eventBatchSize)
+}
+
+// dueRetries lists events behind the watermark whose retry is due, or
+// whose claim by a sender ran out.
+func dueRetries(consumer string, after uint, watermark int64) ([]models.DomainEvent, error) {
+	return queryEvents(`
+		SELECT `+domainEventColumns+`
+		FROM domain_event_consumptions c
+		JOIN domain_events e ON e.id = c.event_id
+		WHERE c.consumer = $1 AND c.status IN ('RETRY', 'SENDING') AND c.processed_at <= NOW()
+		  AND e.id > $2 AND e.txid < $3
+		ORDER BY e.id
+		LIMIT $4
+	`, consumer, after, watermark, eventBatchSize)
+}
+
+func queryEvents(query string, args ...interface{}) ([]models.DomainEvent, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.DomainEvent
+	for rows.Next() {
+		var e models.DomainEvent
+		var actorID sql.NullInt64
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &actorID, &payload, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := uint(actorID.Int64)
+			e.ActorID = &id
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// consumeEvent applies e for c in one transaction with its consumption
+// row. The row's primary key makes a second instance wait for the first
+// and then skip the event, so effects happen exactly once.
+func consumeEvent(c eventConsumer, e models.DomainEvent, policy deliveryPolicy) {
+	if c.send != nil {
+		sendEvent(c, e, policy)
+		return
+	}
+
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		log.Printf("Failed to start consuming event %d for %s: %v", e.ID, c.name, err)
+		return
+	}
+	defer dbtx.Rollback()
+
+	res, err := dbtx.Exec(`
+		INSERT INTO domain_event_consumptions (consumer, event_id, status, attempts, processed_at)
+		VALUES ($1, $2, 'DONE', 1, NOW())
+		ON CONFLICT (consumer, event_id) DO UPDATE
+		SET status = 'DONE', attempts = domain_event_consumptions.attempts + 1, last_error = NULL, processed_at = NOW()
+		WHERE domain_event_consumptions.status = 'RETRY'
+	`, c.name, e.ID)
+	if err != nil {
+		log.Printf("Failed to claim event %d for %s: %v", e.ID, c.name, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	after, err := c.handle(dbtx, e, decodePayload(e.Payload))
+	if err != nil {
+		dbtx.Rollback()
+		recordConsumerFailure(c.name, e.ID, err, policy)
+		return
+	}
+	if err := dbtx.Commit(); err != nil {
+		log.Printf("Failed to commit event %d for %s: %v", e.ID, c.name, err)
+		return
+	}
+	if after != nil {
+		after()
+	}
+}
+
+// sendEvent hands e to an external consumer the way notification
+// deliveries are sent: the event is claimed and the claim committed, then
+// it is sent with no transaction open, then the outcome is recorded. A claim
+// that is neither sent nor failed within deliveryClaimTimeout, e.g. because
+// the instance died, is picked up again; receivers must therefore ignore
+// event ids they have already seen.
+func sendEvent(c eventConsumer, e models.DomainEvent, policy deliveryPolicy) {
+	res, err := db.DB.Exec(`
+		INSERT INTO domain_event_consumptions (consumer, event_id, status, attempts, processed_at)
+		VALUES ($1, $2, 'SENDING', 1, $3)
+		ON CONFLICT (consumer, event_id) DO UPDATE
+		SET status = 'SENDING', attempts = domain_event_consumptions.attempts + 1, processed_at = $3
+		WHERE domain_event_consumptions.status IN ('RETRY', 'SENDING') AND domain_event_consumptions.processed_at <= NOW()
+	`, c.name, e.ID, time.Now().Add(deliveryClaimTimeout))
+	if err != nil {
+		log.Printf("Failed to claim event %d for %s: %v", e.ID, c.name, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	if sendErr := c.send(e); sendErr != nil {
+		var attempts int
+		err := db.DB.QueryRow(`
+			UPDATE domain_event_consumptions SET status = 'RETRY', last_error = $3
+			WHERE consumer = $1 AND event_id = $2 AND status = 'SENDING'
+			RETURNING attempts
+		`, c.name, e.ID, sendErr.Error()).Scan(&attempts)
+		if err != nil {
+			log.Printf("Failed to record failure of event %d for %s: %v", e.ID, c.name, err)
+			return
+		}
+		scheduleConsumerRetry(c.name, e.ID, attempts, sendErr, policy)
+		return
+	}
+
+	_, err = db.DB.Exec(`
+		UPDATE domain_event_consumptions SET status = 'DONE', last_error = NULL, processed_at = NOW()
+		WHERE consumer = $1 AND event_id = $2 AND status = 'SENDING'
+	`, c.name, e.ID)
+	if err != nil {
+		log.Printf("Failed to record event %d as sent to %s: %v", e.ID, c.name, err)
+	}
+}
+
+// recordConsumerFailure schedules a retry; while it waits, processed_at
+// holds the time of the next attempt.
+func recordConsumerFailure(consumer string, eventID uint, cause error, policy deliveryPolicy) {
+	var attempts int
+	err := db.DB.QueryRow(`
+		INSERT INTO domain_event_consumptions (consumer, event_id, status, attempts, last_error, processed_at)
+		VALUES ($1, $2, 'RETRY', 1, $3, NOW())
+		ON CONFLICT (consumer, event_id) DO UPDATE
+		SET attempts = domain_event_consumptions.attempts + 1, last_error = $3
+		WHERE domain_event_consumptions.status = 'RETRY'
+		RETURNING attempts
+	`, consumer, eventID, cause.Error()).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record failure of event %d for %s: %v", eventID, consumer, err)
+		return
+	}
+	scheduleConsumerRetry(consumer, eventID, attempts, cause, policy)
+}
+
+// scheduleConsumerRetry gives up on a RETRY row after too many attempts
+// and otherwise sets the time of the next one.
+func scheduleConsumerRetry(consumer string, eventID uint, attempts int, cause error, policy deliveryPolicy) {
+	var err error
+	if attempts >= policy.maxAttempts {
+		log.Printf("Giving up on event %d for %s after %d attempts: %v", eventID, consumer, attempts, cause)
+		_, err = db.DB.Exec(`UPDATE domain_event_consumptions SET status = 'FAILED' WHERE consumer = $1 AND event_id = $2`, consumer, eventID)
+	} else {
+		_, err = db.DB.Exec(`UPDATE domain_event_consumptions SET processed_at = $3 WHERE consumer = $1 AND event_id = $2`,
+			consumer, eventID, time.Now().Add(policy.backoff(attempts)))
+	}
+	if err != nil {
+		log.Printf("Failed to record failure of event %d for %s: %v", eventID, consumer, err)
+	}
+}
+
+// PruneDomainEvents deletes events older than EVENT_RETENTION (default
+// 720h) together with their consumption records, but only those every
+// current consumer has finished with, DONE or FAILED. Events that predate a
+// subscription count as finished for it.
+func PruneDomainEvents() {
+	retention := utils.GetEnvDuration("EVENT_RETENTION", 720*time.Hour)
+
+	consumers := append([]eventConsumer{}, builtinConsumers...)
+	subscriptions, err := subscriptionConsumers()
+	if err != nil {
+		log.Println("Failed to load event subscriptions:", err)
+		return
+	}
+	consumers = append(consumers, subscriptions...)
+
+	names := make([]string, len(consumers))
+	startAfter := make([]int64, len(consumers))
+	for i, c := range consumers {
+		names[i] = c.name
+		startAfter[i] = int64(c.startAfter)
+	}
+
+	res, err := db.DB.Exec(`
+		DELETE FROM domain_events e
+		WHERE e.occurred_at < $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM unnest($2::text[], $3::bigint[]) AS k(consumer, start_after)
+			WHERE e.id > k.start_after AND NOT EXISTS (
+				SELECT 1 FROM domain_event_consumptions c
+				WHERE c.consumer = k.consumer AND c.event_id = e.id AND c.status IN ('DONE', 'FAILED')
+			)
+		  )
+	`, time.Now().Add(-retention), pq.Array(names), pq.Array(startAfter))
+	if err != nil {
+		log.Println("Failed to prune domain events:", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Pruned %d domain events", n)
+	}
+}
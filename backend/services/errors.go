@@ -0,0 +1,16 @@
+package services
+
+// ValidationError is returned when the service refuses a request as it
+// stands: bad input, or accounts in a state that does not allow it.
+// Anything else a service returns is a server fault.
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.msg
+}
+
+func invalidRequest(msg string) error {
+	return &ValidationError{msg: msg}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"bank/notify"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+var ErrEventSubscriptionNotFound = errors.New("event subscription not found")
+
+// CreateEventSubscription registers an external consumer. It receives
+// events recorded from now on; the signing secret is only returned here.
+func CreateEventSubscription(input dtos.EventSubscriptionRequest, adminID uint) (*models.EventSubscription, error) {
+	u, err := parseWebhookURL(input.URL)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range input.EventTypes {
+		if !slices.Contains(models.DomainEventTypes, t) {
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	s := models.EventSubscription{
+		Name:       input.Name,
+		URL:        u.String(),
+		Secret:     secret,
+		EventTypes: input.EventTypes,
+		CreatedBy:  &adminID,
+	}
+	if s.EventTypes == nil {
+		s.EventTypes = []string{}
+	}
+	err = db.DB.QueryRow(`
+		INSERT INTO event_subscriptions (name, url, secret, event_types, start_after_event_id, created_by, created_at)
+		VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(id), 0) FROM domain_events), $5, NOW())
+		RETURNING id, created_at
+	`, s.Name, s.URL, s.Secret, pq.Array(s.EventTypes), adminID).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = LogAudit(&adminID, "CREATE", "event_subscriptions", s.ID, "Created event subscription "+s.Name+" to "+u.Host)
+	return &s, nil
+}
+
+// GetEventSubscriptions lists the subscriptions without their secrets.
+func GetEventSubscriptions() ([]models.EventSubscription, error) {
+	rows, err := db.DB.Query(`SELECT id, name, url, event_types, created_by, created_at FROM event_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.EventSubscription{}
+	for rows.Next() {
+		var s models.EventSubscription
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.Name, &s.URL, pq.Array(&s.EventTypes), &createdBy, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if createdBy.Valid {
+			id := uint(createdBy.Int64)
+			s.CreatedBy = &id
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// DeleteEventSubscription stops forwarding events to the subscription and
+// forgets what it was sent.
+func DeleteEventSubscription(id, adminID uint) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	res, err := dbtx.Exec(`DELETE FROM event_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrEventSubscriptionNotFound
+	}
+	if _, err := dbtx.Exec(`DELETE FROM domain_event_consumptions WHERE consumer = $1`, subscriptionConsumer(id)); err != nil {
+		return err
+	}
+	if _, err := dbtx.Exec(`DELETE FROM domain_event_watermarks WHERE consumer = $1`, subscriptionConsumer(id)); err != nil {
+		return err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "DELETE", "event_subscriptions", id, "Deleted event subscription")
+	return nil
+}
+
+func subscriptionConsumer(id uint) string {
+	return fmt.Sprintf("subscription:%d", id)
+}
+
+// subscriptionConsumers relays to each subscription the events recorded
+// after it was created.
+func subscriptionConsumers() ([]eventConsumer, error) {
+	rows, err := db.DB.Query(`SELECT id, url, secret, event_types, start_after_event_id FROM event_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var consumers []eventConsumer
+	for rows.Next() {
+		var s models.EventSubscription
+		var startAfter uint
+		if err := rows.Scan(&s.ID, &s.URL, &s.Secret, pq.Array(&s.EventTypes), &startAfter); err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, eventConsumer{
+			name:       subscriptionConsumer(s.ID),
+			startAfter: startAfter,
+			send:       forwardEvent(s),
+		})
+	}
+	return consumers, rows.Err()
+}
+
+// forwardEvent posts the event as JSON, signed like webhook notifications.
+// A failure after the endpoint accepted it means it is posted again, so
+// receivers should ignore event ids they have already seen.
+func forwardEvent(s models.EventSubscription) eventSender {
+	return func(e models.DomainEvent) error {
+		if len(s.EventTypes) > 0 && !slices.Contains(s.EventTypes, e.Type) {
+			return nil
+		}
+		body, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return notify.Webhook(s.URL, s.Secret, body)
+	}
+}
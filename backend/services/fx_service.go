@@ -0,0 +1,304 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"bank/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Bank-owned ledger accounts used by currency conversion. The position
+// account holds one balance per currency; the income account collects spread.
+const (
+	BankFXPositionAccount = "BANK-FX-POSITION"
+	BankFXIncomeAccount   = "BANK-FX-INCOME"
+)
+
+var ErrNoExchangeRate = invalidRequest("no valid exchange rate for this currency pair")
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const exchangeRateColumns = `id, base_currency, quote_currency, rate, spread, valid_from, valid_to, created_by, created_at`
+
+func scanExchangeRate(row interface{ Scan(...interface{}) error }, r *models.ExchangeRate) error {
+	var createdBy sql.NullInt64
+	var validTo sql.NullTime
+	err := row.Scan(&r.ID, &r.BaseCurrency, &r.QuoteCurrency, &r.Rate, &r.Spread, &r.ValidFrom, &validTo, &createdBy, &r.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if validTo.Valid {
+		r.ValidTo = &validTo.Time
+	}
+	if createdBy.Valid {
+		uid := uint(createdBy.Int64)
+		r.CreatedBy = &uid
+	}
+	return nil
+}
+
+func parseRate(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %q", s)
+	}
+	return r, nil
+}
+
+// PublishExchangeRate stores a new rate for a currency pair. An open-ended
+// rate for the same pair is closed when the new one becomes valid.
+func PublishExchangeRate(rate *models.ExchangeRate, adminID uint) error {
+	rate.BaseCurrency = strings.ToUpper(strings.TrimSpace(rate.BaseCurrency))
+	rate.QuoteCurrency = strings.ToUpper(strings.TrimSpace(rate.QuoteCurrency))
+	if rate.BaseCurrency == "" || rate.BaseCurrency == rate.QuoteCurrency {
+		return errors.New("base and quote currency must differ")
+	}
+
+	r, err := parseRate(rate.Rate)
+	if err != nil {
+		return err
+	}
+	if r.Sign() <= 0 {
+		return errors.New("rate must be positive")
+	}
+
+	if rate.Spread == "" {
+		rate.Spread = "0"
+	}
+	spread, err := parseRate(rate.Spread)
+	if err != nil {
+		return err
+	}
+	if spread.Sign() < 0 || spread.Cmp(big.NewRat(1, 1)) >= 0 {
+		return errors.New("spread must be between 0 and 1")
+	}
+
+	if rate.ValidFrom.IsZero() {
+		rate.ValidFrom = time.Now()
+	}
+	if rate.ValidTo != nil && !rate.ValidTo.After(rate.ValidFrom) {
+		return errors.New("valid_to must be after valid_from")
+	}
+
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	// Close the currently open-ended rate for the pair
+	_, err = dbtx.Exec(`
+		UPDATE exchange_rates
+		SET valid_to = $3
+		WHERE base_currency = $1 AND quote_currency = $2
+		  AND valid_to IS NULL AND valid_from < $3
+	`, rate.BaseCurrency, rate.QuoteCurrency, rate.ValidFrom)
+	if err != nil {
+		return err
+	}
+
+	rate.CreatedBy = &adminID
+	err = dbtx.QueryRow(`
+		INSERT INTO exchange_rates (base_currency, quote_currency, rate, spread, valid_from, valid_to, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING id, created_at
+	`, rate.BaseCurrency, rate.QuoteCurrency, rate.Rate, rate.Spread, rate.ValidFrom, rate.ValidTo, adminID).
+		Scan(&rate.ID, &rate.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "CREATE", "exchange_rates", rate.ID,
+		fmt.Sprintf("Published %s/%s rate %s (spread %s)", rate.BaseCurrency, rate.QuoteCurrency, rate.Rate, rate.Spread))
+	return nil
+}
+
+// ExpireExchangeRate ends the validity window of a rate now.
+func ExpireExchangeRate(id uint, adminID uint) error {
+	result, err := db.DB.Exec(`
+		UPDATE exchange_rates
+		SET valid_to = NOW()
+		WHERE id = $1 AND (valid_to IS NULL OR valid_to > NOW()) AND valid_from < NOW()
+	`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return errors.New("exchange rate not found or not currently valid")
+	}
+
+	_ = LogAudit(&adminID, "UPDATE", "exchange_rates", id, "Exchange rate expired")
+	return nil
+}
+
+// GetExchangeRates lists published rates, newest first, optionally for one pair.
+func GetExchangeRates(base, quote string) ([]models.ExchangeRate, error) {
+	query := `SELECT ` + exchangeRateColumns + ` FROM exchange_rates WHERE 1=1`
+	var params []interface{}
+
+	if base != "" {
+		params = append(params, strings.ToUpper(base))
+		query += fmt.Sprintf(" AND base_currency = $%d", len(params))
+	}
+	if quote != "" {
+		params = append(params, strings.ToUpper(quote))
+		query += fmt.Sprintf(" AND quote_currency = $%d", len(params))
+	}
+	query += " ORDER BY valid_from DESC, id DESC"
+
+	rows, err := db.DB.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var r models.ExchangeRate
+		if err := scanExchangeRate(rows, &r); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, rows.Err()
+}
+
+// findExchangeRate returns the rate converting from -> to that is valid now.
+// A rate published the other way round is inverted.
+func findExchangeRate(q queryRower, from, to string) (*models.ExchangeRate, *big.Rat, error) {
+	var r models.ExchangeRate
+	err := scanExchangeRate(q.QueryRow(`
+		SELECT `+exchangeRateColumns+`
+		FROM exchange_rates
+		WHERE ((base_currency = $1 AND quote_currency = $2) OR (base_currency = $2 AND quote_currency = $1))
+		  AND valid_from <= NOW() AND (valid_to IS NULL OR valid_to > NOW())
+		ORDER BY (base_currency = $1) DESC, valid_from DESC
+		LIMIT 1
+	`, from, to), &r)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrNoExchangeRate
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rate, err := parseRate(r.Rate)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.BaseCurrency != from {
+		rate.Inv(rate)
+	}
+	return &r, rate, nil
+}
+
+// loadExchangeRate returns a specific rate by ID for a from -> to conversion,
+// provided it covers the pair and is still valid.
+func loadExchangeRate(q queryRower, id uint, from, to string) (*models.ExchangeRate, *big.Rat, error) {
+	var r models.ExchangeRate
+	err := scanExchangeRate(q.QueryRow(`
+		SELECT `+exchangeRateColumns+`
+		FROM exchange_rates
+		WHERE id = $1 AND valid_from <= NOW() AND (valid_to IS NULL OR valid_to > NOW())
+	`, id), &r)
+	if err == sql.ErrNoRows {
+		return nil, nil, invalidRequest("quoted exchange rate is no longer valid")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rate, err := parseRate(r.Rate)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case r.BaseCurrency == from && r.QuoteCurrency == to:
+	case r.BaseCurrency == to && r.QuoteCurrency == from:
+		rate.Inv(rate)
+	default:
+		return nil, nil, invalidRequest("quoted exchange rate does not cover this currency pair")
+	}
+	return &r, rate, nil
+}
+
+// quoteConversion converts amount into the target currency. When rateID is
+// set that rate is used, otherwise the currently valid one.
+func quoteConversion(q queryRower, rateID *uint, amount money.Money, to string) (*dtos.FXQuote, error) {
+	to = strings.ToUpper(to)
+
+	var r *models.ExchangeRate
+	var rate *big.Rat
+	var err error
+	if rateID != nil {
+		r, rate, err = loadExchangeRate(q, *rateID, amount.Currency, to)
+	} else {
+		r, rate, err = findExchangeRate(q, amount.Currency, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	spread, err := parseRate(r.Spread)
+	if err != nil {
+		return nil, err
+	}
+
+	// mid is what the amount is worth at the published rate; the customer
+	// gets mid less the spread share, which the bank keeps
+	mid := amount.Amount.MulRat(rate)
+	customerRate := new(big.Rat).Mul(rate, new(big.Rat).Sub(big.NewRat(1, 1), spread))
+	converted := amount.Amount.MulRat(customerRate)
+
+	return &dtos.FXQuote{
+		RateID:     r.ID,
+		From:       amount,
+		To:         money.New(converted, to),
+		Rate:       rate.FloatString(10),
+		Spread:     money.New(mid.Sub(converted), to),
+		ValidUntil: r.ValidTo,
+	}, nil
+}
+
+// GetFXQuote quotes a conversion at the currently valid rate.
+func GetFXQuote(from, to string, amount money.Amount) (*dtos.FXQuote, error) {
+	if !amount.IsPositive() {
+		return nil, errors.New("invalid amount")
+	}
+	if strings.EqualFold(from, to) {
+		return nil, errors.New("currencies must differ")
+	}
+	return quoteConversion(db.DB, nil, money.New(amount, from), to)
+}
+
+// fxPostings books a conversion: the source currency leg ends in the FX
+// position account, which pays out the target currency leg to the receiver
+// and the spread to FX income.
+func fxPostings(sender, receiver string, quote *dtos.FXQuote) []models.Posting {
+	mid := quote.To.Amount.Add(quote.Spread.Amount)
+	postings := []models.Posting{
+		{AccountNumber: sender, Amount: quote.From.Amount.Neg(), Currency: quote.From.Currency},
+		{AccountNumber: BankFXPositionAccount, Amount: quote.From.Amount, Currency: quote.From.Currency},
+		{AccountNumber: BankFXPositionAccount, Amount: mid.Neg(), Currency: quote.To.Currency},
+		{AccountNumber: receiver, Amount: quote.To.Amount, Currency: quote.To.Currency},
+	}
+	if !quote.Spread.Amount.IsZero() {
+		postings = append(postings, models.Posting{AccountNumber: BankFXIncomeAccount, Amount: quote.Spread.Amount, Currency: quote.To.Currency})
+	}
+	return postings
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/utils"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+	ErrIdempotencyLeaseLost     = errors.New("idempotency key was taken over by a retry")
+)
+
+// IdempotencyKeyTTL is how long a key and its cached response are kept.
+func IdempotencyKeyTTL() time.Duration {
+	return utils.GetEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+}
+
+// IdempotencyLease is how long a reserved key stays in progress before a
+// retry may take it over, so a request that died mid-way doesn't lock its
+// key for the whole TTL.
+func IdempotencyLease() time.Duration {
+	return utils.GetEnvDuration("IDEMPOTENCY_LEASE", time.Minute)
+}
+
+// ReserveIdempotencyKey claims key for the given user and endpoint. When the
+// key is new (or its previous use or lease expired) it returns the reserved
+// record and replay=false, and the caller must execute the request and then
+// call CompleteIdempotencyKey or ReleaseIdempotencyKey before the lease runs
+// out. When the key was already
+// used with the same fingerprint it returns the stored response with
+// replay=true.
+func ReserveIdempotencyKey(userID uint, endpoint, key, requestHash string) (*models.IdempotencyKey, bool, error) {
+	record := models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		Endpoint:    endpoint,
+		RequestHash: requestHash,
+	}
+
+	// Insert, or take over a row whose key or lease has expired but not been
+	// cleaned up yet
+	err := db.DB.QueryRow(`
+		INSERT INTO idempotency_keys (user_id, idempotency_key, endpoint, request_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NOW(), $5)
+		ON CONFLICT (user_id, endpoint, idempotency_key) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash,
+			    status_code = NULL,
+			    response_body = NULL,
+			    created_at = NOW(),
+			    expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING id, created_at, expires_at
+	`, userID, key, endpoint, requestHash, time.Now().Add(IdempotencyLease())).
+		Scan(&record.ID, &record.CreatedAt, &record.ExpiresAt)
+	if err == nil {
+		return &record, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	// The key is live: compare fingerprints and replay
+	var statusCode sql.NullInt64
+	var responseBody sql.NullString
+	err = db.DB.QueryRow(`
+		SELECT id, request_hash, status_code, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND endpoint = $2 AND idempotency_key = $3
+	`, userID, endpoint, key).Scan(&record.ID, &record.RequestHash, &statusCode, &responseBody, &record.CreatedAt, &record.ExpiresAt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if record.RequestHash != requestHash {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if !statusCode.Valid {
+		return nil, false, ErrIdempotencyKeyInProgress
+	}
+
+	record.StatusCode = int(statusCode.Int64)
+	record.ResponseBody = responseBody.String
+	return &record, true, nil
+}
+
+// CompleteIdempotencyKey stores the response a reserved key produced and
+// keeps it for the full TTL.
+func CompleteIdempotencyKey(record *models.IdempotencyKey, statusCode int, responseBody string) error {
+	return completeIdempotencyKey(db.DB, record, statusCode, responseBody)
+}
+
+// CompleteIdempotencyKeyTx is CompleteIdempotencyKey inside the transaction
+// that carries out the request, so the response is stored exactly when the
+// change commits. It fails with ErrIdempotencyLeaseLost, rolling the change
+// back, if a retry took the key over in the meantime.
+func CompleteIdempotencyKeyTx(dbtx *sql.Tx, record *models.IdempotencyKey, statusCode int, responseBody string) error {
+	return completeIdempotencyKey(dbtx, record, statusCode, responseBody)
+}
+
+func completeIdempotencyKey(q sqlExecutor, record *models.IdempotencyKey, statusCode int, responseBody string) error {
+	result, err := q.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2, expires_at = $3
+		WHERE id = $4 AND created_at = $5
+	`, statusCode, responseBody, time.Now().Add(IdempotencyKeyTTL()), record.ID, record.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a reserved key so the client may retry,
+// used when the request failed for reasons the client is not responsible for.
+// A key a retry has since taken over is left alone.
+func ReleaseIdempotencyKey(record *models.IdempotencyKey) error {
+	_, err := db.DB.Exec(`DELETE FROM idempotency_keys WHERE id = $1 AND created_at = $2`, record.ID, record.CreatedAt)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys removes keys past their expiry and returns how many were removed.
+func DeleteExpiredIdempotencyKeys() (int64, error) {
+	result, err := db.DB.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"bank/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// BankInterestExpenseAccount pays the interest credited to customers.
+const BankInterestExpenseAccount = "BANK-INTEREST-EXPENSE"
+
+const dateLayout = "2006-01-02"
+
+func validateInterestConfig(at *models.AccountType) error {
+	if at.InterestRate == "" {
+		at.InterestRate = "0"
+	}
+	rate, err := parseRate(at.InterestRate)
+	if err != nil {
+		return err
+	}
+	if rate.Sign() < 0 || rate.Cmp(big.NewRat(1, 1)) >= 0 {
+		return errors.New("interest_rate must be between 0 and 1")
+	}
+
+	at.DayCount = strings.ToUpper(strings.TrimSpace(at.DayCount))
+	if at.DayCount == "" {
+		at.DayCount = "ACT/365"
+	}
+	if at.DayCount != "ACT/365" && at.DayCount != "ACT/360" && at.DayCount != "30/360" {
+		return errors.New("day_count must be ACT/365, ACT/360 or 30/360")
+	}
+
+	at.Compounding = strings.ToUpper(strings.TrimSpace(at.Compounding))
+	if at.Compounding == "" {
+		at.Compounding = "NONE"
+	}
+	if at.Compounding != "NONE" && at.Compounding != "DAILY" {
+		return errors.New("compounding must be NONE or DAILY")
+	}
+
+	at.InterestPosting = strings.ToUpper(strings.TrimSpace(at.InterestPosting))
+	if at.InterestPosting == "" {
+		at.InterestPosting = "MONTHLY"
+	}
+	if at.InterestPosting != "MONTHLY" && at.InterestPosting != "QUARTERLY" && at.InterestPosting != "ANNUALLY" {
+		return errors.New("interest_posting must be MONTHLY, QUARTERLY or ANNUALLY")
+	}
+	return nil
+}
+
+// dayFraction is the share of a year that one day earns under a day-count
+// convention. 30/360 treats every month as 30 days: the 31st earns nothing
+// and the last day of February makes up the missing days.
+func dayFraction(day time.Time, dayCount string) *big.Rat {
+	switch dayCount {
+	case "ACT/360":
+		return big.NewRat(1, 360)
+	case "30/360":
+		if day.Day() == 31 {
+			return new(big.Rat)
+		}
+		if day.Month() == time.February && day.AddDate(0, 0, 1).Month() != time.February {
+			return big.NewRat(int64(31-day.Day()), 360)
+		}
+		return big.NewRat(1, 360)
+	}
+	return big.NewRat(1, 365)
+}
+
+// isPostingDay reports whether day closes an interest period.
+func isPostingDay(day time.Time, frequency string) bool {
+	if day.AddDate(0, 0, 1).Month() == day.Month() {
+		return false
+	}
+	switch frequency {
+	case "QUARTERLY":
+		return day.Month()%3 == 0
+	case "ANNUALLY":
+		return day.Month() == time.December
+	}
+	return true
+}
+
+type interestAccount struct {
+	accountNumber string
+	userID        uint
+	currency      string
+	rate          string
+	dayCount      string
+	compounding   string
+	posting       string
+	lastAccrual   *time.Time
+}
+
+// AccrueInterest records a day's interest for every interest-bearing account
+// for each completed day not yet accrued, and pays out the interest of every
+// period that ended. Missed days are caught up, and a day is never accrued
+// twice, so running it more often than daily is harmless.
+func AccrueInterest() {
+	now := time.Now()
+	yesterday := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+
+	rows, err := db.DB.Query(`
+		SELECT a.account_number, a.user_id, at.currency, at.interest_rate, at.day_count, at.compounding, at.interest_posting,
+		       (SELECT MAX(accrual_date) FROM interest_accruals ia WHERE ia.account_number = a.account_number)
+		FROM accounts a
+		JOIN account_types at ON at.id = a.account_type_id
+		WHERE at.interest_rate > 0 AND a.is_active
+	`)
+	if err != nil {
+		log.Println("Error fetching interest-bearing accounts:", err)
+		return
+	}
+
+	var accounts []interestAccount
+	for rows.Next() {
+		var a interestAccount
+		var last sql.NullTime
+		if err := rows.Scan(&a.accountNumber, &a.userID, &a.currency, &a.rate, &a.dayCount, &a.compounding, &a.posting, &last); err != nil {
+			log.Println("Error scanning interest account:", err)
+			continue
+		}
+		if last.Valid {
+			d := time.Date(last.Time.Year(), last.Time.Month(), last.Time.Day(), 0, 0, 0, 0, time.UTC)
+			a.lastAccrual = &d
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+
+	for _, a := range accounts {
+		// Accounts start accruing the day before they are first seen here
+		start := yesterday
+		if a.lastAccrual != nil {
+			start = a.lastAccrual.AddDate(0, 0, 1)
+		}
+
+		for day := start; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+			if err := accrueDay(a, day); err != nil {
+				log.Printf("Interest accrual for %s on %s failed: %v", a.accountNumber, day.Format(dateLayout), err)
+				break
+			}
+			if isPostingDay(day, a.posting) {
+				if err := postInterest(a, day); err != nil {
+					log.Printf("Interest posting for %s on %s failed: %v", a.accountNumber, day.Format(dateLayout), err)
+					break
+				}
+			}
+		}
+	}
+}
+
+// accrueDay records the interest earned by the end-of-day balance of day,
+// as derived from the ledger.
+func accrueDay(a interestAccount, day time.Time) error {
+	var balance money.Amount
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM postings
+		WHERE account_number = $1 AND created_at < $2::date + 1
+	`, a.accountNumber, day.Format(dateLayout)).Scan(&balance)
+	if err != nil {
+		return err
+	}
+
+	base := balance.Rat()
+	if a.compounding == "DAILY" {
+		unpaid, err := unpaidInterest(db.DB, a.accountNumber)
+		if err != nil {
+			return err
+		}
+		base.Add(base, unpaid)
+	}
+
+	amount := new(big.Rat)
+	if base.Sign() > 0 {
+		rate, err := parseRate(a.rate)
+		if err != nil {
+			return err
+		}
+		amount.Mul(base, rate)
+		amount.Mul(amount, dayFraction(day, a.dayCount))
+	}
+
+	_, err = db.DB.Exec(`
+		INSERT INTO interest_accruals (account_number, accrual_date, balance, rate, amount, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (account_number, accrual_date) DO NOTHING
+	`, a.accountNumber, day.Format(dateLayout), balance, a.rate, amount.FloatString(10))
+	return err
+}
+
+// unpaidInterest sums the exact accrued interest not yet paid out.
+func unpaidInterest(q queryRower, accountNumber string) (*big.Rat, error) {
+	var total string
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0)::text FROM interest_accruals
+		WHERE account_number = $1 AND posted_transaction_id IS NULL
+	`, accountNumber).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+	return parseRate(total)
+}
+
+// postInterest pays the unpaid interest accrued up to and including day as
+// an INTEREST transaction. A total below one cent stays unpaid and rolls
+// into the next period.
+func postInterest(a interestAccount, day time.Time) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	var total string
+	err = dbtx.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0)::text FROM (
+			SELECT amount FROM interest_accruals
+			WHERE account_number = $1 AND posted_transaction_id IS NULL AND accrual_date <= $2
+			FOR UPDATE
+		) unpaid
+	`, a.accountNumber, day.Format(dateLayout)).Scan(&total)
+	if err != nil {
+		return err
+	}
+	exact, err := parseRate(total)
+	if err != nil {
+		return err
+	}
+	interest := money.New(money.FromRat(exact), a.currency)
+	if !interest.Amount.IsPositive() {
+		return nil
+	}
+
+	description := fmt.Sprintf("Interest to %s", day.Format(dateLayout))
+	entry := models.JournalEntry{
+		Reference:   "INTEREST",
+		Description: fmt.Sprintf("%s for %s", description, a.accountNumber),
+		Postings: []models.Posting{
+			{AccountNumber: BankInterestExpenseAccount, Amount: interest.Amount.Neg(), Currency: interest.Currency},
+			{AccountNumber: a.accountNumber, Amount: interest.Amount, Currency: interest.Currency},
+		},
+	}
+	if err := PostJournalEntry(dbtx, &entry); err != nil {
+		return err
+	}
+
+	var transactionID uint
+	err = dbtx.QueryRow(`INSERT INTO transactions (account_id, transaction_type, amount, currency, description, user_id, journal_entry_id, transaction_date)
+	                     VALUES ($1, 'INTEREST', $2, $3, $4, $5, $6, NOW())
+	                     RETURNING id`,
+		a.accountNumber, interest.Amount, interest.Currency, description, a.userID, entry.ID).Scan(&transactionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = dbtx.Exec(`
+		UPDATE interest_accruals SET posted_transaction_id = $1
+		WHERE account_number = $2 AND posted_transaction_id IS NULL AND accrual_date <= $3
+	`, transactionID, a.accountNumber, day.Format(dateLayout))
+	if err != nil {
+		return err
+	}
+
+	err = recordEvent(dbtx, models.EventInterestPaid, "transaction", transactionID, nil, map[string]interface{}{
+		"amount":         interest.Amount.String(),
+		"currency":       interest.Currency,
+		"account":        a.accountNumber,
+		"user_id":        a.userID,
+		"transaction_id": transactionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return dbtx.Commit()
+}
+
+// GetAccruedInterest shows the interest one of the user's accounts has
+// earned but not yet been paid.
+func GetAccruedInterest(accountNumber string, userID uint) (*dtos.AccruedInterest, error) {
+	if err := AuthorizeAccount(accountNumber, userID); err != nil {
+		return nil, err
+	}
+
+	result := dtos.AccruedInterest{AccountNumber: accountNumber}
+	err := db.DB.QueryRow(`
+		SELECT at.currency, at.interest_rate, at.day_count, at.compounding, at.interest_posting
+		FROM accounts a JOIN account_types at ON at.id = a.account_type_id
+		WHERE a.account_number = $1
+	`, accountNumber).Scan(&result.Accrued.Currency, &result.InterestRate, &result.DayCount, &result.Compounding, &result.InterestPosting)
+	if err != nil {
+		return nil, err
+	}
+
+	var total string
+	var from, through sql.NullTime
+	err = db.DB.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0)::text, MIN(accrual_date), MAX(accrual_date)
+		FROM interest_accruals
+		WHERE account_number = $1 AND posted_transaction_id IS NULL
+	`, accountNumber).Scan(&total, &from, &through)
+	if err != nil {
+		return nil, err
+	}
+	exact, err := parseRate(total)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Accrued.Amount = money.FromRat(exact)
+	result.AccruedExact = exact.FloatString(10)
+	if from.Valid {
+		result.From = &from.Time
+		result.Through = &through.Time
+	}
+	return &result, nil
+}
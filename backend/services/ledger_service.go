@@ -0,0 +1,259 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"bank/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Bank-owned ledger accounts. They only exist in postings, never in accounts.
+const (
+	BankAccountPrefix = "BANK-"
+	BankCashAccount   = "BANK-CASH"
+)
+
+func isBankAccount(accountNumber string) bool {
+	return strings.HasPrefix(accountNumber, BankAccountPrefix)
+}
+
+// PostJournalEntry writes a journal entry that balances in every currency,
+// together with its postings, inside dbtx and applies every posting to the
+// cached accounts.balance. It is the only place that is allowed to change a
+// customer balance.
+func PostJournalEntry(dbtx *sql.Tx, entry *models.JournalEntry) error {
+	if len(entry.Postings) < 2 {
+		return errors.New("journal entry needs at least two postings")
+	}
+
+	totals := map[string]money.Amount{}
+	for _, p := range entry.Postings {
+		if p.Amount.IsZero() {
+			return errors.New("journal entry contains a zero posting")
+		}
+		if p.Currency == "" {
+			return fmt.Errorf("posting for %s has no currency", p.AccountNumber)
+		}
+		totals[p.Currency] = totals[p.Currency].Add(p.Amount)
+	}
+	for currency, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf("journal entry is not balanced in %s", currency)
+		}
+	}
+
+	err := dbtx.QueryRow(`
+		INSERT INTO journal_entries (reference, description, created_at)
+		VALUES ($1, $2, NOW())
+		RETURNING id, created_at
+	`, entry.Reference, entry.Description).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert journal entry: %v", err)
+	}
+
+	for i := range entry.Postings {
+		p := &entry.Postings[i]
+		p.JournalEntryID = entry.ID
+
+		err = dbtx.QueryRow(`
+			INSERT INTO postings (journal_entry_id, account_number, amount, currency, created_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			RETURNING id, created_at
+		`, entry.ID, p.AccountNumber, p.Amount, p.Currency).Scan(&p.ID, &p.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert posting: %v", err)
+		}
+
+		if isBankAccount(p.AccountNumber) {
+			continue
+		}
+
+		var currency string
+		err = dbtx.QueryRow(`
+			UPDATE accounts a SET balance = a.balance + $1
+			FROM account_types at
+			WHERE at.id = a.account_type_id AND a.account_number = $2
+			RETURNING at.currency
+		`, p.Amount, p.AccountNumber).Scan(&currency)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("ledger account %s not found", p.AccountNumber)
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(currency, p.Currency) {
+			return fmt.Errorf("cannot post %s to account %s held in %s", p.Currency, p.AccountNumber, currency)
+		}
+	}
+
+	return nil
+}
+
+// lockAccounts locks the given customer accounts until dbtx ends and returns
+// them by account number; accounts that don't exist are left out. Rows are
+// locked in account number order, so any two transactions that lock their
+// accounts through here take the locks in the same order and can't
+// deadlock. Everything that moves money between customer accounts must
+// lock them all up front this way before posting.
+func lockAccounts(dbtx *sql.Tx, accountNumbers ...string) (map[string]*models.Account, error) {
+	rows, err := dbtx.Query(`
+		SELECT a.id, a.account_number, a.balance, a.is_active, a.user_id, a.account_type_id, at.currency
+		FROM accounts a JOIN account_types at ON at.id = a.account_type_id
+		WHERE a.account_number = ANY($1)
+		ORDER BY a.account_number
+		FOR UPDATE OF a
+	`, pq.Array(accountNumbers))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make(map[string]*models.Account, len(accountNumbers))
+	for rows.Next() {
+		var a models.Account
+		if err := rows.Scan(&a.ID, &a.AccountNumber, &a.Balance, &a.IsActive, &a.UserID, &a.AccountTypeID, &a.AccountType.Currency); err != nil {
+			return nil, err
+		}
+		accounts[a.AccountNumber] = &a
+	}
+	return accounts, rows.Err()
+}
+
+// GetLedgerBalance returns the balance of an account as derived from its postings.
+func GetLedgerBalance(accountNumber string) (money.Amount, error) {
+	var balance money.Amount
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM postings WHERE account_number = $1
+	`, accountNumber).Scan(&balance)
+	return balance, err
+}
+
+// GetAccountPostings returns the postings of an account, newest first.
+func GetAccountPostings(accountNumber string) ([]models.Posting, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, journal_entry_id, account_number, amount, COALESCE(currency, ''), created_at
+		FROM postings
+		WHERE account_number = $1
+		ORDER BY id DESC
+	`, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	postings := []models.Posting{}
+	for rows.Next() {
+		var p models.Posting
+		if err := rows.Scan(&p.ID, &p.JournalEntryID, &p.AccountNumber, &p.Amount, &p.Currency, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		postings = append(postings, p)
+	}
+
+	return postings, rows.Err()
+}
+
+// VerifyLedger proves that the ledger neither creates nor destroys money:
+// postings sum to zero in every currency, every journal entry is balanced and
+// every stored account balance matches the sum of its postings.
+func VerifyLedger() (*dtos.LedgerReport, error) {
+	report := dtos.LedgerReport{
+		LedgerTotals:      []money.Money{},
+		UnbalancedEntries: []uint{},
+		Discrepancies:     []dtos.LedgerDiscrepancy{},
+	}
+	totalsBalanced := true
+
+	// 1. Grand total per currency
+	totals, err := db.DB.Query(`
+		SELECT COALESCE(currency, ''), SUM(amount)
+		FROM postings
+		GROUP BY currency
+		ORDER BY currency
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer totals.Close()
+
+	for totals.Next() {
+		var total money.Money
+		if err := totals.Scan(&total.Currency, &total.Amount); err != nil {
+			return nil, err
+		}
+		if !total.Amount.IsZero() {
+			totalsBalanced = false
+		}
+		report.LedgerTotals = append(report.LedgerTotals, total)
+	}
+	if err := totals.Err(); err != nil {
+		return nil, err
+	}
+
+	// 2. Unbalanced journal entries
+	rows, err := db.DB.Query(`
+		SELECT DISTINCT journal_entry_id
+		FROM (
+			SELECT journal_entry_id
+			FROM postings
+			GROUP BY journal_entry_id, currency
+			HAVING SUM(amount) <> 0
+		) unbalanced
+		ORDER BY journal_entry_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		report.UnbalancedEntries = append(report.UnbalancedEntries, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 3. Stored balances that drifted from their postings
+	drift, err := db.DB.Query(`
+		SELECT a.account_number, a.balance, COALESCE(p.total, 0)
+		FROM accounts a
+		LEFT JOIN (
+			SELECT account_number, SUM(amount) AS total
+			FROM postings
+			GROUP BY account_number
+		) p ON p.account_number = a.account_number
+		WHERE a.balance <> COALESCE(p.total, 0)
+		ORDER BY a.account_number
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer drift.Close()
+
+	for drift.Next() {
+		var d dtos.LedgerDiscrepancy
+		if err := drift.Scan(&d.AccountNumber, &d.StoredBalance, &d.LedgerBalance); err != nil {
+			return nil, err
+		}
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+	if err := drift.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Balanced = totalsBalanced &&
+		len(report.UnbalancedEntries) == 0 &&
+		len(report.Discrepancies) == 0
+
+	return &report, nil
+}
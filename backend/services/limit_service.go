@@ -0,0 +1,267 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"bank/money"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Codes returned to clients when a transfer hits a limit.
+const (
+	LimitPerTransaction = "PER_TRANSACTION_LIMIT_EXCEEDED"
+	LimitDaily          = "DAILY_LIMIT_EXCEEDED"
+	LimitMonthly        = "MONTHLY_LIMIT_EXCEEDED"
+)
+
+var ErrLimitOverrideNotFound = errors.New("limit override not found")
+
+// LimitError is returned when an outgoing transfer would exceed a limit.
+type LimitError struct {
+	Code      string
+	Limit     money.Money
+	Remaining money.Money
+}
+
+func (e *LimitError) Error() string {
+	switch e.Code {
+	case LimitPerTransaction:
+		return fmt.Sprintf("amount exceeds the per-transaction limit of %s", e.Limit)
+	case LimitDaily:
+		return fmt.Sprintf("transfer exceeds the daily limit of %s (%s left today)", e.Limit, e.Remaining)
+	default:
+		return fmt.Sprintf("transfer exceeds the monthly limit of %s (%s left this month)", e.Limit, e.Remaining)
+	}
+}
+
+// transferLimits are the limits that apply to one account after overrides.
+type transferLimits struct {
+	currency       string
+	perTransaction *money.Amount
+	daily          *money.Amount
+	monthly        *money.Amount
+}
+
+// loadTransferLimits resolves the limits of an account. Each limit is taken
+// from the account override, else the user override, else the account type.
+func loadTransferLimits(q queryRower, accountNumber string) (*transferLimits, error) {
+	var l transferLimits
+	err := q.QueryRow(`
+		SELECT at.currency,
+		       COALESCE(ao.per_transaction_limit, uo.per_transaction_limit, at.per_transaction_limit),
+		       COALESCE(ao.daily_limit, uo.daily_limit, at.daily_limit),
+		       COALESCE(ao.monthly_limit, uo.monthly_limit, at.monthly_limit)
+		FROM accounts a
+		JOIN account_types at ON at.id = a.account_type_id
+		LEFT JOIN limit_overrides ao ON ao.account_number = a.account_number
+		LEFT JOIN limit_overrides uo ON uo.user_id = a.user_id
+		WHERE a.account_number = $1
+	`, accountNumber).Scan(&l.currency, &l.perTransaction, &l.daily, &l.monthly)
+	if err == sql.ErrNoRows {
+		return nil, invalidRequest("account not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// transferUsage sums what the account has sent today and this month.
+func transferUsage(q queryRower, accountNumber string) (daily, monthly money.Amount, err error) {
+	err = q.QueryRow(`
+		SELECT COALESCE(SUM(amount) FILTER (WHERE transaction_date >= date_trunc('day', NOW())), 0),
+		       COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE account_id = $1 AND transaction_type = 'DEBIT'
+		  AND transaction_date >= date_trunc('month', NOW())
+	`, accountNumber).Scan(&daily, &monthly)
+	return daily, monthly, err
+}
+
+// checkTransferLimits refuses amount when it breaks a limit of the account.
+// It must run inside the transaction that holds the sender row lock so
+// concurrent transfers cannot slip past the daily and monthly totals.
+func checkTransferLimits(q queryRower, accountNumber string, amount money.Amount) error {
+	limits, err := loadTransferLimits(q, accountNumber)
+	if err != nil {
+		return err
+	}
+	if err := checkPerTransactionLimit(limits, amount); err != nil {
+		return err
+	}
+	if limits.daily == nil && limits.monthly == nil {
+		return nil
+	}
+
+	daily, monthly, err := transferUsage(q, accountNumber)
+	if err != nil {
+		return err
+	}
+	if limits.daily != nil && daily.Add(amount).Cmp(*limits.daily) > 0 {
+		return limitError(LimitDaily, *limits.daily, daily, limits.currency)
+	}
+	if limits.monthly != nil && monthly.Add(amount).Cmp(*limits.monthly) > 0 {
+		return limitError(LimitMonthly, *limits.monthly, monthly, limits.currency)
+	}
+	return nil
+}
+
+func checkPerTransactionLimit(limits *transferLimits, amount money.Amount) error {
+	if limits.perTransaction != nil && amount.Cmp(*limits.perTransaction) > 0 {
+		return limitError(LimitPerTransaction, *limits.perTransaction, 0, limits.currency)
+	}
+	return nil
+}
+
+func limitError(code string, limit, used money.Amount, currency string) *LimitError {
+	remaining := limit.Sub(used)
+	if remaining.IsNegative() {
+		remaining = money.Zero
+	}
+	return &LimitError{
+		Code:      code,
+		Limit:     money.New(limit, currency),
+		Remaining: money.New(remaining, currency),
+	}
+}
+
+// GetAccountLimits reports the limits of one of the user's accounts and how
+// much of the daily and monthly limits is still available.
+func GetAccountLimits(accountNumber string, userID uint) (*dtos.AccountLimits, error) {
+	if err := AuthorizeAccount(accountNumber, userID); err != nil {
+		return nil, err
+	}
+
+	limits, err := loadTransferLimits(db.DB, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	daily, monthly, err := transferUsage(db.DB, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dtos.AccountLimits{
+		AccountNumber:  accountNumber,
+		Currency:       limits.currency,
+		PerTransaction: limits.perTransaction,
+		Daily:          limitUsage(limits.daily, daily),
+		Monthly:        limitUsage(limits.monthly, monthly),
+	}, nil
+}
+
+func limitUsage(limit *money.Amount, used money.Amount) dtos.LimitUsage {
+	usage := dtos.LimitUsage{Limit: limit, Used: used}
+	if limit != nil {
+		remaining := limit.Sub(used)
+		if remaining.IsNegative() {
+			remaining = money.Zero
+		}
+		usage.Remaining = &remaining
+	}
+	return usage
+}
+
+func validateLimits(o *models.LimitOverride) error {
+	for _, l := range []*money.Amount{o.PerTransactionLimit, o.DailyLimit, o.MonthlyLimit} {
+		if l != nil && l.IsNegative() {
+			return errors.New("limits cannot be negative")
+		}
+	}
+	return nil
+}
+
+// SetAccountLimitOverride creates or replaces the override of one account.
+func SetAccountLimitOverride(accountNumber string, o *models.LimitOverride, adminID uint) error {
+	if err := validateLimits(o); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM accounts WHERE account_number = $1)`, accountNumber).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("account not found")
+	}
+
+	o.AccountNumber, o.UserID, o.SetBy = &accountNumber, nil, &adminID
+	err := db.DB.QueryRow(`
+		INSERT INTO limit_overrides (account_number, per_transaction_limit, daily_limit, monthly_limit, set_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (account_number) DO UPDATE
+		SET per_transaction_limit = EXCLUDED.per_transaction_limit,
+		    daily_limit = EXCLUDED.daily_limit,
+		    monthly_limit = EXCLUDED.monthly_limit,
+		    set_by = EXCLUDED.set_by,
+		    updated_at = NOW()
+		RETURNING id, updated_at
+	`, accountNumber, o.PerTransactionLimit, o.DailyLimit, o.MonthlyLimit, adminID).Scan(&o.ID, &o.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "UPDATE", "limit_overrides", o.ID, fmt.Sprintf("Set transfer limits for account %s", accountNumber))
+	return nil
+}
+
+// SetUserLimitOverride creates or replaces the override for all accounts of a user.
+func SetUserLimitOverride(userID uint, o *models.LimitOverride, adminID uint) error {
+	if err := validateLimits(o); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("user not found")
+	}
+
+	o.AccountNumber, o.UserID, o.SetBy = nil, &userID, &adminID
+	err := db.DB.QueryRow(`
+		INSERT INTO limit_overrides (user_id, per_transaction_limit, daily_limit, monthly_limit, set_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET per_transaction_limit = EXCLUDED.per_transaction_limit,
+		    daily_limit = EXCLUDED.daily_limit,
+		    monthly_limit = EXCLUDED.monthly_limit,
+		    set_by = EXCLUDED.set_by,
+		    updated_at = NOW()
+		RETURNING id, updated_at
+	`, userID, o.PerTransactionLimit, o.DailyLimit, o.MonthlyLimit, adminID).Scan(&o.ID, &o.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "UPDATE", "limit_overrides", o.ID, fmt.Sprintf("Set transfer limits for user %d", userID))
+	return nil
+}
+
+// DeleteAccountLimitOverride removes the override of an account.
+func DeleteAccountLimitOverride(accountNumber string, adminID uint) error {
+	return deleteLimitOverride(`account_number = $1`, accountNumber, adminID)
+}
+
+// DeleteUserLimitOverride removes the override of a user.
+func DeleteUserLimitOverride(userID uint, adminID uint) error {
+	return deleteLimitOverride(`user_id = $1`, userID, adminID)
+}
+
+func deleteLimitOverride(where string, target interface{}, adminID uint) error {
+	var id uint
+	err := db.DB.QueryRow(`DELETE FROM limit_overrides WHERE `+where+` RETURNING id`, target).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrLimitOverrideNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "DELETE", "limit_overrides", id, fmt.Sprintf("Removed transfer limits override for %v", target))
+	return nil
+}
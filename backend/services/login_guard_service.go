@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Reasons stored with failed login attempts. Clients only ever see
+// ErrInvalidCredentials or a LoginThrottledError.
+const (
+	loginUnknownEmail  = "unknown_email"
+	loginWrongPassword = "wrong_password"
+	loginDeactivated   = "deactivated"
+	loginLocked        = "locked"
+	loginIPBlocked     = "ip_blocked"
+	loginPending       = "pending" // until the password or code has been checked
+	loginError         = "error"
+
+	loginSecondFactorRequired = "second_factor_required"
+	loginWrongSecondFactor    = "wrong_second_factor"
+	loginInvalidChallenge     = "invalid_challenge"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAccountDeactivated = errors.New("this account has been deactivated")
+)
+
+// LoginThrottledError refuses a login without checking the password.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts; try again later"
+}
+
+// dummyPasswordHash is compared against when the email is unknown, so both
+// cases take as long as a real password check.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+type loginPolicy struct {
+	maxFailures   int           // failures that lock the email
+	lockout       time.Duration // first lockout; doubles with every further failure
+	failureWindow time.Duration // failures older than this are forgotten
+	ipMaxFailures int
+	ipWindow      time.Duration
+}
+
+func currentLoginPolicy() loginPolicy {
+	return loginPolicy{
+		maxFailures:   utils.GetEnvInt("LOGIN_MAX_FAILURES", 5),
+		lockout:       utils.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		failureWindow: utils.GetEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		ipMaxFailures: utils.GetEnvInt("LOGIN_IP_MAX_FAILURES", 20),
+		ipWindow:      utils.GetEnvDuration("LOGIN_IP_WINDOW", 15*time.Minute),
+	}
+}
+
+// delayAfter is how long an email is blocked after its n-th consecutive
+// failure: nothing for the first two, then 2s, 4s, ... until maxFailures
+// locks it, and every failure after that doubles the lockout, up to a day.
+func (p loginPolicy) delayAfter(failures int) time.Duration {
+	if failures < 3 {
+		return 0
+	}
+	if failures < p.maxFailures {
+		return time.Duration(1<<uint(failures-2)) * time.Second
+	}
+
+	d := p.lockout
+	for i := p.maxFailures; i < failures && d < 24*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 24*time.Hour {
+		d = 24 * time.Hour
+	}
+	return d
+}
+
+func loginKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginAttempt is a login attempt reserved before the password is
+// checked. It already counts as a failure for the email and the IP, so
+// parallel guesses cannot slip past the limits; finish settles it.
+type loginAttempt struct {
+	id       uint
+	email    string
+	failures int // consecutive failures of the email, this one included
+}
+
+// reserveLoginAttempt refuses the attempt while the email is locked or the
+// IP has failed too often recently. Otherwise it counts the attempt as a
+// failure and blocks the email for the policy's delay until it is settled.
+func reserveLoginAttempt(p loginPolicy, email, ipAddress, userAgent string) (*loginAttempt, string, error) {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer dbtx.Rollback()
+
+	// Attempts from one IP are counted one at a time
+	if _, err := dbtx.Exec(`SELECT pg_advisory_xact_lock(hashtext('login_ip:' || $1))`, ipAddress); err != nil {
+		return nil, "", err
+	}
+	var ipFailures int
+	err = dbtx.QueryRow(`
+		SELECT COUNT(*) FROM login_attempts
+		WHERE ip_address = $1 AND NOT success AND failure_reason IN ($2, $3, $4, $5)
+		  AND created_at > NOW() - $6 * INTERVAL '1 second'
+	`, ipAddress, loginPending, loginUnknownEmail, loginWrongPassword, loginWrongSecondFactor, int64(p.ipWindow/time.Second)).Scan(&ipFailures)
+	if err != nil {
+		return nil, "", err
+	}
+	if ipFailures >= p.ipMaxFailures {
+		return nil, loginIPBlocked, &LoginThrottledError{RetryAfter: p.ipWindow}
+	}
+
+	a := loginAttempt{email: loginKey(email)}
+	_, err = dbtx.Exec(`INSERT INTO login_lockouts (email, failed_attempts, updated_at) VALUES ($1, 0, NOW()) ON CONFLICT (email) DO NOTHING`, a.email)
+	if err != nil {
+		return nil, "", err
+	}
+	var lockedUntil sql.NullTime
+	var updatedAt time.Time
+	err = dbtx.QueryRow(`SELECT failed_attempts, locked_until, updated_at FROM login_lockouts WHERE email = $1 FOR UPDATE`, a.email).
+		Scan(&a.failures, &lockedUntil, &updatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now()) {
+		return nil, loginLocked, &LoginThrottledError{RetryAfter: time.Until(lockedUntil.Time).Round(time.Second)}
+	}
+
+	if updatedAt.Before(time.Now().Add(-p.failureWindow)) {
+		a.failures = 0
+	}
+	a.failures++
+	var until *time.Time
+	if delay := p.delayAfter(a.failures); delay > 0 {
+		t := time.Now().Add(delay)
+		until = &t
+	}
+	_, err = dbtx.Exec(`UPDATE login_lockouts SET failed_attempts = $1, locked_until = $2, updated_at = NOW() WHERE email = $3`,
+		a.failures, until, a.email)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = dbtx.QueryRow(`
+		INSERT INTO login_attempts (email, ip_address, user_agent, success, failure_reason, created_at)
+		VALUES ($1, $2, $3, FALSE, $4, NOW())
+		RETURNING id
+	`, a.email, ipAddress, userAgent, loginPending).Scan(&a.id)
+	if err != nil {
+		return nil, "", err
+	}
+	return &a, "", dbtx.Commit()
+}
+
+// fail settles the attempt as the failure it was counted as.
+func (a *loginAttempt) fail(userID *uint, reason string) {
+	a.finish(userID, false, reason)
+}
+
+// succeed settles the attempt and forgets the email's failures.
+func (a *loginAttempt) succeed(userID uint) {
+	clearLoginFailures(a.email)
+	a.finish(&userID, true, "")
+}
+
+// release settles an attempt that was not a wrong guess, taking back the
+// failure it was counted as. The block it set is lifted unless another
+// attempt has failed since.
+func (a *loginAttempt) release(userID *uint, reason string) {
+	_, err := db.DB.Exec(`
+		UPDATE login_lockouts
+		SET failed_attempts = GREATEST(failed_attempts - 1, 0),
+		    locked_until = CASE WHEN failed_attempts = $2 THEN NULL ELSE locked_until END
+		WHERE email = $1
+	`, a.email, a.failures)
+	if err != nil {
+		log.Println("Failed to release login attempt:", err)
+	}
+	a.finish(userID, false, reason)
+}
+
+func (a *loginAttempt) finish(userID *uint, success bool, reason string) {
+	var failureReason *string
+	if !success {
+		failureReason = &reason
+	}
+	_, err := db.DB.Exec(`UPDATE login_attempts SET user_id = $1, success = $2, failure_reason = $3 WHERE id = $4`,
+		userID, success, failureReason, a.id)
+	if err != nil {
+		log.Println("Failed to record login attempt:", err)
+	}
+}
+
+func clearLoginFailures(email string) {
+	if _, err := db.DB.Exec(`DELETE FROM login_lockouts WHERE email = $1`, loginKey(email)); err != nil {
+		log.Println("Failed to reset failed logins:", err)
+	}
+}
+
+func recordLoginAttempt(userID *uint, email, ipAddress, userAgent string, success bool, reason string) {
+	var failureReason *string
+	if !success {
+		failureReason = &reason
+	}
+	_, err := db.DB.Exec(`
+		INSERT INTO login_attempts (user_id, email, ip_address, user_agent, success, failure_reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	`, userID, loginKey(email), ipAddress, userAgent, success, failureReason)
+	if err != nil {
+		log.Println("Failed to record login attempt:", err)
+	}
+}
+
+// UnlockLogin clears the failed attempts and lockout of a user.
+func UnlockLogin(userID uint, adminID uint) error {
+	var email string
+	if err := db.DB.QueryRow(`SELECT email FROM credentials WHERE user_id = $1`, userID).Scan(&email); err != nil {
+		return errors.New("user not found")
+	}
+	if _, err := db.DB.Exec(`DELETE FROM login_lockouts WHERE email = $1`, loginKey(email)); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "UPDATE", "login_lockouts", userID, fmt.Sprintf("Unlocked login of user %d", userID))
+	return nil
+}
+
+var loginAttemptSorts = map[string]sortKey{
+	"created_at": {column: "created_at", cast: "timestamp"},
+}
+
+// GetLoginHistory returns a page of a user's login attempts, newest first.
+func GetLoginHistory(userID uint, req PageRequest) (*Page[models.LoginAttempt], error) {
+	keys, err := newKeyset(req, loginAttemptSorts, "created_at", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	params := []interface{}{userID}
+	conditions := ` WHERE user_id = $1`
+
+	var total *int64
+	if req.WithTotal {
+		var count int64
+		if err := db.DB.QueryRow(`SELECT COUNT(*) FROM login_attempts`+conditions, params...).Scan(&count); err != nil {
+			return nil, err
+		}
+		total = &count
+	}
+
+	after, err := keys.where(req.Cursor, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT id, user_id, email, ip_address, COALESCE(user_agent, ''), success, COALESCE(failure_reason, ''), created_at, `+keys.sortValue()+`
+		FROM login_attempts`+conditions+after+keys.orderBy(), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []models.LoginAttempt{}
+	var sortValues []string
+	for rows.Next() {
+		var a models.LoginAttempt
+		var sortValue string
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Email, &a.IPAddress, &a.UserAgent, &a.Success, &a.FailureReason, &a.CreatedAt, &sortValue); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := page(keys, attempts, sortValues, func(a models.LoginAttempt) uint { return a.ID })
+	result.Total = total
+	return &result, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginDelayAfter(t *testing.T) {
+	p := loginPolicy{maxFailures: 5, lockout: 15 * time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 0},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		{5, 15 * time.Minute},
+		{6, 30 * time.Minute},
+		{7, time.Hour},
+		{11, 16 * time.Hour},
+		{12, 24 * time.Hour},
+		{100, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := p.delayAfter(tt.failures); got != tt.want {
+			t.Errorf("delayAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginDelayAfterLowMaxFailures(t *testing.T) {
+	// With maxFailures at 3 the lockout starts before any short delay
+	p := loginPolicy{maxFailures: 3, lockout: time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := p.delayAfter(tt.failures); got != tt.want {
+			t.Errorf("delayAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginKey(t *testing.T) {
+	if got := loginKey("  Alice@Example.COM "); got != "alice@example.com" {
+		t.Errorf("loginKey = %q", got)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/notify"
+	"bank/utils"
+	"bank/websocket"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// Deliveries are claimed one at a time, just before they are sent, for
+// this long; one that is neither sent nor failed by then, e.g. because the
+// instance died, is picked up again. It has to outlast a single send.
+const deliveryClaimTimeout = 5 * time.Minute
+
+// errNoWebhook fails a webhook delivery whose endpoint was removed.
+var errNoWebhook = errors.New("no webhook configured")
+
+type deliveryPolicy struct {
+	maxAttempts int
+	retryDelay  time.Duration // before the first retry, doubled for each one after
+	maxDelay    time.Duration
+}
+
+func loadDeliveryPolicy() deliveryPolicy {
+	return deliveryPolicy{
+		maxAttempts: utils.GetEnvInt("NOTIFICATION_MAX_ATTEMPTS", 8),
+		retryDelay:  utils.GetEnvDuration("NOTIFICATION_RETRY_DELAY", 30*time.Second),
+		maxDelay:    utils.GetEnvDuration("NOTIFICATION_MAX_RETRY_DELAY", 6*time.Hour),
+	}
+}
+
+// backoff is the wait after the n-th failed attempt.
+func (p deliveryPolicy) backoff(attempts int) time.Duration {
+	d := p.retryDelay
+	for i := 1; i < attempts && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return d
+}
+
+// enqueueDeliveries queues n on every external channel in channels that
+// the user has an address for.
+func enqueueDeliveries(q sqlExecutor, n websocket.NotificationMessage, channels map[string]bool) error {
+	destinations := map[string]string{
+		models.ChannelEmail:   `SELECT email FROM credentials WHERE user_id = $1`,
+		models.ChannelSMS:     `SELECT COALESCE(phone_number, '') FROM users WHERE id = $1`,
+		models.ChannelWebhook: `SELECT url FROM notification_webhooks WHERE user_id = $1`,
+	}
+	for _, channel := range models.NotificationChannels {
+		query, external := destinations[channel]
+		if !external || !channels[channel] {
+			continue
+		}
+
+		var destination string
+		err := q.QueryRow(query, n.UserID).Scan(&destination)
+		if err == sql.ErrNoRows || (err == nil && destination == "") {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = q.Exec(`
+			INSERT INTO notification_deliveries (notification_id, channel, destination, created_at)
+			VALUES ($1, $2, $3, NOW())
+		`, n.ID, channel, destination)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pendingDelivery struct {
+	id          uint
+	channel     string
+	destination string
+	attempts    int
+	message     websocket.NotificationMessage
+}
+
+// DeliverPendingNotifications sends the deliveries that are due. Failed
+// attempts are retried with exponential backoff until NOTIFICATION_MAX_ATTEMPTS.
+func DeliverPendingNotifications() {
+	policy := loadDeliveryPolicy()
+	for {
+		d, err := claimDelivery()
+		if err != nil {
+			log.Println("Failed to claim notification delivery:", err)
+			return
+		}
+		if d == nil {
+			return
+		}
+		recordDelivery(policy, *d, sendDelivery(*d))
+	}
+}
+
+// claimDelivery takes the next due delivery, counting the attempt and
+// pushing it out of reach of other instances until the claim times out. It
+// returns nil when nothing is due.
+func claimDelivery() (*pendingDelivery, error) {
+	var d pendingDelivery
+	var payload []byte
+	err := db.DB.QueryRow(`
+		WITH claimed AS (
+			UPDATE notification_deliveries
+			SET attempts = attempts + 1, next_attempt_at = NOW() + $1 * INTERVAL '1 second'
+			WHERE id = (
+				SELECT id FROM notification_deliveries
+				WHERE status = 'PENDING' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, notification_id, channel, destination, attempts
+		)
+		SELECT c.id, c.channel, c.destination, c.attempts,
+		       n.id, n.user_id, n.type, n.message, n.payload, n.created_at
+		FROM claimed c JOIN notifications n ON n.id = c.notification_id
+	`, int64(deliveryClaimTimeout/time.Second)).Scan(&d.id, &d.channel, &d.destination, &d.attempts,
+		&d.message.ID, &d.message.UserID, &d.message.Type, &d.message.Message, &payload, &d.message.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.message.Payload = payload
+	return &d, nil
+}
+
+func sendDelivery(d pendingDelivery) error {
+	switch d.channel {
+	case models.ChannelEmail:
+		subject := "New notification from your bank"
+		if d.message.Type == models.NotificationSecurityAlert {
+			subject = "Security alert"
+		}
+		return notify.Email(d.destination, subject, d.message.Message)
+	case models.ChannelSMS:
+		return notify.SMS(d.destination, d.message.Message)
+	case models.ChannelWebhook:
+		// The endpoint and secret are read at send time so a rotated
+		// secret applies to deliveries still queued
+		var endpoint, secret string
+		err := db.DB.QueryRow(`SELECT url, secret FROM notification_webhooks WHERE user_id = $1`, d.message.UserID).Scan(&endpoint, &secret)
+		if err == sql.ErrNoRows {
+			return errNoWebhook
+		}
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(d.message)
+		if err != nil {
+			return err
+		}
+		return notify.Webhook(endpoint, secret, body)
+	default:
+		return errors.New("unknown channel " + d.channel)
+	}
+}
+
+func recordDelivery(p deliveryPolicy, d pendingDelivery, sendErr error) {
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = db.DB.Exec(`UPDATE notification_deliveries SET status = 'SENT', sent_at = NOW(), last_error = NULL WHERE id = $1`, d.id)
+	case d.attempts >= p.maxAttempts || sendErr == errNoWebhook:
+		log.Printf("Giving up on %s delivery %d after %d attempts: %v", d.channel, d.id, d.attempts, sendErr)
+		_, err = db.DB.Exec(`UPDATE notification_deliveries SET status = 'FAILED', last_error = $2 WHERE id = $1`, d.id, sendErr.Error())
+	default:
+		_, err = db.DB.Exec(`UPDATE notification_deliveries SET next_attempt_at = $2, last_error = $3 WHERE id = $1`,
+			d.id, time.Now().Add(p.backoff(d.attempts)), sendErr.Error())
+	}
+	if err != nil {
+		log.Printf("Failed to record %s delivery %d: %v", d.channel, d.id, err)
+	}
+}
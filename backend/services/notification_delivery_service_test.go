@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeliveryBackoff(t *testing.T) {
+	p := deliveryPolicy{maxAttempts: 8, retryDelay: 30 * time.Second, maxDelay: 6 * time.Hour}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{1000, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDeliveryBackoffFirstDelayAboveCap(t *testing.T) {
+	p := deliveryPolicy{retryDelay: 2 * time.Hour, maxDelay: time.Hour}
+	for _, attempts := range []int{1, 2, 5} {
+		if got := p.backoff(attempts); got != time.Hour {
+			t.Errorf("backoff(%d) = %v, want the 1h cap", attempts, got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+)
+
+var ErrInvalidWebhookURL = errors.New("webhook URL must be an absolute https URL")
+
+// channelEnabledByDefault is the preference of a user who never changed it:
+// everything in the app, and security alerts by email as well.
+func channelEnabledByDefault(kind, channel string) bool {
+	switch channel {
+	case models.ChannelInApp:
+		return true
+	case models.ChannelEmail:
+		return kind == models.NotificationSecurityAlert
+	default:
+		return false
+	}
+}
+
+// notificationChannels returns which channels userID wants kind on.
+func notificationChannels(q sqlExecutor, userID uint, kind string) (map[string]bool, error) {
+	channels := make(map[string]bool, len(models.NotificationChannels))
+	for _, channel := range models.NotificationChannels {
+		channels[channel] = channelEnabledByDefault(kind, channel)
+	}
+
+	rows, err := q.Query(`SELECT channel, enabled FROM notification_preferences WHERE user_id = $1 AND type = $2`, userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var channel string
+		var enabled bool
+		if err := rows.Scan(&channel, &enabled); err != nil {
+			return nil, err
+		}
+		channels[channel] = enabled
+	}
+	return channels, rows.Err()
+}
+
+// GetNotificationPreferences returns the user's full preference matrix.
+func GetNotificationPreferences(userID uint) (*dtos.NotificationPreferences, error) {
+	result := &dtos.NotificationPreferences{Preferences: []dtos.NotificationTypePreferences{}}
+	for _, kind := range models.NotificationTypes {
+		channels, err := notificationChannels(db.DB, userID, kind)
+		if err != nil {
+			return nil, err
+		}
+		result.Preferences = append(result.Preferences, dtos.NotificationTypePreferences{Type: kind, Channels: channels})
+	}
+
+	var webhook dtos.NotificationWebhook
+	err := db.DB.QueryRow(`SELECT url FROM notification_webhooks WHERE user_id = $1`, userID).Scan(&webhook.URL)
+	if err == nil {
+		result.Webhook = &webhook
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetNotificationPreferences turns channels on or off for types of
+// notification; entries not mentioned keep their current setting.
+func SetNotificationPreferences(userID uint, updates []dtos.NotificationPreferenceUpdate) error {
+	for _, u := range updates {
+		if !slices.Contains(models.NotificationTypes, u.Type) {
+			return fmt.Errorf("unknown notification type %q", u.Type)
+		}
+		if !slices.Contains(models.NotificationChannels, u.Channel) {
+			return fmt.Errorf("unknown notification channel %q", u.Channel)
+		}
+	}
+
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	for _, u := range updates {
+		_, err := dbtx.Exec(`
+			INSERT INTO notification_preferences (user_id, type, channel, enabled, updated_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			ON CONFLICT (user_id, type, channel) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = NOW()
+		`, userID, u.Type, u.Channel, u.Enabled)
+		if err != nil {
+			return err
+		}
+	}
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&userID, "UPDATE", "notification_preferences", userID, fmt.Sprintf("Changed %d notification preferences", len(updates)))
+	return nil
+}
+
+// SetNotificationWebhook points the user's webhook notifications at
+// rawURL with a new signing secret, which is only returned here. Plain http
+// is accepted when WEBHOOK_ALLOW_HTTP=true, for local testing.
+func SetNotificationWebhook(userID uint, rawURL string) (*dtos.NotificationWebhook, error) {
+	u, err := parseWebhookURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO notification_webhooks (user_id, url, secret, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (user_id) DO UPDATE SET url = EXCLUDED.url, secret = EXCLUDED.secret, updated_at = NOW()
+	`, userID, u.String(), secret)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = LogAudit(&userID, "UPDATE", "notification_webhooks", userID, "Set notification webhook to "+u.Host)
+	return &dtos.NotificationWebhook{URL: u.String(), Secret: secret}, nil
+}
+
+func parseWebhookURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return nil, ErrInvalidWebhookURL
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && os.Getenv("WEBHOOK_ALLOW_HTTP") == "true") {
+		return nil, ErrInvalidWebhookURL
+	}
+	return u, nil
+}
+
+// DeleteNotificationWebhook removes the user's webhook; deliveries still
+// queued for it fail.
+func DeleteNotificationWebhook(userID uint) error {
+	if _, err := db.DB.Exec(`DELETE FROM notification_webhooks WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_ = LogAudit(&userID, "DELETE", "notification_webhooks", userID, "Removed notification webhook")
+	return nil
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/websocket"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Replays are capped; anything older is still listed by the notifications
+// endpoint.
+const maxReplayedNotifications = 500
+
+// notificationCategories are the groups the notifications listing can be
+// filtered by.
+var notificationCategories = map[string][]string{
+	"requests": {models.NotificationRequestReceived},
+	"alert": {
+		models.NotificationRequestDeclined,
+		models.NotificationRequestExpired,
+		models.NotificationStandingOrderFailed,
+		models.NotificationStandingOrderSkipped,
+		models.NotificationSecurityAlert,
+	},
+}
+
+// sqlExecutor is satisfied by both *sql.DB and *sql.Tx.
+type sqlExecutor interface {
+	queryRower
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertNotification stores a notification of kind for userID, rendering
+// its message from payload in DefaultLocale, and queues it on the external
+// channels the user chose. It returns the notification ready to hand to
+// pushNotification once the surrounding transaction has committed.
+func insertNotification(q sqlExecutor, userID uint, kind string, payload map[string]interface{}) (websocket.NotificationMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return websocket.NotificationMessage{}, err
+	}
+	message, ok := renderNotification(kind, DefaultLocale, decodePayload(data))
+	if !ok {
+		return websocket.NotificationMessage{}, fmt.Errorf("no %s template for notification type %s", DefaultLocale, kind)
+	}
+	channels, err := notificationChannels(q, userID, kind)
+	if err != nil {
+		return websocket.NotificationMessage{}, err
+	}
+
+	// Without the in-app channel the notification is kept for the listing
+	// but never pushed or replayed
+	n := websocket.NotificationMessage{UserID: userID, Type: kind, Message: message, Payload: data}
+	err = q.QueryRow(`
+		INSERT INTO notifications (user_id, type, message, payload, in_app, delivered_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 THEN NULL ELSE NOW() END, NOW())
+		RETURNING id, created_at
+	`, userID, kind, message, string(data), channels[models.ChannelInApp]).Scan(&n.ID, &n.CreatedAt)
+	if err != nil {
+		return n, err
+	}
+
+	return n, enqueueDeliveries(q, n, channels)
+}
+
+// pushNotification sends n to the user's open connections unless it was
+// delivered already, which is also how notifications of types the user
+// turned in-app off are stored.
+func pushNotification(n websocket.NotificationMessage) {
+	var delivered bool
+	err := db.DB.QueryRow(`SELECT delivered_at IS NOT NULL FROM notifications WHERE id = $1`, n.ID).Scan(&delivered)
+	if err != nil || delivered {
+		return
+	}
+	websocket.Notify(n)
+}
+
+// notifyUser stores and pushes a notification that is not part of a larger
+// transaction. Failures are logged; they never fail the caller.
+func notifyUser(userID uint, kind string, payload map[string]interface{}) {
+	n, err := insertNotification(db.DB, userID, kind, payload)
+	if err != nil {
+		log.Printf("Failed to store %s notification for user %d: %v", kind, userID, err)
+		return
+	}
+	pushNotification(n)
+}
+
+// securityAlert tells userID about a change to how they sign in.
+func securityAlert(userID uint, event string) {
+	notifyUser(userID, models.NotificationSecurityAlert, map[string]interface{}{"event": event})
+}
+
+// decodePayload keeps numbers as written so ids render without exponents.
+func decodePayload(data []byte) map[string]interface{} {
+	payload := map[string]interface{}{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	_ = dec.Decode(&payload)
+	return payload
+}
+
+type NotificationFilter struct {
+	UserID     uint
+	Category   string
+	Type       string
+	UnreadOnly bool
+	// Locale messages are rendered in
+	Locale string
+
+	PageRequest
+}
+
+var notificationSorts = map[string]sortKey{
+	"created_at": {column: "created_at", cast: "timestamp"},
+}
+
+// GetNotifications lists a user's notifications with messages rendered in
+// filter.Locale. Notifications stored before payloads keep their original
+// message.
+func GetNotifications(filter NotificationFilter) (*Page[models.Notification], error) {
+	keys, err := newKeyset(filter.PageRequest, notificationSorts, "created_at", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	params := []interface{}{filter.UserID}
+	conditions := " WHERE user_id = $1"
+	if types, ok := notificationCategories[filter.Category]; ok {
+		params = append(params, pq.Array(types))
+		conditions += fmt.Sprintf(" AND type = ANY($%d)", len(params))
+	}
+	if filter.Type != "" {
+		params = append(params, filter.Type)
+		conditions += fmt.Sprintf(" AND type = $%d", len(params))
+	}
+	if filter.UnreadOnly {
+		conditions += " AND is_read = FALSE"
+	}
+
+	var total *int64
+	if filter.WithTotal {
+		var count int64
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM notifications"+conditions, params...).Scan(&count); err != nil {
+			return nil, fmt.Errorf("query error: %w", err)
+		}
+		total = &count
+	}
+
+	after, err := keys.where(filter.Cursor, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, user_id, type, message, payload, is_read, delivered_at, created_at, " + keys.sortValue() +
+		" FROM notifications" + conditions + after + keys.orderBy()
+	rows, err := db.DB.Query(query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	var sortValues []string
+	for rows.Next() {
+		var n models.Notification
+		var payload []byte
+		var isRead sql.NullBool
+		var sortValue string
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Message, &payload, &isRead, &n.DeliveredAt, &n.CreatedAt, &sortValue); err != nil {
+			return nil, err
+		}
+		n.Payload = payload
+		n.IsRead = isRead.Bool
+		if message, ok := renderNotification(n.Type, filter.Locale, decodePayload(payload)); ok {
+			n.Message = message
+		}
+		notifications = append(notifications, n)
+		sortValues = append(sortValues, sortValue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := page(keys, notifications, sortValues, func(n models.Notification) uint { return n.ID })
+	result.Total = total
+	return &result, nil
+}
+
+// CountUnreadNotifications counts the user's unread notifications.
+func CountUnreadNotifications(userID uint) (int64, error) {
+	var count int64
+	err := db.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = FALSE`, userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks one of the user's notifications as read.
+// Reading a notification also counts as delivering it.
+func MarkNotificationRead(id, userID uint) error {
+	res, err := db.DB.Exec(`
+		UPDATE notifications SET is_read = TRUE, delivered_at = COALESCE(delivered_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user as
+// read and returns how many there were.
+func MarkAllNotificationsRead(userID uint) (int64, error) {
+	res, err := db.DB.Exec(`
+		UPDATE notifications SET is_read = TRUE, delivered_at = COALESCE(delivered_at, NOW())
+		WHERE user_id = $1 AND is_read = FALSE
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteNotification removes one of the user's notifications.
+func DeleteNotification(id, userID uint) error {
+	res, err := db.DB.Exec(`DELETE FROM notifications WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// NotificationBacklog serves WebSocket replays and acknowledgements from
+// the notifications table.
+type NotificationBacklog struct{}
+
+func (NotificationBacklog) Missed(userID, lastSeenID uint) ([]websocket.NotificationMessage, error) {
+	condition := "delivered_at IS NULL"
+	params := []interface{}{userID, maxReplayedNotifications}
+	if lastSeenID > 0 {
+		condition = "id > $3"
+		params = append(params, lastSeenID)
+	}
+
+	// Newest first so the cap keeps the most recent, then back in id order
+	rows, err := db.DB.Query(`
+		SELECT id, user_id, type, message, payload, created_at FROM notifications
+		WHERE user_id = $1 AND in_app AND `+condition+`
+		ORDER BY id DESC LIMIT $2
+	`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missed []websocket.NotificationMessage
+	for rows.Next() {
+		var n websocket.NotificationMessage
+		var payload []byte
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Message, &payload, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Payload = payload
+		missed = append(missed, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(missed)-1; i < j; i, j = i+1, j-1 {
+		missed[i], missed[j] = missed[j], missed[i]
+	}
+	return missed, nil
+}
+
+func (NotificationBacklog) Load(userID, id uint) (*websocket.NotificationMessage, error) {
+	var n websocket.NotificationMessage
+	var payload []byte
+	err := db.DB.QueryRow(`
+		SELECT id, user_id, type, message, payload, created_at FROM notifications
+		WHERE id = $1 AND user_id = $2 AND in_app
+	`, id, userID).Scan(&n.ID, &n.UserID, &n.Type, &n.Message, &payload, &n.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n.Payload = payload
+	return &n, nil
+}
+
+// Ack ignores ids that do not belong to userID.
+func (NotificationBacklog) Ack(userID uint, ids []uint, read bool) error {
+	notificationIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		notificationIDs[i] = int64(id)
+	}
+
+	_, err := db.DB.Exec(`
+		UPDATE notifications
+		SET delivered_at = COALESCE(delivered_at, NOW()), is_read = is_read OR $3
+		WHERE user_id = $1 AND id = ANY($2)
+	`, userID, pq.Array(notificationIDs), read)
+	return err
+}
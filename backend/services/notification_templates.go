@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultLocale is used for stored messages and when a notification has no
+// template in the requested locale.
+const DefaultLocale = "en"
+
+//go:embed notification_templates/*.json
+var embeddedNotificationTemplates embed.FS
+
+var (
+	templatesMu           sync.RWMutex
+	notificationTemplates = map[string]map[string]*template.Template{}
+)
+
+func init() {
+	entries, err := embeddedNotificationTemplates.ReadDir("notification_templates")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := embeddedNotificationTemplates.ReadFile("notification_templates/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		if err := addNotificationTemplates(strings.TrimSuffix(entry.Name(), ".json"), data); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// LoadNotificationTemplates adds the <locale>.json files found in
+// NOTIFICATION_TEMPLATES_DIR to the built-in templates. Each file maps a
+// notification type to a text/template rendered with its payload; entries
+// replace built-in ones of the same locale and type.
+func LoadNotificationTemplates() error {
+	dir := os.Getenv("NOTIFICATION_TEMPLATES_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		locale := strings.TrimSuffix(filepath.Base(file), ".json")
+		if err := addNotificationTemplates(locale, data); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func addNotificationTemplates(locale string, data []byte) error {
+	var sources map[string]string
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return err
+	}
+
+	parsed := make(map[string]*template.Template, len(sources))
+	for kind, source := range sources {
+		t, err := template.New(kind).Option("missingkey=error").Parse(source)
+		if err != nil {
+			return err
+		}
+		parsed[kind] = t
+	}
+
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	locale = strings.ToLower(locale)
+	if notificationTemplates[locale] == nil {
+		notificationTemplates[locale] = map[string]*template.Template{}
+	}
+	for kind, t := range parsed {
+		notificationTemplates[locale][kind] = t
+	}
+	return nil
+}
+
+// renderNotification renders a notification of kind in locale, falling
+// back to DefaultLocale. ok is false when there is no template or the
+// payload does not fit it, e.g. for notifications stored before payloads.
+func renderNotification(kind, locale string, payload map[string]interface{}) (message string, ok bool) {
+	templatesMu.RLock()
+	t := notificationTemplates[strings.ToLower(locale)][kind]
+	if t == nil {
+		t = notificationTemplates[DefaultLocale][kind]
+	}
+	templatesMu.RUnlock()
+	if t == nil {
+		return "", false
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, payload); err != nil {
+		return "", false
+	}
+	return out.String(), true
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var (
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrCursorSortMismatch = errors.New("cursor was issued for a different sort order")
+	ErrInvalidSort        = errors.New("unsupported sort field")
+)
+
+// IsInvalidPageRequest reports whether err is the client's fault.
+func IsInvalidPageRequest(err error) bool {
+	return errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrCursorSortMismatch) || errors.Is(err, ErrInvalidSort)
+}
+
+// PageRequest asks for one page of a listing. Sort names one of the
+// listing's sort fields (empty for its default); Cursor is the NextCursor of
+// the previous page and must be used with the same sort.
+type PageRequest struct {
+	Limit     int
+	Cursor    string
+	Sort      string
+	Ascending bool
+	WithTotal bool
+}
+
+// Page is one page of a listing. NextCursor is empty on the last page; Total
+// is only counted when asked for.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	Total      *int64
+}
+
+// sortKey is a column a listing can be ordered by. Rows are always ordered
+// by the key and then by id, which makes the order total and lets the cursor
+// resume exactly after the last row. column must never be NULL, as row
+// comparisons with NULL match nothing; wrap nullable columns in COALESCE.
+type sortKey struct {
+	column string
+	cast   string // SQL type the cursor value is cast back to
+}
+
+// Postgres' text form of timestamps and numerics, as sortValue selects them.
+const cursorTimestampLayout = "2006-01-02 15:04:05.999999999"
+
+var cursorNumeric = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// checkValue makes sure a cursor value casts to the key's type, so a
+// tampered cursor is refused here instead of failing the query.
+func (k sortKey) checkValue(v string) error {
+	switch k.cast {
+	case "timestamp":
+		if _, err := time.Parse(cursorTimestampLayout, v); err != nil {
+			return ErrInvalidCursor
+		}
+	case "numeric":
+		if !cursorNumeric.MatchString(v) {
+			return ErrInvalidCursor
+		}
+	}
+	return nil
+}
+
+// cursor is the opaque position after the last row of a page. It also pins
+// the sort it was produced for.
+type cursor struct {
+	Sort      string `json:"s"`
+	Ascending bool   `json:"a,omitempty"`
+	Value     string `json:"v"`
+	ID        uint   `json:"id"`
+}
+
+func encodeCursor(c cursor) string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keyset is a page request resolved against the sort fields of a listing.
+// Queries select sortValue() as their last column, add where() to their
+// conditions and end with orderBy().
+type keyset struct {
+	sort      string
+	key       sortKey
+	idColumn  string
+	ascending bool
+	limit     int
+}
+
+func newKeyset(req PageRequest, sorts map[string]sortKey, defaultSort, idColumn string) (*keyset, error) {
+	k := keyset{sort: req.Sort, idColumn: idColumn, ascending: req.Ascending, limit: req.Limit}
+	if k.sort == "" {
+		k.sort = defaultSort
+	}
+	key, ok := sorts[k.sort]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSort, k.sort)
+	}
+	k.key = key
+
+	if k.limit <= 0 {
+		k.limit = DefaultPageSize
+	}
+	if k.limit > MaxPageSize {
+		k.limit = MaxPageSize
+	}
+	return &k, nil
+}
+
+// where returns the condition that skips the rows up to and including the cursor.
+func (k *keyset) where(cursorValue string, params *[]interface{}) (string, error) {
+	if cursorValue == "" {
+		return "", nil
+	}
+	c, err := decodeCursor(cursorValue)
+	if err != nil {
+		return "", err
+	}
+	if c.Sort != k.sort || c.Ascending != k.ascending {
+		return "", ErrCursorSortMismatch
+	}
+	if err := k.key.checkValue(c.Value); err != nil {
+		return "", err
+	}
+
+	op := "<"
+	if k.ascending {
+		op = ">"
+	}
+	*params = append(*params, c.Value, c.ID)
+	return fmt.Sprintf(" AND (%s, %s) %s ($%d::%s, $%d)",
+		k.key.column, k.idColumn, op, len(*params)-1, k.key.cast, len(*params)), nil
+}
+
+// orderBy returns the ORDER BY and LIMIT clause; one row more than the page
+// size is fetched to learn whether another page follows.
+func (k *keyset) orderBy() string {
+	dir := "DESC"
+	if k.ascending {
+		dir = "ASC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", k.key.column, dir, k.idColumn, dir, k.limit+1)
+}
+
+// sortValue is the expression to select last so the cursor can be built.
+func (k *keyset) sortValue() string {
+	return k.key.column + "::text"
+}
+
+// page trims the extra row and builds the cursor from the last row kept.
+func page[T any](k *keyset, items []T, sortValues []string, id func(T) uint) Page[T] {
+	p := Page[T]{Items: items}
+	if len(items) > k.limit {
+		p.Items = items[:k.limit]
+		last := p.Items[k.limit-1]
+		p.NextCursor = encodeCursor(cursor{Sort: k.sort, Ascending: k.ascending, Value: sortValues[k.limit-1], ID: id(last)})
+	}
+	return p
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKeysetWhereChecksCursorValue(t *testing.T) {
+	tests := []struct {
+		sort  string
+		value string
+		err   error
+	}{
+		{"requeste_at", "2024-03-01 12:30:45.123456", nil},
+		{"requeste_at", "2024-03-01 12:30:45", nil},
+		{"requeste_at", "1970-01-01 00:00:00", nil},
+		{"requeste_at", "yesterday", ErrInvalidCursor},
+		{"requeste_at", "2024-03-01'; DROP TABLE users; --", ErrInvalidCursor},
+		{"requeste_at", "", ErrInvalidCursor},
+		{"amount", "12.50", nil},
+		{"amount", "-3", nil},
+		{"amount", "1e3", ErrInvalidCursor},
+		{"amount", "NaN", ErrInvalidCursor},
+		{"amount", "12.", ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		k, err := newKeyset(PageRequest{Sort: tt.sort}, moneyRequestSorts, "requeste_at", "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := encodeCursor(cursor{Sort: tt.sort, Value: tt.value, ID: 7})
+		var params []interface{}
+		if _, err := k.where(c, &params); !errors.Is(err, tt.err) {
+			t.Errorf("%s cursor %q: error = %v, want %v", tt.sort, tt.value, err, tt.err)
+		}
+	}
+}
+
+func TestKeysetWhereRejectsOtherSort(t *testing.T) {
+	k, err := newKeyset(PageRequest{Sort: "amount"}, moneyRequestSorts, "requeste_at", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := encodeCursor(cursor{Sort: "expires_at", Value: "2024-03-01 12:30:45", ID: 7})
+	var params []interface{}
+	if _, err := k.where(c, &params); !errors.Is(err, ErrCursorSortMismatch) {
+		t.Errorf("error = %v, want ErrCursorSortMismatch", err)
+	}
+	if _, err := k.where("not base64!", &params); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("error = %v, want ErrInvalidCursor", err)
+	}
+}
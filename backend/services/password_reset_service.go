@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bank/db"
+	"bank/mail"
+	"bank/models"
+	"bank/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidResetToken    = errors.New("invalid or expired password reset token")
+	ErrTooManyResetRequests = errors.New("too many password reset requests; try again later")
+)
+
+// PasswordResetTTL is how long an emailed reset link works.
+func PasswordResetTTL() time.Duration {
+	return utils.GetEnvDuration("PASSWORD_RESET_TTL", 30*time.Minute)
+}
+
+func passwordResetLink(token string) string {
+	base := os.Getenv("PASSWORD_RESET_URL")
+	if base == "" {
+		base = "http://localhost:3000/reset-password"
+	}
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+// RequestPasswordReset emails a reset link to the owner of email. Unknown
+// addresses are silently ignored so the endpoint does not reveal which
+// emails have accounts; a new request voids the user's earlier links.
+func RequestPasswordReset(email, ipAddress string) error {
+	if err := reservePasswordResetRequest(email, ipAddress); err != nil {
+		return err
+	}
+
+	var userID uint
+	err := db.DB.QueryRow(`SELECT user_id FROM credentials WHERE email = $1`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	if _, err := dbtx.Exec(`UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return err
+	}
+	var tokenID uint
+	err = dbtx.QueryRow(`INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, requested_ip, created_at)
+	                     VALUES ($1, $2, $3, $4, NOW()) RETURNING id`,
+		userID, hashToken(token), time.Now().Add(PasswordResetTTL()), ipAddress).Scan(&tokenID)
+	if err != nil {
+		return err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&userID, "CREATE", "password_reset_tokens", tokenID, fmt.Sprintf("Password reset requested from %s", ipAddress))
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your bank account.\n\n"+
+			"Open this link within %s to choose a new password:\n%s\n\n"+
+			"If it was not you, ignore this email; your password stays the same.\n",
+			PasswordResetTTL(), passwordResetLink(token)),
+	}
+	// Sent in the background so response times do not tell known emails apart
+	go func() {
+		if err := mail.Send(msg); err != nil {
+			log.Printf("Sending password reset mail to user %d failed: %v", userID, err)
+		}
+	}()
+	return nil
+}
+
+// reservePasswordResetRequest counts a request against the limits of
+// PASSWORD_RESET_MAX_PER_EMAIL (default 3) and PASSWORD_RESET_MAX_PER_IP
+// (default 10) per PASSWORD_RESET_WINDOW (default 1h). Unknown emails count
+// the same, so the answer tells nothing about which are registered.
+func reservePasswordResetRequest(email, ipAddress string) error {
+	window := utils.GetEnvDuration("PASSWORD_RESET_WINDOW", time.Hour)
+	maxPerEmail := utils.GetEnvInt("PASSWORD_RESET_MAX_PER_EMAIL", 3)
+	maxPerIP := utils.GetEnvInt("PASSWORD_RESET_MAX_PER_IP", 10)
+
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	// Requests from one IP are counted one at a time
+	if _, err := dbtx.Exec(`SELECT pg_advisory_xact_lock(hashtext('password_reset_ip:' || $1))`, ipAddress); err != nil {
+		return err
+	}
+	var perEmail, perIP int
+	err = dbtx.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE email = $1), COUNT(*) FILTER (WHERE ip_address = $2)
+		FROM password_reset_requests
+		WHERE (email = $1 OR ip_address = $2) AND created_at > NOW() - $3 * INTERVAL '1 second'
+	`, loginKey(email), ipAddress, int64(window/time.Second)).Scan(&perEmail, &perIP)
+	if err != nil {
+		return err
+	}
+	if perEmail >= maxPerEmail || perIP >= maxPerIP {
+		return ErrTooManyResetRequests
+	}
+
+	if _, err := dbtx.Exec(`INSERT INTO password_reset_requests (email, ip_address, created_at) VALUES ($1, $2, NOW())`,
+		loginKey(email), ipAddress); err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// ResetPasswordWithToken sets a new password using an emailed token and
+// signs the user out of every session.
+func ResetPasswordWithToken(token, newPassword string) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	var tokenID, userID uint
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = dbtx.QueryRow(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = $1 FOR UPDATE`,
+		hashToken(token)).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if usedAt.Valid || !expiresAt.After(time.Now()) {
+		return ErrInvalidResetToken
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if _, err := dbtx.Exec(`UPDATE credentials SET password_hash = $1 WHERE user_id = $2`, string(hashed), userID); err != nil {
+		return err
+	}
+	if _, err := dbtx.Exec(`UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1`, tokenID); err != nil {
+		return err
+	}
+	if err := revokeSessions(dbtx, `user_id = $1`, userID, "password reset"); err != nil {
+		return err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&userID, "UPDATE", "credentials", userID, "Password reset with emailed token; all sessions revoked")
+	securityAlert(userID, models.SecurityPasswordChanged)
+	return nil
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"bank/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// BankFeeIncomeAccount collects the fees charged on transfers.
+const BankFeeIncomeAccount = "BANK-FEE-INCOME"
+
+var ErrFeeRuleNotFound = errors.New("fee rule not found")
+
+const feeRuleColumns = `id, name, account_type_id, COALESCE(currency, ''), scope, min_amount, max_amount, flat_fee, percentage, min_fee, max_fee, is_active, created_by, created_at`
+
+func scanFeeRule(row interface{ Scan(...interface{}) error }, r *models.FeeRule) error {
+	var accountTypeID, createdBy sql.NullInt64
+	err := row.Scan(&r.ID, &r.Name, &accountTypeID, &r.Currency, &r.Scope, &r.MinAmount, &r.MaxAmount, &r.FlatFee, &r.Percentage,
+		&r.MinFee, &r.MaxFee, &r.IsActive, &createdBy, &r.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if accountTypeID.Valid {
+		id := uint(accountTypeID.Int64)
+		r.AccountTypeID = &id
+	}
+	if createdBy.Valid {
+		uid := uint(createdBy.Int64)
+		r.CreatedBy = &uid
+	}
+	return nil
+}
+
+// findFeeRule picks the rule for a transfer among those in its currency:
+// account type specific rules win over global ones, a specific scope over
+// ALL, and the band with the highest lower bound over wider ones.
+func findFeeRule(q queryRower, accountTypeID uint, internal bool, amount money.Money) (*models.FeeRule, error) {
+	scope := "EXTERNAL"
+	if internal {
+		scope = "INTERNAL"
+	}
+
+	var r models.FeeRule
+	err := scanFeeRule(q.QueryRow(`
+		SELECT `+feeRuleColumns+`
+		FROM fee_rules
+		WHERE is_active
+		  AND currency = $4
+		  AND (account_type_id IS NULL OR account_type_id = $1)
+		  AND scope IN ('ALL', $2)
+		  AND min_amount <= $3 AND (max_amount IS NULL OR max_amount >= $3)
+		ORDER BY (account_type_id IS NOT NULL) DESC, (scope <> 'ALL') DESC, min_amount DESC, id DESC
+		LIMIT 1
+	`, accountTypeID, scope, amount.Amount, amount.Currency), &r)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// feeFor applies a rule to an amount.
+func feeFor(r *models.FeeRule, amount money.Amount) (money.Amount, error) {
+	percentage, err := parseRate(r.Percentage)
+	if err != nil {
+		return 0, err
+	}
+
+	fee := r.FlatFee.Add(amount.MulRat(percentage))
+	if r.MinFee != nil && fee.Cmp(*r.MinFee) < 0 {
+		fee = *r.MinFee
+	}
+	if r.MaxFee != nil && fee.Cmp(*r.MaxFee) > 0 {
+		fee = *r.MaxFee
+	}
+	return fee, nil
+}
+
+// quoteTransfer prices a transfer between two loaded accounts: the fee in the
+// sender's currency and, across currencies, the conversion of the amount.
+func quoteTransfer(q queryRower, sender, receiver *models.Account, amount money.Money, rateID *uint) (*dtos.TransferQuote, error) {
+	quote := dtos.TransferQuote{
+		Amount:   amount,
+		Fee:      money.New(0, amount.Currency),
+		Total:    amount,
+		Received: amount,
+	}
+
+	rule, err := findFeeRule(q, sender.AccountTypeID, sender.UserID == receiver.UserID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil {
+		fee, err := feeFor(rule, amount.Amount)
+		if err != nil {
+			return nil, err
+		}
+		quote.Fee = money.New(fee, amount.Currency)
+		quote.FeeRuleID = &rule.ID
+		quote.Total = money.New(amount.Amount.Add(fee), amount.Currency)
+	}
+
+	receiverCurrency := money.New(0, receiver.AccountType.Currency).Currency
+	if receiverCurrency != amount.Currency {
+		fx, err := quoteConversion(q, rateID, amount, receiverCurrency)
+		if err != nil {
+			return nil, err
+		}
+		if !fx.To.Amount.IsPositive() {
+			return nil, invalidRequest("amount is too small to convert")
+		}
+		quote.FX = fx
+		quote.Received = fx.To
+	}
+
+	return &quote, nil
+}
+
+// QuoteTransfer shows the fee and, across currencies, the conversion of a
+// transfer from one of the user's accounts before it is executed.
+func QuoteTransfer(from, to string, amount money.Amount, rateID *uint, userID uint) (*dtos.TransferQuote, error) {
+	if !amount.IsPositive() {
+		return nil, errors.New("invalid amount")
+	}
+
+	if err := AuthorizeAccount(from, userID); err != nil {
+		return nil, err
+	}
+
+	var sender, receiver models.Account
+	err := db.DB.QueryRow(`SELECT a.account_number, a.user_id, a.account_type_id, at.currency
+	                       FROM accounts a JOIN account_types at ON at.id = a.account_type_id
+	                       WHERE a.account_number = $1`, from).
+		Scan(&sender.AccountNumber, &sender.UserID, &sender.AccountTypeID, &sender.AccountType.Currency)
+	if err != nil {
+		return nil, errors.New("sender account not found")
+	}
+	err = db.DB.QueryRow(`SELECT a.account_number, a.user_id, a.account_type_id, at.currency
+	                      FROM accounts a JOIN account_types at ON at.id = a.account_type_id
+	                      WHERE a.account_number = $1`, to).
+		Scan(&receiver.AccountNumber, &receiver.UserID, &receiver.AccountTypeID, &receiver.AccountType.Currency)
+	if err != nil {
+		return nil, errors.New("receiver account not found")
+	}
+	if sender.AccountNumber == receiver.AccountNumber {
+		return nil, errors.New("cannot transfer to self")
+	}
+
+	return quoteTransfer(db.DB, &sender, &receiver, money.New(amount, sender.AccountType.Currency), rateID)
+}
+
+// postTransferFee books the fee of a transfer as its own journal entry and
+// FEE row, linked to the DEBIT row of the transfer.
+func postTransferFee(dbtx *sql.Tx, sender *models.Account, receiver string, fee money.Money, transferID uint) error {
+	description := fmt.Sprintf("Fee for transfer to %s", receiver)
+	entry := models.JournalEntry{
+		Reference:   "FEE",
+		Description: description,
+		Postings: []models.Posting{
+			{AccountNumber: sender.AccountNumber, Amount: fee.Amount.Neg(), Currency: fee.Currency},
+			{AccountNumber: BankFeeIncomeAccount, Amount: fee.Amount, Currency: fee.Currency},
+		},
+	}
+	if err := PostJournalEntry(dbtx, &entry); err != nil {
+		return err
+	}
+
+	_, err := dbtx.Exec(`INSERT INTO transactions (account_id, transaction_type, amount, currency, description, user_id, journal_entry_id, fee_of_id, transaction_date)
+	                     VALUES ($1, 'FEE', $2, $3, $4, $5, $6, $7, NOW())`,
+		sender.AccountNumber, fee.Amount, fee.Currency, description, sender.UserID, entry.ID, transferID)
+	return err
+}
+
+func validateFeeRule(r *models.FeeRule) error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+
+	r.Scope = strings.ToUpper(strings.TrimSpace(r.Scope))
+	if r.Scope == "" {
+		r.Scope = "ALL"
+	}
+	if r.Scope != "ALL" && r.Scope != "INTERNAL" && r.Scope != "EXTERNAL" {
+		return errors.New("scope must be ALL, INTERNAL or EXTERNAL")
+	}
+
+	if r.Percentage == "" {
+		r.Percentage = "0"
+	}
+	percentage, err := parseRate(r.Percentage)
+	if err != nil {
+		return err
+	}
+	if percentage.Sign() < 0 || percentage.Cmp(big.NewRat(1, 1)) >= 0 {
+		return errors.New("percentage must be between 0 and 1")
+	}
+
+	if r.MinAmount.IsNegative() || r.FlatFee.IsNegative() {
+		return errors.New("amounts cannot be negative")
+	}
+	if r.MaxAmount != nil && r.MaxAmount.Cmp(r.MinAmount) < 0 {
+		return errors.New("max_amount must not be below min_amount")
+	}
+	if r.MinFee != nil && r.MinFee.IsNegative() {
+		return errors.New("min_fee cannot be negative")
+	}
+	if r.MaxFee != nil && r.MaxFee.IsNegative() {
+		return errors.New("max_fee cannot be negative")
+	}
+	if r.MaxFee != nil && r.MaxFee.Cmp(r.FlatFee) < 0 {
+		return errors.New("max_fee must not be below flat_fee")
+	}
+	if r.MinFee != nil && r.MaxFee != nil && r.MaxFee.Cmp(*r.MinFee) < 0 {
+		return errors.New("max_fee must not be below min_fee")
+	}
+	return nil
+}
+
+// feeRuleCurrency settles the currency of a rule: an account type rule is
+// priced in the currency of its type, a global rule has to name one.
+func feeRuleCurrency(q queryRower, r *models.FeeRule) error {
+	r.Currency = strings.ToUpper(strings.TrimSpace(r.Currency))
+	if r.AccountTypeID == nil {
+		if r.Currency == "" {
+			return errors.New("currency is required for rules that apply to every account type")
+		}
+		return nil
+	}
+
+	var currency string
+	err := q.QueryRow(`SELECT UPPER(currency) FROM account_types WHERE id = $1`, *r.AccountTypeID).Scan(&currency)
+	if err == sql.ErrNoRows {
+		return errors.New("account type not found")
+	}
+	if err != nil {
+		return err
+	}
+	if r.Currency != "" && r.Currency != currency {
+		return fmt.Errorf("accounts of this type are held in %s", currency)
+	}
+	r.Currency = currency
+	return nil
+}
+
+// CreateFeeRule adds a pricing rule.
+func CreateFeeRule(r *models.FeeRule, adminID uint) error {
+	if err := validateFeeRule(r); err != nil {
+		return err
+	}
+	if err := feeRuleCurrency(db.DB, r); err != nil {
+		return err
+	}
+
+	r.IsActive = true
+	r.CreatedBy = &adminID
+	err := db.DB.QueryRow(`
+		INSERT INTO fee_rules (name, account_type_id, currency, scope, min_amount, max_amount, flat_fee, percentage, min_fee, max_fee, is_active, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, TRUE, $11, NOW())
+		RETURNING id, created_at
+	`, r.Name, r.AccountTypeID, r.Currency, r.Scope, r.MinAmount, r.MaxAmount, r.FlatFee, r.Percentage, r.MinFee, r.MaxFee, adminID).
+		Scan(&r.ID, &r.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "CREATE", "fee_rules", r.ID, fmt.Sprintf("Created fee rule %q", r.Name))
+	return nil
+}
+
+// GetFeeRules lists all pricing rules.
+func GetFeeRules() ([]models.FeeRule, error) {
+	rows, err := db.DB.Query(`SELECT ` + feeRuleColumns + ` FROM fee_rules ORDER BY account_type_id NULLS FIRST, currency, scope, min_amount, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.FeeRule{}
+	for rows.Next() {
+		var r models.FeeRule
+		if err := scanFeeRule(rows, &r); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// UpdateFeeRule replaces a rule. isActive switches it on or off; nil leaves
+// it as it is.
+func UpdateFeeRule(id uint, r *models.FeeRule, isActive *bool, adminID uint) error {
+	if err := validateFeeRule(r); err != nil {
+		return err
+	}
+	if err := feeRuleCurrency(db.DB, r); err != nil {
+		return err
+	}
+
+	var createdBy sql.NullInt64
+	err := db.DB.QueryRow(`
+		UPDATE fee_rules
+		SET name = $1, account_type_id = $2, currency = $3, scope = $4, min_amount = $5, max_amount = $6,
+		    flat_fee = $7, percentage = $8, min_fee = $9, max_fee = $10, is_active = COALESCE($11, is_active)
+		WHERE id = $12
+		RETURNING is_active, created_by, created_at
+	`, r.Name, r.AccountTypeID, r.Currency, r.Scope, r.MinAmount, r.MaxAmount, r.FlatFee, r.Percentage, r.MinFee, r.MaxFee, isActive, id).
+		Scan(&r.IsActive, &createdBy, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrFeeRuleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	r.ID = id
+	r.CreatedBy = nil
+	if createdBy.Valid {
+		uid := uint(createdBy.Int64)
+		r.CreatedBy = &uid
+	}
+
+	_ = LogAudit(&adminID, "UPDATE", "fee_rules", id, fmt.Sprintf("Updated fee rule %q", r.Name))
+	return nil
+}
+
+// DeleteFeeRule removes a rule. Fees already charged are not affected.
+func DeleteFeeRule(id uint, adminID uint) error {
+	result, err := db.DB.Exec(`DELETE FROM fee_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrFeeRuleNotFound
+	}
+
+	_ = LogAudit(&adminID, "DELETE", "fee_rules", id, "Deleted fee rule")
+	return nil
+}
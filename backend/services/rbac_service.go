@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// userRoles lists the names of all roles a user holds.
+func userRoles(q queryRower, userID uint) ([]string, error) {
+	var roles pq.StringArray
+	err := q.QueryRow(`
+		SELECT COALESCE(array_agg(r.name ORDER BY r.name), '{}')
+		FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+	`, userID).Scan(&roles)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, errors.New("user role not found")
+	}
+	return roles, nil
+}
+
+// UserPermissions is the union of the permissions of the user's roles.
+func UserPermissions(userID uint) ([]string, error) {
+	var permissions pq.StringArray
+	err := db.DB.QueryRow(`
+		SELECT COALESCE(array_agg(DISTINCT p.name), '{}')
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = $1
+	`, userID).Scan(&permissions)
+	return permissions, err
+}
+
+// GetPermissions lists every permission that can be granted.
+func GetPermissions() ([]models.Permission, error) {
+	rows, err := db.DB.Query(`SELECT id, name, COALESCE(description, '') FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []models.Permission{}
+	for rows.Next() {
+		var p models.Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// GetRolesWithPermissions lists all roles with what they grant.
+func GetRolesWithPermissions() ([]dtos.RoleWithPermissions, error) {
+	rows, err := db.DB.Query(`
+		SELECT r.id, r.name,
+		       COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}'),
+		       (SELECT COUNT(*) FROM user_roles ur WHERE ur.role_id = r.id)
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		GROUP BY r.id
+		ORDER BY r.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []dtos.RoleWithPermissions{}
+	for rows.Next() {
+		var r dtos.RoleWithPermissions
+		var permissions pq.StringArray
+		if err := rows.Scan(&r.ID, &r.Name, &permissions, &r.UserCount); err != nil {
+			return nil, err
+		}
+		r.Permissions = permissions
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// setRolePermissions replaces the grants of a role. Unknown permission
+// names are refused rather than ignored.
+func setRolePermissions(dbtx *sql.Tx, roleID uint, permissions []string) error {
+	var ids pq.Int64Array
+	var unknown pq.StringArray
+	err := dbtx.QueryRow(`
+		SELECT COALESCE(array_agg(p.id) FILTER (WHERE p.id IS NOT NULL), '{}'),
+		       COALESCE(array_agg(n.name) FILTER (WHERE p.id IS NULL), '{}')
+		FROM unnest($1::text[]) AS n(name)
+		LEFT JOIN permissions p ON p.name = n.name
+	`, pq.Array(permissions)).Scan(&ids, &unknown)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown permissions: %s", strings.Join(unknown, ", "))
+	}
+
+	if _, err := dbtx.Exec(`DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return err
+	}
+	_, err = dbtx.Exec(`
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, unnest($2::int[])
+		ON CONFLICT DO NOTHING
+	`, roleID, ids)
+	return err
+}
+
+// ensureRoleManager fails unless someone still holds roles:manage, so that
+// someone can still fix roles after a change. Role changes are serialised on
+// an advisory lock first, so two of them can't each leave the other as the
+// last manager.
+func ensureRoleManager(q sqlExecutor) error {
+	if _, err := q.Exec(`SELECT pg_advisory_xact_lock(hashtext('role_managers'))`); err != nil {
+		return err
+	}
+
+	var managers int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE p.name = $1
+	`, models.PermRolesManage).Scan(&managers)
+	if err != nil {
+		return err
+	}
+	if managers == 0 {
+		return fmt.Errorf("at least one user must keep the %s permission", models.PermRolesManage)
+	}
+	return nil
+}
+
+// SetRolePermissions replaces everything a role grants. Holders of the role
+// are affected on their next request.
+func SetRolePermissions(roleID uint, permissions []string, adminID uint) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	var name string
+	err = dbtx.QueryRow(`SELECT name FROM roles WHERE id = $1 FOR UPDATE`, roleID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := setRolePermissions(dbtx, roleID, permissions); err != nil {
+		return err
+	}
+
+	if err := ensureRoleManager(dbtx); err != nil {
+		return err
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "UPDATE", "role_permissions", roleID,
+		fmt.Sprintf("Set permissions of role %q to [%s]", name, strings.Join(permissions, ", ")))
+	return nil
+}
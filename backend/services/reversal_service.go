@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	ErrAlreadyReversed   = errors.New("transaction has already been reversed")
+	ErrNotRefundable     = errors.New("only the recipient of a transfer can refund it")
+	ErrReversalTooLarge  = errors.New("amount exceeds what is left to give back on this transaction")
+	ErrNotATransfer      = errors.New("only transfers can be reversed or refunded")
+	ErrReversalNoBalance = errors.New("recipient has insufficient balance to give the money back")
+	ErrReversalTooSmall  = errors.New("amount is too small to give back in the recipient's currency")
+	ErrAccountInactive   = errors.New("both accounts must be active")
+)
+
+// ReverseTransaction is the admin correction of a mistaken transfer. A
+// transfer can be reversed once; amount defaults to everything not yet
+// refunded.
+func ReverseTransaction(transactionID uint, amount *money.Amount, reason string, adminID uint) (*models.Transaction, error) {
+	return compensateTransfer(transactionID, amount, reason, adminID, "REVERSAL")
+}
+
+// RefundTransaction lets the recipient of a transfer send (part of) it back.
+// Refunds may be repeated until the original amount is used up.
+func RefundTransaction(transactionID uint, amount *money.Amount, reason string, userID uint) (*models.Transaction, error) {
+	return compensateTransfer(transactionID, amount, reason, userID, "REFUND")
+}
+
+// compensateTransfer books a linked transfer in the opposite direction of
+// the original. The original rows and postings are left untouched apart
+// from the running reversed_amount on the DEBIT row.
+func compensateTransfer(transactionID uint, amount *money.Amount, reason string, actorID uint, kind string) (*models.Transaction, error) {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			dbtx.Rollback()
+			panic(p)
+		}
+	}()
+
+	// Fetch the DEBIT row of the transfer, whichever of its rows was given
+	var original models.Transaction
+	err = dbtx.QueryRow(`
+		SELECT id, account_id, to_account_id, amount, COALESCE(currency, ''), counter_amount, counter_currency, reversed_amount
+		FROM transactions
+		WHERE transaction_type = 'DEBIT'
+		  AND (id = $1 OR journal_entry_id = (
+		      SELECT journal_entry_id FROM transactions WHERE id = $1 AND journal_entry_id IS NOT NULL))
+		FOR UPDATE
+	`, transactionID).Scan(&original.ID, &original.AccountID, &original.ToAccountID, &original.Amount, &original.Currency,
+		&original.CounterAmount, &original.CounterCurrency, &original.ReversedAmount)
+	if err == sql.ErrNoRows {
+		dbtx.Rollback()
+		return nil, ErrNotATransfer
+	}
+	if err != nil {
+		dbtx.Rollback()
+		return nil, err
+	}
+	if original.ToAccountID == nil {
+		dbtx.Rollback()
+		return nil, ErrNotATransfer
+	}
+
+	// Lock both parties in the same order transfers take them; money
+	// leaves the recipient and arrives at the sender
+	accounts, err := lockAccounts(dbtx, original.AccountID, *original.ToAccountID)
+	if err != nil {
+		dbtx.Rollback()
+		return nil, err
+	}
+	sender, receiver := accounts[original.AccountID], accounts[*original.ToAccountID]
+	if sender == nil {
+		dbtx.Rollback()
+		return nil, fmt.Errorf("sender account %s not found", original.AccountID)
+	}
+	if receiver == nil {
+		dbtx.Rollback()
+		return nil, fmt.Errorf("receiver account %s not found", *original.ToAccountID)
+	}
+	if !sender.IsActive || !receiver.IsActive {
+		dbtx.Rollback()
+		return nil, ErrAccountInactive
+	}
+
+	if kind == "REFUND" && receiver.UserID != actorID {
+		dbtx.Rollback()
+		return nil, ErrNotRefundable
+	}
+	if kind == "REVERSAL" {
+		var reversed bool
+		err = dbtx.QueryRow(`SELECT EXISTS(SELECT 1 FROM transactions WHERE reversal_of_id = $1 AND transaction_type = 'REVERSAL')`, original.ID).
+			Scan(&reversed)
+		if err != nil {
+			dbtx.Rollback()
+			return nil, err
+		}
+		if reversed {
+			dbtx.Rollback()
+			return nil, ErrAlreadyReversed
+		}
+	}
+
+	if original.Currency == "" {
+		original.Currency = sender.AccountType.Currency
+	}
+
+	remaining := original.Amount.Sub(original.ReversedAmount)
+	if !remaining.IsPositive() {
+		dbtx.Rollback()
+		return nil, ErrAlreadyReversed
+	}
+	back := remaining
+	if amount != nil {
+		back = *amount
+	}
+	if !back.IsPositive() {
+		dbtx.Rollback()
+		return nil, errors.New("invalid amount")
+	}
+	if back.Cmp(remaining) > 0 {
+		dbtx.Rollback()
+		return nil, ErrReversalTooLarge
+	}
+
+	// What goes back to the sender, in the sender's currency, and what
+	// leaves the recipient, in theirs. FX transfers unwind at the original
+	// rate; the spread already earned is not returned. Each partial refund
+	// takes its share of what the recipient has not yet given back, and the
+	// last one takes all of it, so the rounding never adds up to more or
+	// less than the original counter amount.
+	toSender := money.New(back, original.Currency)
+	fromReceiver := toSender
+	if original.CounterAmount != nil && original.CounterCurrency != nil {
+		var returned money.Amount
+		err = dbtx.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE reversal_of_id = $1 AND account_id = $2`,
+			original.ID, receiver.AccountNumber).Scan(&returned)
+		if err != nil {
+			dbtx.Rollback()
+			return nil, err
+		}
+		counterLeft := original.CounterAmount.Sub(returned)
+		if back.Cmp(remaining) < 0 {
+			share := new(big.Rat).SetFrac(big.NewInt(back.Minor()), big.NewInt(remaining.Minor()))
+			counterLeft = counterLeft.MulRat(share)
+		}
+		fromReceiver = money.New(counterLeft, *original.CounterCurrency)
+		if !fromReceiver.Amount.IsPositive() {
+			dbtx.Rollback()
+			return nil, ErrReversalTooSmall
+		}
+	}
+	if receiver.Balance.Cmp(fromReceiver.Amount) < 0 {
+		dbtx.Rollback()
+		return nil, ErrReversalNoBalance
+	}
+
+	postings := []models.Posting{
+		{AccountNumber: receiver.AccountNumber, Amount: fromReceiver.Amount.Neg(), Currency: fromReceiver.Currency},
+		{AccountNumber: sender.AccountNumber, Amount: toSender.Amount, Currency: toSender.Currency},
+	}
+	if fromReceiver.Currency != toSender.Currency {
+		postings = []models.Posting{
+			postings[0],
+			{AccountNumber: BankFXPositionAccount, Amount: fromReceiver.Amount, Currency: fromReceiver.Currency},
+			{AccountNumber: BankFXPositionAccount, Amount: toSender.Amount.Neg(), Currency: toSender.Currency},
+			postings[1],
+		}
+	}
+
+	description := fmt.Sprintf("%s of transaction %d", kind, original.ID)
+	if reason != "" {
+		description += ": " + reason
+	}
+
+	entry := models.JournalEntry{
+		Reference:   kind,
+		Description: description,
+		Postings:    postings,
+	}
+	if err := PostJournalEntry(dbtx, &entry); err != nil {
+		dbtx.Rollback()
+		return nil, err
+	}
+
+	// Compensating rows: money leaves the recipient and arrives at the sender
+
+	compensation := models.Transaction{
+		UserID:          receiver.UserID,
+		AccountID:       receiver.AccountNumber,
+		ToAccountID:     &sender.AccountNumber,
+		TransactionType: kind,
+		Amount:          fromReceiver.Amount,
+		Currency:        fromReceiver.Currency,
+		Description:     description,
+		ReversalOfID:    &original.ID,
+	}
+	err = dbtx.QueryRow(`INSERT INTO transactions (account_id, to_account_id, transaction_type, amount, currency, description, user_id, journal_entry_id, reversal_of_id, transaction_date)
+	                     VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+	                     RETURNING id, transaction_date`,
+		receiver.AccountNumber, sender.AccountNumber, kind, fromReceiver.Amount, fromReceiver.Currency, description, receiver.UserID, entry.ID, original.ID).
+		Scan(&compensation.ID, &compensation.TransactionDate)
+	if err != nil {
+		dbtx.Rollback()
+		return nil, err
+	}
+
+	_, err = dbtx.Exec(`INSERT INTO transactions (account_id, to_account_id, transaction_type, amount, currency, description, user_id, journal_entry_id, reversal_of_id, transaction_date)
+	                    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())`,
+		sender.AccountNumber, receiver.AccountNumber, kind, toSender.Amount, toSender.Currency, description, sender.UserID, entry.ID, original.ID)
+	if err != nil {
+		dbtx.Rollback()
+		return nil, err
+	}
+
+	_, err = dbtx.Exec(`UPDATE transactions SET reversed_amount = reversed_amount + $1 WHERE id = $2`, back, original.ID)
+	if err != nil {
+		dbtx.Rollback()
+		return nil, err
+	}
+
+	err = recordEvent(dbtx, models.EventTransactionReversed, "transaction", original.ID, &actorID, map[string]interface{}{
+		"kind":              kind,
+		"transaction_id":    original.ID,
+		"compensation_id":   compensation.ID,
+		"sender_account":    sender.AccountNumber,
+		"receiver_account":  receiver.AccountNumber,
+		"sender_user_id":    sender.UserID,
+		"receiver_user_id":  receiver.UserID,
+		"sender_amount":     toSender.Amount.String(),
+		"sender_currency":   toSender.Currency,
+		"receiver_amount":   fromReceiver.Amount.String(),
+		"receiver_currency": fromReceiver.Currency,
+		"reason":            reason,
+	})
+	if err != nil {
+		dbtx.Rollback()
+		return nil, err
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &compensation, nil
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/utils"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+)
+
+// RefreshTokenTTL is how long an unused refresh token stays valid. Every
+// refresh issues a new one, so an active session never expires.
+func RefreshTokenTTL() time.Duration {
+	return utils.GetEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// randomToken returns 256 random bits for use as a bearer secret.
+func randomToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashToken is how bearer secrets are stored, so a database leak does not
+// leak usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens stores a new refresh token for the session and signs an
+// access token for it.
+func issueTokens(dbtx *sql.Tx, sessionID, userID uint, roles []string) (*dtos.TokenPair, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dbtx.Exec(`INSERT INTO refresh_tokens (session_id, token_hash, created_at, expires_at) VALUES ($1, $2, NOW(), $3)`,
+		sessionID, hashToken(refreshToken), time.Now().Add(RefreshTokenTTL()))
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateJWT(userID, roles, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &dtos.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.AccessTokenTTL() / time.Second),
+	}, nil
+}
+
+// StartSession opens a session for a user who just logged in.
+func StartSession(userID uint, roles []string, userAgent, ipAddress string) (*dtos.TokenPair, error) {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	var sessionID uint
+	err = dbtx.QueryRow(`INSERT INTO sessions (user_id, user_agent, ip_address, created_at, last_used_at)
+	                     VALUES ($1, $2, $3, NOW(), NOW()) RETURNING id`,
+		userID, userAgent, ipAddress).Scan(&sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := issueTokens(dbtx, sessionID, userID, roles)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new
+// refresh token. Presenting a token that was already exchanged means it was
+// copied, so the whole session is revoked.
+func RefreshSession(refreshToken string) (*dtos.TokenPair, error) {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	var tokenID, sessionID, userID uint
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	var isActive bool
+	err = dbtx.QueryRow(`
+		SELECT rt.id, rt.session_id, rt.expires_at, rt.used_at, s.user_id, s.revoked_at, COALESCE(u.is_active, FALSE)
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		JOIN users u ON u.id = s.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`, hashToken(refreshToken)).Scan(&tokenID, &sessionID, &expiresAt, &usedAt, &userID, &revokedAt, &isActive)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if usedAt.Valid {
+		if err := revokeSessions(dbtx, `id = $1`, sessionID, "refresh token reuse"); err != nil {
+			return nil, err
+		}
+		if err := dbtx.Commit(); err != nil {
+			return nil, err
+		}
+		_ = LogAudit(&userID, "UPDATE", "sessions", sessionID, fmt.Sprintf("Revoked session %d after refresh token reuse", sessionID))
+		return nil, ErrRefreshTokenReused
+	}
+
+	if !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !isActive {
+		return nil, errors.New("account is deactivated")
+	}
+
+	if _, err := dbtx.Exec(`UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, tokenID); err != nil {
+		return nil, err
+	}
+	if _, err := dbtx.Exec(`UPDATE sessions SET last_used_at = NOW() WHERE id = $1`, sessionID); err != nil {
+		return nil, err
+	}
+
+	roles, err := userRoles(dbtx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := issueTokens(dbtx, sessionID, userID, roles)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// SessionPermissions resolves the permissions behind an access token. ok
+// is false when the session was revoked or its user deactivated, in which
+// case the token must be refused.
+func SessionPermissions(sessionID, userID uint) ([]string, bool, error) {
+	var active bool
+	var permissions pq.StringArray
+	err := db.DB.QueryRow(`
+		SELECT s.revoked_at IS NULL AND COALESCE(u.is_active, FALSE),
+		       COALESCE(array_agg(DISTINCT p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN user_roles ur ON ur.user_id = s.user_id
+		LEFT JOIN role_permissions rp ON rp.role_id = ur.role_id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE s.id = $1 AND s.user_id = $2
+		GROUP BY s.revoked_at, u.is_active
+	`, sessionID, userID).Scan(&active, &permissions)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !active {
+		return nil, false, nil
+	}
+	return permissions, true, nil
+}
+
+// RevokeSession ends one session, e.g. on logout.
+func RevokeSession(sessionID uint, reason string) error {
+	return revokeSessions(db.DB, `id = $1`, sessionID, reason)
+}
+
+// RevokeUserSessions ends every session of a user.
+func RevokeUserSessions(userID uint, reason string) error {
+	return revokeSessions(db.DB, `user_id = $1`, userID, reason)
+}
+
+func revokeSessions(q interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, where string, target interface{}, reason string) error {
+	_, err := q.Exec(`UPDATE sessions SET revoked_at = NOW(), revoked_reason = $2 WHERE revoked_at IS NULL AND `+where, target, reason)
+	return err
+}
@@ -0,0 +1,418 @@
+package services
+
+import (
+	"bank/db"
+	"bank/models"
+	"bank/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrStandingOrderNotFound = errors.New("standing order not found")
+
+const standingOrderColumns = `id, user_id, from_account_id, to_account_id, amount, COALESCE(description, ''), frequency,
+	start_at, end_date, max_runs, occurrences, next_run_at, retry_at, retry_count, status, last_run_at, last_error, created_at`
+
+func scanStandingOrder(row interface{ Scan(...interface{}) error }, o *models.StandingOrder) error {
+	return row.Scan(&o.ID, &o.UserID, &o.FromAccountID, &o.ToAccountID, &o.Amount, &o.Description, &o.Frequency,
+		&o.StartAt, &o.EndDate, &o.MaxRuns, &o.Occurrences, &o.NextRunAt, &o.RetryAt, &o.RetryCount, &o.Status,
+		&o.LastRunAt, &o.LastError, &o.CreatedAt)
+}
+
+// occurrenceAt returns the n-th (0-based) run of a schedule. Monthly runs
+// keep the start day and fall back to the last day of shorter months.
+func occurrenceAt(start time.Time, frequency string, n int) time.Time {
+	switch frequency {
+	case "DAILY":
+		return start.AddDate(0, 0, n)
+	case "WEEKLY":
+		return start.AddDate(0, 0, 7*n)
+	case "MONTHLY":
+		firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(n), 1,
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+		day := start.Day()
+		if day > lastDay {
+			day = lastDay
+		}
+		return firstOfMonth.AddDate(0, 0, day-1)
+	}
+	return start
+}
+
+// isFinished reports whether a schedule has no run left after occurrences runs.
+func isFinished(o *models.StandingOrder) bool {
+	if o.Frequency == "ONCE" {
+		return o.Occurrences >= 1
+	}
+	if o.MaxRuns != nil && o.Occurrences >= *o.MaxRuns {
+		return true
+	}
+	if o.EndDate != nil && occurrenceAt(o.StartAt, o.Frequency, o.Occurrences).After(*o.EndDate) {
+		return true
+	}
+	return false
+}
+
+// CreateStandingOrder validates and stores a new order for order.UserID, who
+// must own the account the money is taken from.
+func CreateStandingOrder(order *models.StandingOrder) error {
+	order.Frequency = strings.ToUpper(order.Frequency)
+	switch order.Frequency {
+	case "ONCE", "DAILY", "WEEKLY", "MONTHLY":
+	default:
+		return errors.New("frequency must be ONCE, DAILY, WEEKLY or MONTHLY")
+	}
+	if !order.Amount.IsPositive() {
+		return errors.New("invalid amount")
+	}
+	if order.FromAccountID == order.ToAccountID {
+		return errors.New("cannot transfer to self")
+	}
+	if order.StartAt.IsZero() {
+		order.StartAt = time.Now()
+	}
+	if order.StartAt.Before(time.Now().Add(-time.Minute)) {
+		return errors.New("start_at must not be in the past")
+	}
+	if order.EndDate != nil && order.EndDate.Before(order.StartAt) {
+		return errors.New("end_date must be after start_at")
+	}
+	if order.MaxRuns != nil && *order.MaxRuns < 1 {
+		return errors.New("max_runs must be at least 1")
+	}
+
+	if err := AuthorizeAccount(order.FromAccountID, order.UserID); err != nil {
+		return err
+	}
+	var exists bool
+	err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM accounts WHERE account_number = $1)`, order.ToAccountID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("destination account not found")
+	}
+
+	order.Status = "ACTIVE"
+	order.NextRunAt = order.StartAt
+	err = db.DB.QueryRow(`
+		INSERT INTO standing_orders (user_id, from_account_id, to_account_id, amount, description, frequency,
+		                             start_at, end_date, max_runs, next_run_at, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+		RETURNING id, created_at
+	`, order.UserID, order.FromAccountID, order.ToAccountID, order.Amount, order.Description, order.Frequency,
+		order.StartAt, order.EndDate, order.MaxRuns, order.NextRunAt, order.Status).Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_ = LogAudit(&order.UserID, "CREATE", "standing_orders", order.ID,
+		fmt.Sprintf("%s standing order of %s from %s to %s", order.Frequency, order.Amount, order.FromAccountID, order.ToAccountID))
+	return nil
+}
+
+// GetStandingOrdersByUserID lists a user's orders, newest first.
+func GetStandingOrdersByUserID(userID uint) ([]models.StandingOrder, error) {
+	rows, err := db.DB.Query(`SELECT `+standingOrderColumns+` FROM standing_orders WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.StandingOrder{}
+	for rows.Next() {
+		var o models.StandingOrder
+		if err := scanStandingOrder(rows, &o); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+
+	return orders, rows.Err()
+}
+
+// PauseStandingOrder stops an active order from running until it is resumed.
+func PauseStandingOrder(id, userID uint) error {
+	return setStandingOrderStatus(id, userID, []string{"ACTIVE"}, "PAUSED")
+}
+
+// CancelStandingOrder ends an order for good.
+func CancelStandingOrder(id, userID uint) error {
+	return setStandingOrderStatus(id, userID, []string{"ACTIVE", "PAUSED"}, "CANCELLED")
+}
+
+func setStandingOrderStatus(id, userID uint, from []string, to string) error {
+	result, err := db.DB.Exec(`
+		UPDATE standing_orders SET status = $1
+		WHERE id = $2 AND user_id = $3 AND status = ANY($4)
+	`, to, id, userID, pq.Array(from))
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrStandingOrderNotFound
+	}
+
+	_ = LogAudit(&userID, "UPDATE", "standing_orders", id, "Standing order "+strings.ToLower(to))
+	return nil
+}
+
+// skipMissedRuns moves a recurring order past the runs whose time has gone
+// by. Missed runs, whether the order was paused or the job was not running,
+// are never made up: the schedule carries on with the next run still ahead
+// and the owner is told how many were skipped. dbtx must hold the lock on
+// the order.
+func skipMissedRuns(dbtx *sql.Tx, o *models.StandingOrder, now time.Time) error {
+	if o.Frequency == "ONCE" {
+		return nil
+	}
+
+	skipped := 0
+	for !isFinished(o) && occurrenceAt(o.StartAt, o.Frequency, o.Occurrences).Before(now) {
+		o.Occurrences++
+		skipped++
+	}
+	if skipped == 0 {
+		return nil
+	}
+
+	var nextRunAt interface{}
+	if !isFinished(o) {
+		nextRunAt = occurrenceAt(o.StartAt, o.Frequency, o.Occurrences).Format("2006-01-02 15:04")
+	}
+	return recordEvent(dbtx, models.EventStandingOrderSkipped, "standing_order", o.ID, nil, map[string]interface{}{
+		"standing_order_id": o.ID,
+		"user_id":           o.UserID,
+		"to_account":        o.ToAccountID,
+		"skipped":           skipped,
+		"next_run_at":       nextRunAt,
+	})
+}
+
+// ResumeStandingOrder re-activates a paused order. Recurring runs that were
+// missed while paused are skipped, see skipMissedRuns.
+func ResumeStandingOrder(id, userID uint) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	var o models.StandingOrder
+	err = scanStandingOrder(dbtx.QueryRow(`SELECT `+standingOrderColumns+` FROM standing_orders
+		WHERE id = $1 AND user_id = $2 AND status = 'PAUSED' FOR UPDATE`, id, userID), &o)
+	if err == sql.ErrNoRows {
+		return ErrStandingOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := skipMissedRuns(dbtx, &o, time.Now()); err != nil {
+		return err
+	}
+	o.Status = "ACTIVE"
+	if isFinished(&o) {
+		o.Status = "COMPLETED"
+	}
+
+	_, err = dbtx.Exec(`
+		UPDATE standing_orders
+		SET status = $1, occurrences = $2, next_run_at = $3, retry_at = NULL, retry_count = 0
+		WHERE id = $4
+	`, o.Status, o.Occurrences, occurrenceAt(o.StartAt, o.Frequency, o.Occurrences), id)
+	if err != nil {
+		return err
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&userID, "UPDATE", "standing_orders", id, "Standing order resumed")
+	return nil
+}
+
+// ExecuteDueStandingOrders runs every active order whose run (or retry) is
+// due. Failed runs are retried STANDING_ORDER_MAX_RETRIES times,
+// STANDING_ORDER_RETRY_DELAY apart, before the run is given up on.
+func ExecuteDueStandingOrders() {
+	rows, err := db.DB.Query(`
+		SELECT id FROM standing_orders
+		WHERE status = 'ACTIVE' AND COALESCE(retry_at, next_run_at) <= NOW()
+		ORDER BY COALESCE(retry_at, next_run_at)
+	`)
+	if err != nil {
+		log.Println("Failed to fetch due standing orders:", err)
+		return
+	}
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			log.Println("Failed to scan standing order:", err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := executeStandingOrder(id); err != nil {
+			log.Printf("Standing order %d failed: %v\n", id, err)
+		}
+	}
+}
+
+// executeStandingOrder runs one due order. The returned error is the
+// transfer failure, already recorded on the order.
+func executeStandingOrder(id uint) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			dbtx.Rollback()
+			panic(p)
+		}
+	}()
+
+	// Lock the order; another instance may be running the same job
+	var o models.StandingOrder
+	err = scanStandingOrder(dbtx.QueryRow(`SELECT `+standingOrderColumns+` FROM standing_orders
+		WHERE id = $1 AND status = 'ACTIVE' AND COALESCE(retry_at, next_run_at) <= NOW()
+		FOR UPDATE SKIP LOCKED`, id), &o)
+	if err != nil {
+		dbtx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+
+	description := o.Description
+	if description == "" {
+		description = fmt.Sprintf("Standing order #%d", o.ID)
+	}
+	tx := &models.Transaction{
+		UserID:      o.UserID,
+		AccountID:   o.FromAccountID,
+		ToAccountID: &o.ToAccountID,
+		Amount:      o.Amount,
+		Description: description,
+	}
+
+	// A failed run is rolled back to here and recorded while the order is
+	// still locked, so no other instance can run it in between
+	if _, err := dbtx.Exec(`SAVEPOINT standing_order_run`); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
+	// The source account must still belong to the user who set up the order
+	var ownerID uint
+	err = dbtx.QueryRow(`SELECT user_id FROM accounts WHERE account_number = $1`, o.FromAccountID).Scan(&ownerID)
+	if err == nil && ownerID != o.UserID {
+		err = errors.New("source account no longer belongs to the order owner")
+	}
+
+	if err == nil {
+		err = executeTransfer(dbtx, tx)
+	}
+	if err != nil {
+		cause := err
+		if _, err := dbtx.Exec(`ROLLBACK TO SAVEPOINT standing_order_run`); err != nil {
+			dbtx.Rollback()
+			return err
+		}
+		if err := recordStandingOrderFailure(dbtx, &o, cause); err != nil {
+			dbtx.Rollback()
+			return err
+		}
+		if err := dbtx.Commit(); err != nil {
+			return err
+		}
+		return cause
+	}
+
+	// One run per pickup; any others that fell due meanwhile are skipped
+	o.Occurrences++
+	if err := skipMissedRuns(dbtx, &o, time.Now()); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	o.Status = "ACTIVE"
+	if isFinished(&o) {
+		o.Status = "COMPLETED"
+	}
+	_, err = dbtx.Exec(`
+		UPDATE standing_orders
+		SET occurrences = $1, next_run_at = $2, status = $3, retry_at = NULL, retry_count = 0,
+		    last_run_at = NOW(), last_error = NULL
+		WHERE id = $4
+	`, o.Occurrences, occurrenceAt(o.StartAt, o.Frequency, o.Occurrences), o.Status, o.ID)
+	if err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
+	return dbtx.Commit()
+}
+
+// recordStandingOrderFailure schedules a retry, or gives up on this run once
+// the retries are used up, and tells the owner either way. dbtx must hold
+// the lock on the order.
+func recordStandingOrderFailure(dbtx *sql.Tx, o *models.StandingOrder, cause error) error {
+	maxRetries := utils.GetEnvInt("STANDING_ORDER_MAX_RETRIES", 3)
+	retryDelay := utils.GetEnvDuration("STANDING_ORDER_RETRY_DELAY", time.Hour)
+
+	o.RetryCount++
+	payload := map[string]interface{}{
+		"standing_order_id": o.ID,
+		"to_account":        o.ToAccountID,
+		"reason":            cause.Error(),
+		"retry_at":          nil,
+		"max_retries":       maxRetries,
+	}
+	var retryAt *time.Time
+	if o.RetryCount <= maxRetries {
+		next := time.Now().Add(retryDelay)
+		retryAt = &next
+		payload["retry_at"] = next.Format("2006-01-02 15:04")
+	} else {
+		// Give up on this run; recurring orders carry on with the next one
+		o.RetryCount = 0
+		o.Occurrences++
+		if err := skipMissedRuns(dbtx, o, time.Now()); err != nil {
+			return err
+		}
+		if o.Frequency == "ONCE" {
+			o.Status = "FAILED"
+		} else if isFinished(o) {
+			o.Status = "COMPLETED"
+		}
+	}
+
+	_, err := dbtx.Exec(`
+		UPDATE standing_orders
+		SET retry_count = $1, retry_at = $2, occurrences = $3, next_run_at = $4, status = $5,
+		    last_run_at = NOW(), last_error = $6
+		WHERE id = $7
+	`, o.RetryCount, retryAt, o.Occurrences, occurrenceAt(o.StartAt, o.Frequency, o.Occurrences), o.Status, cause.Error(), o.ID)
+	if err != nil {
+		return err
+	}
+
+	payload["user_id"] = o.UserID
+	return recordEvent(dbtx, models.EventStandingOrderFailed, "standing_order", o.ID, nil, payload)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GetAccountStatement builds the statement of an account for the days from
+// through to, both inclusive. It is computed from the ledger so the running
+// balance always agrees with the postings.
+func GetAccountStatement(accountNumber string, from, to time.Time) (*dtos.Statement, error) {
+	if to.Before(from) {
+		return nil, errors.New("to must not be before from")
+	}
+
+	statement := dtos.Statement{
+		AccountNumber: accountNumber,
+		From:          from,
+		To:            to,
+		Lines:         []dtos.StatementLine{},
+		GeneratedAt:   time.Now(),
+	}
+
+	err := db.DB.QueryRow(`
+		SELECT at.currency FROM accounts a JOIN account_types at ON at.id = a.account_type_id
+		WHERE a.account_number = $1
+	`, accountNumber).Scan(&statement.Currency)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.DB.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM postings
+		WHERE account_number = $1 AND created_at < $2::date
+	`, accountNumber, from.Format(dateLayout)).Scan(&statement.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each journal entry touches an account at most once; the account's own
+	// transaction row gives the description the customer knows
+	rows, err := db.DB.Query(`
+		SELECT p.created_at, je.reference, COALESCE(t.description, je.description), t.id, p.amount
+		FROM postings p
+		JOIN journal_entries je ON je.id = p.journal_entry_id
+		LEFT JOIN transactions t ON t.journal_entry_id = p.journal_entry_id AND t.account_id = p.account_number
+		WHERE p.account_number = $1 AND p.created_at >= $2::date AND p.created_at < $3::date + 1
+		ORDER BY p.created_at, p.id
+	`, accountNumber, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balance := statement.OpeningBalance
+	for rows.Next() {
+		var line dtos.StatementLine
+		var transactionID sql.NullInt64
+		if err := rows.Scan(&line.Date, &line.Reference, &line.Description, &transactionID, &line.Amount); err != nil {
+			return nil, err
+		}
+		if transactionID.Valid {
+			id := uint(transactionID.Int64)
+			line.TransactionID = &id
+		}
+
+		balance = balance.Add(line.Amount)
+		line.Balance = balance
+		if line.Amount.IsPositive() {
+			statement.TotalIn = statement.TotalIn.Add(line.Amount)
+		} else {
+			statement.TotalOut = statement.TotalOut.Add(line.Amount.Neg())
+		}
+		statement.Lines = append(statement.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statement.ClosingBalance = balance
+	return &statement, nil
+}
+
+// GetUserAccountStatement is GetAccountStatement for one of the user's own accounts.
+func GetUserAccountStatement(accountNumber string, userID uint, from, to time.Time) (*dtos.Statement, error) {
+	if err := AuthorizeAccount(accountNumber, userID); err != nil {
+		return nil, err
+	}
+	return GetAccountStatement(accountNumber, from, to)
+}
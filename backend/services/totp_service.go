@@ -0,0 +1,412 @@
+package services
+
+import (
+	"bank/db"
+	"bank/dtos"
+	"bank/models"
+	"bank/utils"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount    = 10
+	maxChallengeAttempts = 5
+	defaultTOTPIssuer    = "Bank"
+	secondFactorTOTP     = "an authenticator code"
+	secondFactorRecovery = "a recovery code"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotStarted     = errors.New("start two-factor enrollment first")
+	ErrInvalidTOTPCode    = errors.New("invalid authentication code")
+	ErrInvalidChallenge   = errors.New("invalid or expired login challenge")
+)
+
+// LoginChallengeTTL is how long the second step of a login may take.
+func LoginChallengeTTL() time.Duration {
+	return utils.GetEnvDuration("LOGIN_CHALLENGE_TTL", 5*time.Minute)
+}
+
+// TOTPEnabled reports whether the user must pass a second factor to log in.
+func TOTPEnabled(userID uint) (bool, error) {
+	var enabled bool
+	err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled)`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// BeginTOTPEnrollment creates a new pending secret for the user. It only
+// takes effect once ConfirmTOTPEnrollment sees a code generated from it.
+func BeginTOTPEnrollment(userID uint) (*dtos.TOTPEnrollment, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := db.DB.Exec(`
+		INSERT INTO user_totp (user_id, secret, enabled, created_at)
+		VALUES ($1, $2, FALSE, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE NOT user_totp.enabled
+	`, userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	var email string
+	if err := db.DB.QueryRow(`SELECT email FROM credentials WHERE user_id = $1`, userID).Scan(&email); err != nil {
+		return nil, err
+	}
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+
+	_ = LogAudit(&userID, "CREATE", "user_totp", userID, "Started two-factor enrollment")
+	return &dtos.TOTPEnrollment{Secret: secret, URI: utils.TOTPURI(issuer, email, secret)}, nil
+}
+
+// ConfirmTOTPEnrollment turns two-factor authentication on once the user
+// proves their app works, and returns a fresh set of recovery codes.
+func ConfirmTOTPEnrollment(userID uint, code string) ([]string, error) {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	var secret string
+	var enabled bool
+	err = dbtx.QueryRow(`SELECT secret, enabled FROM user_totp WHERE user_id = $1 FOR UPDATE`, userID).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrTOTPNotStarted
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	step, ok := utils.ValidateTOTP(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		_ = LogAudit(&userID, "LOGIN_FAILED", "user_totp", userID, "Wrong code while confirming two-factor enrollment")
+		return nil, ErrInvalidTOTPCode
+	}
+	_, err = dbtx.Exec(`UPDATE user_totp SET enabled = TRUE, confirmed_at = NOW(), last_used_step = $1 WHERE user_id = $2`, step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(dbtx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return nil, err
+	}
+
+	_ = LogAudit(&userID, "UPDATE", "user_totp", userID, "Enabled two-factor authentication")
+	securityAlert(userID, models.SecurityTwoFactorEnabled)
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off; it takes a current code
+// or a recovery code.
+func DisableTOTP(userID uint, code string) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	method, err := verifySecondFactor(dbtx, userID, code)
+	if err != nil {
+		if err == ErrInvalidTOTPCode {
+			_ = LogAudit(&userID, "LOGIN_FAILED", "user_totp", userID, "Wrong code while disabling two-factor authentication")
+		}
+		return err
+	}
+	if err := deleteTOTP(dbtx, userID); err != nil {
+		return err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&userID, "DELETE", "user_totp", userID, fmt.Sprintf("Disabled two-factor authentication with %s", method))
+	securityAlert(userID, models.SecurityTwoFactorDisabled)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user.
+func RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbtx.Rollback()
+
+	if _, err := verifySecondFactor(dbtx, userID, code); err != nil {
+		if err == ErrInvalidTOTPCode {
+			_ = LogAudit(&userID, "LOGIN_FAILED", "user_totp", userID, "Wrong code while regenerating recovery codes")
+		}
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(dbtx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return nil, err
+	}
+
+	_ = LogAudit(&userID, "UPDATE", "recovery_codes", userID, "Regenerated recovery codes")
+	return codes, nil
+}
+
+// ResetTOTP is the admin's way out for a user who lost both their device
+// and their recovery codes. The user can log in with the password alone
+// and enroll again.
+func ResetTOTP(userID uint, adminID uint) error {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	var exists bool
+	if err := dbtx.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1)`, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTOTPNotEnabled
+	}
+	if err := deleteTOTP(dbtx, userID); err != nil {
+		return err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return err
+	}
+
+	_ = LogAudit(&adminID, "DELETE", "user_totp", userID, fmt.Sprintf("Reset two-factor authentication of user %d", userID))
+	securityAlert(userID, models.SecurityTwoFactorDisabled)
+	return nil
+}
+
+func deleteTOTP(dbtx *sql.Tx, userID uint) error {
+	for _, stmt := range []string{
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM login_challenges WHERE user_id = $1`,
+	} {
+		if _, err := dbtx.Exec(stmt, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceRecoveryCodes drops the user's old codes and returns new ones;
+// only their hashes are kept.
+func replaceRecoveryCodes(dbtx *sql.Tx, userID uint) ([]string, error) {
+	if _, err := dbtx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(encoding.EncodeToString(raw))[:10]
+		code := s[:5] + "-" + s[5:]
+
+		_, err := dbtx.Exec(`INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, NOW())`,
+			userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// verifySecondFactor accepts a current authenticator code, which cannot be
+// replayed, or an unused recovery code, which is used up.
+func verifySecondFactor(dbtx *sql.Tx, userID uint, code string) (string, error) {
+	code = strings.TrimSpace(code)
+
+	var secret string
+	var lastStep int64
+	err := dbtx.QueryRow(`SELECT secret, last_used_step FROM user_totp WHERE user_id = $1 AND enabled FOR UPDATE`, userID).
+		Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return "", ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now()); ok {
+		if step <= lastStep {
+			return "", ErrInvalidTOTPCode
+		}
+		if _, err := dbtx.Exec(`UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2`, step, userID); err != nil {
+			return "", err
+		}
+		return secondFactorTOTP, nil
+	}
+
+	var codeID uint
+	err = dbtx.QueryRow(`
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+		RETURNING id
+	`, userID, hashToken(normalizeRecoveryCode(code))).Scan(&codeID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidTOTPCode
+	}
+	if err != nil {
+		return "", err
+	}
+	return secondFactorRecovery, nil
+}
+
+// CreateLoginChallenge is issued instead of tokens when the password was
+// right but a second factor is still needed.
+func CreateLoginChallenge(userID uint) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.DB.Exec(`INSERT INTO login_challenges (user_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, NOW())`,
+		userID, hashToken(token), time.Now().Add(LoginChallengeTTL()))
+	if err != nil {
+		return "", err
+	}
+
+	_ = LogAudit(&userID, "LOGIN", "login_challenges", userID, "Password accepted, waiting for second factor")
+	return token, nil
+}
+
+// CompleteLoginChallenge checks the second factor of a login. A challenge
+// is single-use and allows a few wrong codes before it is void; wrong
+// codes also count towards the lockout of the email and the IP, so new
+// challenges do not give new guesses.
+func CompleteLoginChallenge(challenge, code, ipAddress, userAgent string) (uint, []string, error) {
+	var email string
+	err := db.DB.QueryRow(`
+		SELECT c.email FROM login_challenges lc JOIN credentials c ON c.user_id = lc.user_id
+		WHERE lc.token_hash = $1
+	`, hashToken(challenge)).Scan(&email)
+	if err == sql.ErrNoRows {
+		return 0, nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	policy := currentLoginPolicy()
+	attempt, reason, err := reserveLoginAttempt(policy, email, ipAddress, userAgent)
+	if err != nil {
+		var throttled *LoginThrottledError
+		if errors.As(err, &throttled) {
+			recordLoginAttempt(nil, email, ipAddress, userAgent, false, reason)
+		}
+		return 0, nil, err
+	}
+
+	userID, roles, err := completeLoginChallenge(challenge, code)
+	switch {
+	case err == nil:
+		attempt.succeed(userID)
+	case errors.Is(err, ErrInvalidTOTPCode):
+		if attempt.failures == policy.maxFailures {
+			securityAlert(userID, models.SecurityLoginLocked)
+		}
+		attempt.fail(&userID, loginWrongSecondFactor)
+	case errors.Is(err, ErrInvalidChallenge):
+		attempt.release(nil, loginInvalidChallenge)
+	default:
+		attempt.release(nil, loginError)
+	}
+	return userID, roles, err
+}
+
+// completeLoginChallenge checks the code against the challenge. On a wrong
+// code it still returns the challenge's user.
+func completeLoginChallenge(challenge, code string) (uint, []string, error) {
+	dbtx, err := db.DB.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer dbtx.Rollback()
+
+	var challengeID, userID uint
+	var attempts int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err = dbtx.QueryRow(`
+		SELECT id, user_id, attempts, expires_at, used_at FROM login_challenges
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashToken(challenge)).Scan(&challengeID, &userID, &attempts, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return 0, nil, ErrInvalidChallenge
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if usedAt.Valid || attempts >= maxChallengeAttempts || !expiresAt.After(time.Now()) {
+		return 0, nil, ErrInvalidChallenge
+	}
+
+	method, err := verifySecondFactor(dbtx, userID, code)
+	if err == ErrInvalidTOTPCode {
+		if _, err := dbtx.Exec(`UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1`, challengeID); err != nil {
+			return 0, nil, err
+		}
+		if err := dbtx.Commit(); err != nil {
+			return 0, nil, err
+		}
+		_ = LogAudit(&userID, "LOGIN_FAILED", "login_challenges", challengeID, "Wrong second factor at login")
+		return userID, nil, ErrInvalidTOTPCode
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := dbtx.Exec(`UPDATE login_challenges SET used_at = NOW() WHERE id = $1`, challengeID); err != nil {
+		return 0, nil, err
+	}
+	roles, err := userRoles(dbtx, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := dbtx.Commit(); err != nil {
+		return 0, nil, err
+	}
+
+	_ = LogAudit(&userID, "LOGIN", "login_challenges", challengeID, fmt.Sprintf("Logged in with %s", method))
+	return userID, roles, nil
+}
@@ -4,16 +4,20 @@ import (
 	"bank/db"
 	"bank/dtos"
 	"bank/models"
-	"bank/websocket"
+	"bank/money"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"time"
 )
 
-func MoneyTransfer(tx *models.Transaction) error {
+// MoneyTransfer carries out tx in its own transaction. beforeCommit, when
+// set, runs in that transaction once the transfer is booked; an error from it
+// rolls the transfer back.
+func MoneyTransfer(tx *models.Transaction, beforeCommit func(*sql.Tx) error) error {
 	if tx.ToAccountID == nil {
-		return errors.New("missing destination account for transfer")
+		return invalidRequest("missing destination account for transfer")
 	}
 
 	dbtx, err := db.DB.Begin()
@@ -27,108 +31,194 @@ func MoneyTransfer(tx *models.Transaction) error {
 		}
 	}()
 
-	var sender, receiver models.Account
-
-	// Fetch sender
-	err = dbtx.QueryRow(`SELECT id, account_number, balance, is_active, user_id FROM accounts WHERE account_number = $1`, tx.AccountID).
-		Scan(&sender.ID, &sender.AccountNumber, &sender.Balance, &sender.IsActive, &sender.UserID)
-	if err != nil {
+	if err := executeTransfer(dbtx, tx); err != nil {
 		dbtx.Rollback()
-		return fmt.Errorf("sender account not found: %v", err)
+		return err
 	}
-
-	// Fetch receiver
-	err = dbtx.QueryRow(`SELECT id, account_number, balance, is_active, user_id FROM accounts WHERE account_number = $1`, *tx.ToAccountID).
-		Scan(&receiver.ID, &receiver.AccountNumber, &receiver.Balance, &receiver.IsActive, &receiver.UserID)
-	if err != nil {
-		dbtx.Rollback()
-		return errors.New("receiver account not found")
+	if beforeCommit != nil {
+		if err := beforeCommit(dbtx); err != nil {
+			dbtx.Rollback()
+			return err
+		}
 	}
 
-	if sender.AccountNumber == receiver.AccountNumber {
-		dbtx.Rollback()
-		return errors.New("cannot transfer to self")
+	// Commit transaction
+	return dbtx.Commit()
+}
+
+// executeTransfer moves tx.Amount from tx.AccountID to tx.ToAccountID through
+// the ledger inside dbtx and records a TransferCompleted event. The caller
+// owns commit and rollback.
+func executeTransfer(dbtx *sql.Tx, tx *models.Transaction) error {
+	if tx.ToAccountID == nil {
+		return invalidRequest("missing destination account for transfer")
 	}
-	if !sender.IsActive || !receiver.IsActive {
-		dbtx.Rollback()
-		return errors.New("both accounts must be active")
+	if !tx.Amount.IsPositive() {
+		return invalidRequest("invalid amount")
 	}
-	if sender.Balance < tx.Amount {
-		dbtx.Rollback()
-		return errors.New("insufficient balance")
+
+	if tx.AccountID == *tx.ToAccountID {
+		return invalidRequest("cannot transfer to self")
 	}
 
-	// Update sender balance
-	_, err = dbtx.Exec(`UPDATE accounts SET balance = balance - $1 WHERE account_number = $2`, tx.Amount, sender.AccountNumber)
+	// Lock both accounts up front, in a fixed order, so concurrent transfers
+	// can neither overdraw the sender nor deadlock on each other
+	accounts, err := lockAccounts(dbtx, tx.AccountID, *tx.ToAccountID)
 	if err != nil {
-		dbtx.Rollback()
 		return err
 	}
+	sender, receiver := accounts[tx.AccountID], accounts[*tx.ToAccountID]
+	if sender == nil {
+		return invalidRequest("sender account not found")
+	}
+	if receiver == nil {
+		return invalidRequest("receiver account not found")
+	}
 
-	// Update receiver balance
-	_, err = dbtx.Exec(`UPDATE accounts SET balance = balance + $1 WHERE account_number = $2`, tx.Amount, receiver.AccountNumber)
-	if err != nil {
-		dbtx.Rollback()
-		return err
+	if !sender.IsActive || !receiver.IsActive {
+		return invalidRequest("both accounts must be active")
 	}
+	amount := money.New(tx.Amount, sender.AccountType.Currency)
 
-	// Insert sender transaction (DEBIT)
-	_, err = dbtx.Exec(`INSERT INTO transactions (account_id, to_account_id, transaction_type, amount, description, user_id, transaction_date)
-	                    VALUES ($1, $2, 'DEBIT', $3, $4, $5, NOW())`,
-		sender.AccountNumber, receiver.AccountNumber, tx.Amount,
-		fmt.Sprintf("Transferred to Account ID %s", receiver.AccountNumber), tx.UserID)
+	// Price the transfer: fee, and conversion when the accounts are held in
+	// different currencies
+	price, err := quoteTransfer(dbtx, sender, receiver, amount, tx.ExchangeRateID)
 	if err != nil {
-		dbtx.Rollback()
+		return err
+	}
+	balance := money.New(sender.Balance, sender.AccountType.Currency)
+	if cmp, _ := balance.Cmp(price.Total); cmp < 0 {
+		return invalidRequest("insufficient balance")
+	}
+	if err := checkTransferLimits(dbtx, sender.AccountNumber, amount.Amount); err != nil {
 		return err
 	}
 
-	// Log audit for sender debit action
-	_ = LogAudit(&sender.UserID, "CREATE", "transactions", sender.ID, fmt.Sprintf("Debited %.2f to %s", tx.Amount, receiver.AccountNumber))
+	received := price.Received
+	quote := price.FX
+	postings := []models.Posting{
+		{AccountNumber: sender.AccountNumber, Amount: amount.Amount.Neg(), Currency: amount.Currency},
+		{AccountNumber: receiver.AccountNumber, Amount: amount.Amount, Currency: amount.Currency},
+	}
+	if quote != nil {
+		postings = fxPostings(sender.AccountNumber, receiver.AccountNumber, quote)
+	}
 
-	// Insert receiver transaction (CREDIT)
-	_, err = dbtx.Exec(`INSERT INTO transactions (account_id, to_account_id, transaction_type, amount, description, user_id, transaction_date)
-	                    VALUES ($1, $2, 'CREDIT', $3, $4, $5, NOW())`,
-		receiver.AccountNumber, sender.AccountNumber, tx.Amount,
-		fmt.Sprintf("Received from Account ID %s", sender.AccountNumber), tx.UserID)
-	if err != nil {
-		dbtx.Rollback()
+	// Post the movement to the ledger; this also updates both balances
+	description := tx.Description
+	if description == "" {
+		description = fmt.Sprintf("Transfer from %s to %s", sender.AccountNumber, receiver.AccountNumber)
+	}
+	entry := models.JournalEntry{
+		Reference:   "TRANSFER",
+		Description: description,
+		Postings:    postings,
+	}
+	if err := PostJournalEntry(dbtx, &entry); err != nil {
 		return err
 	}
 
-	// Log audit for receiver credit action
-	_ = LogAudit(&receiver.UserID, "CREATE", "transactions", receiver.ID, fmt.Sprintf("Credited %.2f from %s", tx.Amount, sender.AccountNumber))
+	// Both sides record their own amount; FX transfers also the other side's
+	// amount, the rate used and the spread kept by the bank
+	var counterSent, counterReceived *money.Money
+	var fxRate *string
+	var fxSpread *money.Amount
+	var rateID *uint
+	if quote != nil {
+		counterSent, counterReceived = &received, &amount
+		fxRate, fxSpread, rateID = &quote.Rate, &quote.Spread.Amount, &quote.RateID
+	}
 
-	// Insert notification
-	message := fmt.Sprintf("You received %.2f from %s", tx.Amount, sender.AccountNumber)
-	_, err = dbtx.Exec(`INSERT INTO notifications (user_id, message, created_at) VALUES ($1, $2, NOW())`,
-		receiver.UserID, message)
+	// Insert sender transaction (DEBIT)
+	err = dbtx.QueryRow(`INSERT INTO transactions (account_id, to_account_id, transaction_type, amount, currency, counter_amount, counter_currency,
+	                                               fx_rate, fx_spread, exchange_rate_id, description, user_id, journal_entry_id, transaction_date)
+	                    VALUES ($1, $2, 'DEBIT', $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
+	                    RETURNING id, transaction_date`,
+		sender.AccountNumber, receiver.AccountNumber, amount.Amount, amount.Currency, counterAmount(counterSent), counterCurrency(counterSent),
+		fxRate, fxSpread, rateID,
+		fmt.Sprintf("Transferred to Account ID %s", receiver.AccountNumber), sender.UserID, entry.ID).
+		Scan(&tx.ID, &tx.TransactionDate)
 	if err != nil {
-		dbtx.Rollback()
 		return err
 	}
 
-	// Commit transaction
-	if err := dbtx.Commit(); err != nil {
+	// Insert receiver transaction (CREDIT)
+	_, err = dbtx.Exec(`INSERT INTO transactions (account_id, to_account_id, transaction_type, amount, currency, counter_amount, counter_currency,
+	                                              fx_rate, fx_spread, exchange_rate_id, description, user_id, journal_entry_id, transaction_date)
+	                    VALUES ($1, $2, 'CREDIT', $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())`,
+		receiver.AccountNumber, sender.AccountNumber, received.Amount, received.Currency, counterAmount(counterReceived), counterCurrency(counterReceived),
+		fxRate, fxSpread, rateID,
+		fmt.Sprintf("Received from Account ID %s", sender.AccountNumber), receiver.UserID, entry.ID)
+	if err != nil {
 		return err
 	}
 
-	// Send real-time notification (non-DB)
-	websocket.NotifyChan <- websocket.NotificationMessage{
-		UserID:  receiver.UserID,
-		Message: message,
+	// The fee is booked separately so the transfer itself stays as sent
+	if !price.Fee.Amount.IsZero() {
+		if err := postTransferFee(dbtx, sender, receiver.AccountNumber, price.Fee, tx.ID); err != nil {
+			return err
+		}
+		tx.Fee = &price.Fee.Amount
+	}
+
+	tx.UserID = sender.UserID
+	tx.TransactionType = "DEBIT"
+	tx.Currency = amount.Currency
+	tx.CounterAmount = counterAmount(counterSent)
+	tx.CounterCurrency = counterCurrency(counterSent)
+	tx.FXRate = fxRate
+	tx.FXSpread = fxSpread
+	tx.ExchangeRateID = rateID
+
+	payload := map[string]interface{}{
+		"transaction_id":      tx.ID,
+		"from_account":        sender.AccountNumber,
+		"to_account":          receiver.AccountNumber,
+		"sender_account_id":   sender.ID,
+		"receiver_account_id": receiver.ID,
+		"sender_user_id":      sender.UserID,
+		"receiver_user_id":    receiver.UserID,
+		"amount":              amount.Amount.String(),
+		"currency":            amount.Currency,
+		"received_amount":     received.Amount.String(),
+		"received_currency":   received.Currency,
+	}
+	if !price.Fee.Amount.IsZero() {
+		payload["fee_amount"] = price.Fee.Amount.String()
+		payload["fee_currency"] = price.Fee.Currency
+	}
+	return recordEvent(dbtx, models.EventTransferCompleted, "transaction", tx.ID, &sender.UserID, payload)
+}
+
+func counterAmount(m *money.Money) *money.Amount {
+	if m == nil {
+		return nil
 	}
+	return &m.Amount
+}
 
-	return nil
+func counterCurrency(m *money.Money) *string {
+	if m == nil {
+		return nil
+	}
+	return &m.Currency
 }
 
-func MoneyRequest(request *models.MoneyRequest) error {
-	if request.Amount <= 0 {
-		return errors.New("invalid amount")
+// MoneyRequest records a request for money; beforeCommit works as for
+// MoneyTransfer.
+func MoneyRequest(request *models.MoneyRequest, beforeCommit func(*sql.Tx) error) error {
+	if !request.Amount.IsPositive() {
+		return invalidRequest("invalid amount")
 	}
 
 	if request.RequesterID == request.RecipientID {
 		fmt.Println("Requester and recipient cannot be the same", request.RequesterID, request.RecipientID)
-		return errors.New("cannot request from self")
+		return invalidRequest("cannot request from self")
+	}
+
+	// Money can only be requested into an account of the requesting user
+	if err := AuthorizeAccount(request.RequesterID, request.UserID); err != nil {
+		return err
 	}
 
 	request.Status = "PENDING"
@@ -152,7 +242,21 @@ func MoneyRequest(request *models.MoneyRequest) error {
 	`, request.RecipientID).Scan(&recipientUserID)
 	if err != nil {
 		dbtx.Rollback()
-		return errors.New("recipient account not found")
+		if err == sql.ErrNoRows {
+			return invalidRequest("recipient account not found")
+		}
+		return err
+	}
+
+	// The recipient pays if they accept, so the request must fit their limit
+	limits, err := loadTransferLimits(dbtx, request.RecipientID)
+	if err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	if err := checkPerTransactionLimit(limits, request.Amount); err != nil {
+		dbtx.Rollback()
+		return err
 	}
 
 	// Insert money request
@@ -169,37 +273,31 @@ func MoneyRequest(request *models.MoneyRequest) error {
 		return err
 	}
 
-	// Log audit for the money request creation
-	_ = LogAudit(nil, "CREATE", "money_requests", requestID, fmt.Sprintf("Money request of %.2f from %s to %s", request.Amount, request.RequesterID, request.RecipientID))
-
-	// Prepare WebSocket notification message
-	message := fmt.Sprintf("User %v requested %.2f from you", request.RequesterID, request.Amount)
-
-	// Insert notification into the database
-	_, err = dbtx.Exec(`
-		INSERT INTO notifications (user_id, message, created_at)
-		VALUES ($1, $2, NOW())
-	`, recipientUserID, message)
+	err = recordEvent(dbtx, models.EventMoneyRequestCreated, "money_request", requestID, &request.UserID, map[string]interface{}{
+		"request_id":        requestID,
+		"requester_account": request.RequesterID,
+		"recipient_account": request.RecipientID,
+		"recipient_user_id": recipientUserID,
+		"amount":            request.Amount.String(),
+	})
 	if err != nil {
 		dbtx.Rollback()
-		return errors.New("failed to insert notification")
-	}
-
-	// Commit the transaction
-	if err := dbtx.Commit(); err != nil {
 		return err
 	}
-
-	// Send WebSocket notification
-	websocket.NotifyChan <- websocket.NotificationMessage{
-		UserID:  recipientUserID,
-		Message: message,
+	if beforeCommit != nil {
+		if err := beforeCommit(dbtx); err != nil {
+			dbtx.Rollback()
+			return err
+		}
 	}
 
-	return nil
+	// Commit the transaction
+	return dbtx.Commit()
 }
 
-func AcceptMoneyRequest(requestID uint) error {
+// AcceptMoneyRequest pays a pending request; only the owner of the account
+// it was addressed to may accept it.
+func AcceptMoneyRequest(requestID uint, userID uint) error {
 	dbtx, err := db.DB.Begin()
 	if err != nil {
 		return err
@@ -217,12 +315,18 @@ func AcceptMoneyRequest(requestID uint) error {
 		SELECT id, requester_id, recipient_id, amount, status ,user_id
 		FROM money_requests 
 		WHERE id = $1
+		FOR UPDATE
 	`, requestID).Scan(&req.ID, &req.RequesterID, &req.RecipientID, &req.Amount, &req.Status, &req.UserID)
 	if err != nil {
 		dbtx.Rollback()
 		return fmt.Errorf("money request not found: %v", err)
 	}
 
+	if err := AuthorizeAccount(req.RecipientID, userID); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
 	if req.Status != "PENDING" {
 		dbtx.Rollback()
 		return errors.New("request is no longer active")
@@ -239,12 +343,8 @@ func AcceptMoneyRequest(requestID uint) error {
 		return err
 	}
 
-	// Commit before calling MoneyTransfer
-	if err := dbtx.Commit(); err != nil {
-		return err
-	}
-
-	// Use existing transfer logic
+	// Use existing transfer logic in the same DB transaction, so a failed
+	// transfer leaves the request PENDING
 	tx := &models.Transaction{
 		UserID:      req.UserID,
 		AccountID:   req.RecipientID,
@@ -253,10 +353,29 @@ func AcceptMoneyRequest(requestID uint) error {
 		Description: fmt.Sprintf("Accepted request ID %d", req.ID),
 	}
 
-	return MoneyTransfer(tx)
+	if err := executeTransfer(dbtx, tx); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
+	err = recordEvent(dbtx, models.EventMoneyRequestAccepted, "money_request", req.ID, &userID, map[string]interface{}{
+		"request_id":        req.ID,
+		"requester_account": req.RequesterID,
+		"recipient_account": req.RecipientID,
+		"amount":            req.Amount.String(),
+		"transaction_id":    tx.ID,
+	})
+	if err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
+	return dbtx.Commit()
 }
 
-func DeclineMoneyRequest(requestID uint) error {
+// DeclineMoneyRequest refuses a pending request; like accepting, only its
+// recipient may do that.
+func DeclineMoneyRequest(requestID uint, userID uint) error {
 	dbtx, err := db.DB.Begin()
 	if err != nil {
 		return err
@@ -274,12 +393,18 @@ func DeclineMoneyRequest(requestID uint) error {
 		SELECT id, requester_id, recipient_id, amount, status
 		FROM money_requests
 		WHERE id = $1
+		FOR UPDATE
 	`, requestID).Scan(&req.ID, &req.RequesterID, &req.RecipientID, &req.Amount, &req.Status)
 	if err != nil {
 		dbtx.Rollback()
 		return fmt.Errorf("money request not found: %v", err)
 	}
 
+	if err := AuthorizeAccount(req.RecipientID, userID); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+
 	if req.Status != "PENDING" {
 		dbtx.Rollback()
 		return errors.New("request is no longer active")
@@ -296,41 +421,30 @@ func DeclineMoneyRequest(requestID uint) error {
 		return err
 	}
 
-	// Get requester account (for WebSocket notification)
-	var userID uint
+	// Get requester account (to notify them)
+	var requesterUserID uint
 	err = dbtx.QueryRow(`
 		SELECT user_id FROM accounts WHERE account_number = $1
-	`, req.RequesterID).Scan(&userID)
+	`, req.RequesterID).Scan(&requesterUserID)
 	if err != nil {
 		dbtx.Rollback()
 		return fmt.Errorf("requester account not found: %v", err)
 	}
 
-	// Prepare notification message
-	message := fmt.Sprintf("Your money request  %v was declined", req.RequesterID)
-
-	// Insert notification into the database
-	_, err = dbtx.Exec(`
-		INSERT INTO notifications (user_id, message, created_at)
-		VALUES ($1, $2, NOW())
-	`, userID, message)
+	err = recordEvent(dbtx, models.EventMoneyRequestDeclined, "money_request", requestID, &userID, map[string]interface{}{
+		"request_id":        requestID,
+		"requester_account": req.RequesterID,
+		"recipient_account": req.RecipientID,
+		"requester_user_id": requesterUserID,
+		"amount":            req.Amount.String(),
+	})
 	if err != nil {
 		dbtx.Rollback()
-		return fmt.Errorf("failed to insert notification: %v", err)
-	}
-
-	// Commit the transaction
-	if err := dbtx.Commit(); err != nil {
 		return err
 	}
 
-	// Send WebSocket notification
-	websocket.NotifyChan <- websocket.NotificationMessage{
-		UserID:  userID,
-		Message: message,
-	}
-
-	return nil
+	// Commit the transaction
+	return dbtx.Commit()
 }
 
 func AutoExpireRequests() {
@@ -398,15 +512,17 @@ func AutoExpireRequests() {
 				return
 			}
 
-			// Step 2c: Create notification
-			message := fmt.Sprintf("Your money request (Account %v) has expired", requesterAccount.AccountNumber)
-			_, err = dbtx.Exec(`
-				INSERT INTO notifications (user_id, message, created_at)
-				VALUES ($1, $2, NOW())
-			`, requesterAccount.UserID, message)
+			// Step 2c: Record the expiry; the requester is notified from it
+			err = recordEvent(dbtx, models.EventMoneyRequestExpired, "money_request", req.ID, nil, map[string]interface{}{
+				"request_id":        req.ID,
+				"requester_account": requesterAccount.AccountNumber,
+				"recipient_account": req.RecipientID,
+				"requester_user_id": requesterAccount.UserID,
+				"amount":            req.Amount.String(),
+			})
 			if err != nil {
 				dbtx.Rollback()
-				log.Printf("Failed to insert notification for request ID %d: %v\n", req.ID, err)
+				log.Printf("Failed to record expiry of request ID %d: %v\n", req.ID, err)
 				return
 			}
 
@@ -415,12 +531,6 @@ func AutoExpireRequests() {
 				log.Printf("Failed to commit transaction for request ID %d: %v\n", req.ID, err)
 				return
 			}
-
-			// Step 2d: Send WebSocket notification
-			websocket.NotifyChan <- websocket.NotificationMessage{
-				UserID:  requesterAccount.UserID,
-				Message: message,
-			}
 		}()
 	}
 
@@ -435,15 +545,29 @@ type TransactionFilter struct {
 	UserID          *uint
 	AccountID       *string
 	TransactionType *string
-	MinAmount       *float64
-	MaxAmount       *float64
+	MinAmount       *money.Amount
+	MaxAmount       *money.Amount
 	StartDate       *time.Time
 	EndDate         *time.Time
 	DescriptionLike *string
+
+	PageRequest
 }
 
-func GetTransactionHistory(filter TransactionFilter) ([]models.Transaction, error) {
-	baseQuery := `SELECT id, user_id, account_id, transaction_type, to_account_id, amount, transaction_date, description 
+var transactionSorts = map[string]sortKey{
+	"transaction_date": {column: "transaction_date", cast: "timestamp"},
+	"amount":           {column: "amount", cast: "numeric"},
+}
+
+func GetTransactionHistory(filter TransactionFilter) (*Page[models.Transaction], error) {
+	keys, err := newKeyset(filter.PageRequest, transactionSorts, "transaction_date", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	baseQuery := `SELECT id, user_id, account_id, transaction_type, to_account_id, amount, transaction_date, description,
+	                     COALESCE(currency, ''), counter_amount, counter_currency, fx_rate, fx_spread, exchange_rate_id,
+	                     reversal_of_id, reversed_amount, fee_of_id, ` + keys.sortValue() + `
 	              FROM transactions WHERE 1=1`
 	var params []interface{}
 	var conditions string
@@ -482,8 +606,22 @@ func GetTransactionHistory(filter TransactionFilter) ([]models.Transaction, erro
 		conditions += fmt.Sprintf(" AND description ILIKE $%d", len(params))
 	}
 
+	var total *int64
+	if filter.WithTotal {
+		var count int64
+		if err := db.GetDB().QueryRow(`SELECT COUNT(*) FROM transactions WHERE 1=1`+conditions, params...).Scan(&count); err != nil {
+			return nil, err
+		}
+		total = &count
+	}
+
+	after, err := keys.where(filter.Cursor, &params)
+	if err != nil {
+		return nil, err
+	}
+
 	// Final SQL query with ORDER BY
-	fullQuery := baseQuery + conditions + " ORDER BY transaction_date DESC"
+	fullQuery := baseQuery + conditions + after + keys.orderBy()
 
 	rows, err := db.GetDB().Query(fullQuery, params...)
 	if err != nil {
@@ -491,42 +629,77 @@ func GetTransactionHistory(filter TransactionFilter) ([]models.Transaction, erro
 	}
 	defer rows.Close()
 
-	var transactions []models.Transaction
+	// Ensure we return empty slice, not nil
+	transactions := []models.Transaction{}
+	var sortValues []string
 	for rows.Next() {
 		var t models.Transaction
-		err := rows.Scan(&t.ID, &t.UserID, &t.AccountID, &t.TransactionType, &t.ToAccountID, &t.Amount, &t.TransactionDate, &t.Description)
+		var sortValue string
+		err := rows.Scan(&t.ID, &t.UserID, &t.AccountID, &t.TransactionType, &t.ToAccountID, &t.Amount, &t.TransactionDate, &t.Description,
+			&t.Currency, &t.CounterAmount, &t.CounterCurrency, &t.FXRate, &t.FXSpread, &t.ExchangeRateID,
+			&t.ReversalOfID, &t.ReversedAmount, &t.FeeOfID, &sortValue)
 		if err != nil {
 			return nil, err
 		}
 		transactions = append(transactions, t)
+		sortValues = append(sortValues, sortValue)
 	}
-
-	// Ensure we return empty slice, not nil
-	if transactions == nil {
-		transactions = []models.Transaction{}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return transactions, nil
+	result := page(keys, transactions, sortValues, func(t models.Transaction) uint { return t.ID })
+	result.Total = total
+	return &result, nil
+}
+
+// Both timestamps may be NULL on old rows; those sort as the epoch.
+var moneyRequestSorts = map[string]sortKey{
+	"requeste_at": {column: "COALESCE(requeste_at, 'epoch'::timestamp)", cast: "timestamp"},
+	"amount":      {column: "amount", cast: "numeric"},
+	"expires_at":  {column: "COALESCE(expires_at, 'epoch'::timestamp)", cast: "timestamp"},
 }
 
-func GetMoneyRequestsByUserID(userID uint) ([]models.MoneyRequest, error) {
+func GetMoneyRequestsByUserID(userID uint, req PageRequest) (*Page[models.MoneyRequest], error) {
+	keys, err := newKeyset(req, moneyRequestSorts, "requeste_at", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	params := []interface{}{userID}
+	conditions := ` WHERE (user_id = $1 or  recipient_user_id= $1)`
+
+	var total *int64
+	if req.WithTotal {
+		var count int64
+		if err := db.DB.QueryRow(`SELECT COUNT(*) FROM money_requests`+conditions, params...).Scan(&count); err != nil {
+			return nil, err
+		}
+		total = &count
+	}
+
+	after, err := keys.where(req.Cursor, &params)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		SELECT id, requester_id, recipient_id, amount, status, user_id, expires_at, requeste_at
-		FROM money_requests
-		WHERE user_id = $1 or  recipient_user_id= $1 
-		ORDER BY requeste_at DESC
-	`
+		SELECT id, requester_id, recipient_id, amount, status, user_id, expires_at, requeste_at, ` + keys.sortValue() + `
+		FROM money_requests` + conditions + after + keys.orderBy()
 
-	rows, err := db.DB.Query(query, userID)
+	rows, err := db.DB.Query(query, params...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var requests []models.MoneyRequest
+	// Ensure we return an empty slice, not nil
+	requests := []models.MoneyRequest{}
+	var sortValues []string
 
 	for rows.Next() {
 		var req models.MoneyRequest
+		var sortValue string
 		err := rows.Scan(
 			&req.ID,
 			&req.RequesterID,
@@ -536,60 +709,22 @@ func GetMoneyRequestsByUserID(userID uint) ([]models.MoneyRequest, error) {
 			&req.UserID,
 			&req.ExpiresAt,
 			&req.RequesteAt,
+			&sortValue,
 		)
 		if err != nil {
 			return nil, err
 		}
 		requests = append(requests, req)
+		sortValues = append(sortValues, sortValue)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	// Ensure we return an empty slice, not nil
-	if requests == nil {
-		requests = []models.MoneyRequest{}
-	}
-
-	return requests, nil
-}
-
-func GetFilteredNotifications(userID string, filter string) ([]map[string]interface{}, error) {
-	baseQuery := "SELECT  message, created_at FROM notifications WHERE user_id = $1"
-	var query string
-
-	switch filter {
-	case "requests":
-		query = baseQuery + " AND message ILIKE '%requested%' ORDER BY created_at DESC"
-	case "alert":
-		query = baseQuery + " AND (message ILIKE '%declined%' OR message ILIKE '%expired%') ORDER BY created_at DESC"
-	default:
-		query = baseQuery + " ORDER BY created_at DESC"
-	}
-	fmt.Println(query, userID)
-	rows, err := db.DB.Query(query, userID)
-	if err != nil {
-		return nil, fmt.Errorf("query error: %w", err)
-	}
-	defer rows.Close()
-
-	var results []map[string]interface{}
-	for rows.Next() {
-
-		var msg string
-		var created string
-		if err := rows.Scan(&msg, &created); err != nil {
-			continue // optionally log this scan error
-		}
-		results = append(results, map[string]interface{}{
-
-			"message":    msg,
-			"created_at": created,
-		})
-	}
-
-	return results, nil
+	result := page(keys, requests, sortValues, func(r models.MoneyRequest) uint { return r.ID })
+	result.Total = total
+	return &result, nil
 }
 
 func GetDashboardSummary(userID uint) (*dtos.DashboardSummary, error) {
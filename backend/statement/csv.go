@@ -0,0 +1,49 @@
+// Package statement renders account statements as CSV and PDF documents.
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"bank/dtos"
+)
+
+const dateLayout = "2006-01-02"
+
+// WriteCSV writes a summary block followed by one row per statement line.
+func WriteCSV(w io.Writer, s *dtos.Statement) error {
+	out := csv.NewWriter(w)
+
+	records := [][]string{
+		{"Account", s.AccountNumber},
+		{"Currency", s.Currency},
+		{"From", s.From.Format(dateLayout)},
+		{"To", s.To.Format(dateLayout)},
+		{"Opening balance", s.OpeningBalance.String()},
+		{"Total in", s.TotalIn.String()},
+		{"Total out", s.TotalOut.String()},
+		{"Closing balance", s.ClosingBalance.String()},
+		{},
+		{"Date", "Reference", "Description", "Transaction ID", "Amount", "Balance"},
+	}
+	for _, line := range s.Lines {
+		transactionID := ""
+		if line.TransactionID != nil {
+			transactionID = strconv.FormatUint(uint64(*line.TransactionID), 10)
+		}
+		records = append(records, []string{
+			line.Date.Format("2006-01-02 15:04:05"),
+			line.Reference,
+			line.Description,
+			transactionID,
+			line.Amount.String(),
+			line.Balance.String(),
+		})
+	}
+
+	if err := out.WriteAll(records); err != nil {
+		return err
+	}
+	return out.Error()
+}
@@ -0,0 +1,154 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"bank/dtos"
+)
+
+// A4 in points, with the text laid out in a fixed-width font so columns line
+// up without measuring glyphs.
+const (
+	pageWidth     = 595
+	pageHeight    = 842
+	margin        = 40
+	fontSize      = 9
+	lineHeight    = 12
+	linesPerPage  = (pageHeight-2*margin)/lineHeight - 2 // room for the footer
+	descriptionAt = 38
+)
+
+type textLine struct {
+	text string
+	bold bool
+}
+
+// WritePDF renders the statement as a plain PDF 1.4 document using the
+// standard Courier fonts, so no font has to be embedded.
+func WritePDF(w io.Writer, s *dtos.Statement) error {
+	pages := paginate(statementLines(s))
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// 1 catalog, 2 page tree, 3-4 fonts, then a page and its content per page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		content := pageContent(page, fmt.Sprintf("%s  -  page %d of %d", s.AccountNumber, i+1, len(pages)))
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func statementLines(s *dtos.Statement) []textLine {
+	currency := func(a fmt.Stringer) string { return a.String() + " " + s.Currency }
+
+	lines := []textLine{
+		{text: "ACCOUNT STATEMENT", bold: true},
+		{},
+		{text: fmt.Sprintf("Account:          %s", s.AccountNumber)},
+		{text: fmt.Sprintf("Period:           %s to %s", s.From.Format(dateLayout), s.To.Format(dateLayout))},
+		{text: fmt.Sprintf("Opening balance:  %s", currency(s.OpeningBalance))},
+		{text: fmt.Sprintf("Total in:         %s", currency(s.TotalIn))},
+		{text: fmt.Sprintf("Total out:        %s", currency(s.TotalOut))},
+		{text: fmt.Sprintf("Closing balance:  %s", currency(s.ClosingBalance)), bold: true},
+		{text: fmt.Sprintf("Generated:        %s", s.GeneratedAt.Format("2006-01-02 15:04"))},
+		{},
+		{text: fmt.Sprintf("%-10s  %-12s  %-*s  %14s  %14s", "Date", "Reference", descriptionAt, "Description", "Amount", "Balance"), bold: true},
+	}
+	for _, line := range s.Lines {
+		lines = append(lines, textLine{text: fmt.Sprintf("%-10s  %-12s  %-*s  %14s  %14s",
+			line.Date.Format(dateLayout), truncate(line.Reference, 12), descriptionAt, truncate(line.Description, descriptionAt),
+			line.Amount.String(), line.Balance.String())})
+	}
+	if len(s.Lines) == 0 {
+		lines = append(lines, textLine{text: "No movements in this period."})
+	}
+	return lines
+}
+
+func paginate(lines []textLine) [][]textLine {
+	var pages [][]textLine
+	for len(lines) > linesPerPage {
+		pages = append(pages, lines[:linesPerPage])
+		lines = lines[linesPerPage:]
+	}
+	return append(pages, lines)
+}
+
+func pageContent(lines []textLine, footer string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "BT\n%d TL\n%d %d Td\n", lineHeight, margin, pageHeight-margin)
+	font := ""
+	for _, line := range lines {
+		want := "/F1"
+		if line.bold {
+			want = "/F2"
+		}
+		if want != font {
+			fmt.Fprintf(&b, "%s %d Tf\n", want, fontSize)
+			font = want
+		}
+		fmt.Fprintf(&b, "(%s) Tj T*\n", escape(line.text))
+	}
+	fmt.Fprintf(&b, "ET\nBT\n/F1 %d Tf\n%d %d Td\n(%s) Tj\nET", fontSize, margin, margin/2, escape(footer))
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-3]) + "..."
+}
+
+// escape makes text safe inside a PDF literal string. Characters outside
+// Latin-1 cannot be shown by the standard fonts and become '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r == 127:
+			b.WriteByte(' ')
+		case r < 128:
+			b.WriteRune(r)
+		case r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
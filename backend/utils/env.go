@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetEnvDuration reads a duration such as "24h" or "15m" from the environment,
+// falling back to def when the variable is unset or invalid.
+func GetEnvDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s=%q, using %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+// GetEnvInt reads an integer from the environment, falling back to def when
+// the variable is unset or invalid.
+func GetEnvInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using %d", name, value, def)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing keys are read at startup. With JWT_KEYS_DIR set, every file in
+// the directory is a key named by its kid:
+//
+//	<kid>.pem      RSA (RS256) or Ed25519 (EdDSA) private key, PKCS#1 or PKCS#8
+//	<kid>.pub.pem  public key only, to keep verifying tokens of a retired key
+//	<kid>.secret   HMAC secret (HS256)
+//
+// JWT_SIGNING_KEY_ID names the key new tokens are signed with; all others
+// only verify. To rotate, add the new key, point JWT_SIGNING_KEY_ID at it
+// and delete the old one once the tokens it signed have expired. Without
+// JWT_KEYS_DIR, JWT_SECRET is used as a single HS256 key.
+//
+//	openssl genpkey -algorithm ed25519 -out keys/2025-01.pem
+//	openssl genpkey -algorithm rsa -pkeyopt rsa_keygen_bits:2048 -out keys/2025-01.pem
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private interface{} // nil for verify-only keys
+	public  interface{}
+}
+
+type keyRing struct {
+	keys     map[string]*signingKey
+	active   *signingKey
+	issuer   string
+	audience string
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   *keyRing
+)
+
+// LoadSigningKeys reads the keys and token settings from the environment.
+func LoadSigningKeys() error {
+	ring := keyRing{
+		keys:     map[string]*signingKey{},
+		issuer:   os.Getenv("JWT_ISSUER"),
+		audience: os.Getenv("JWT_AUDIENCE"),
+	}
+	if ring.issuer == "" {
+		ring.issuer = "bank-api"
+	}
+	if ring.audience == "" {
+		ring.audience = "bank-api"
+	}
+
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		if err := ring.loadDir(dir); err != nil {
+			return err
+		}
+		activeKID := os.Getenv("JWT_SIGNING_KEY_ID")
+		active, ok := ring.keys[activeKID]
+		if !ok {
+			return fmt.Errorf("JWT_SIGNING_KEY_ID %q is not a key in %s", activeKID, dir)
+		}
+		if active.private == nil {
+			return fmt.Errorf("signing key %q has no private key", activeKID)
+		}
+		ring.active = active
+	} else {
+		secret := os.Getenv("JWT_SECRET")
+		if len(secret) < 16 {
+			return errors.New("set JWT_KEYS_DIR, or JWT_SECRET to at least 16 characters")
+		}
+		ring.active = &signingKey{kid: "default", method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+		ring.keys["default"] = ring.active
+	}
+
+	keysMu.Lock()
+	keys = &ring
+	keysMu.Unlock()
+
+	log.Printf("JWT signing with %s key %q, %d key(s) accepted", ring.active.method.Alg(), ring.active.kid, len(ring.keys))
+	return nil
+}
+
+func (r *keyRing) loadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		var key *signingKey
+		switch {
+		case strings.HasSuffix(name, ".pub.pem"):
+			key, err = parsePublicKey(strings.TrimSuffix(name, ".pub.pem"), raw)
+		case strings.HasSuffix(name, ".pem"):
+			key, err = parsePrivateKey(strings.TrimSuffix(name, ".pem"), raw)
+		case strings.HasSuffix(name, ".secret"):
+			secret := strings.TrimSpace(string(raw))
+			if len(secret) < 16 {
+				err = errors.New("HMAC secrets must be at least 16 characters")
+			}
+			key = &signingKey{kid: strings.TrimSuffix(name, ".secret"), method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("key file %s: %w", name, err)
+		}
+		// A private key also covers its public file
+		if existing, ok := r.keys[key.kid]; ok && existing.private != nil {
+			continue
+		}
+		r.keys[key.kid] = key
+	}
+	if len(r.keys) == 0 {
+		return fmt.Errorf("no keys found in %s", dir)
+	}
+	return nil
+}
+
+func parsePrivateKey(kid string, raw []byte) (*signingKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("not PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, errors.New("unsupported private key")
+		}
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	}
+	return nil, errors.New("only RSA and Ed25519 keys are supported")
+}
+
+func parsePublicKey(kid string, raw []byte) (*signingKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("not PEM encoded")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, public: k}, nil
+	case ed25519.PublicKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, public: k}, nil
+	}
+	return nil, errors.New("only RSA and Ed25519 keys are supported")
+}
+
+func currentKeys() (*keyRing, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if keys == nil {
+		return nil, errors.New("signing keys are not loaded")
+	}
+	return keys, nil
+}
+
+// signToken signs claims with the active key, adding issuer, audience and
+// the key's kid.
+func signToken(claims jwt.MapClaims) (string, error) {
+	ring, err := currentKeys()
+	if err != nil {
+		return "", err
+	}
+	claims["iss"] = ring.issuer
+	claims["aud"] = ring.audience
+
+	token := jwt.NewWithClaims(ring.active.method, claims)
+	token.Header["kid"] = ring.active.kid
+	return token.SignedString(ring.active.private)
+}
+
+// parseToken verifies a token against the key its kid names. The algorithm
+// must be the one that key is for, so a public key can never be used as an
+// HMAC secret.
+func parseToken(tokenString string) (jwt.MapClaims, error) {
+	ring, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ring.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing algorithm %s", token.Method.Alg())
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithIssuer(ring.issuer),
+		jwt.WithAudience(ring.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS lists the public keys tokens may be signed with, for other services
+// to verify them. HMAC keys are secret and never listed.
+func JWKS() ([]JWK, error) {
+	ring, err := currentKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	set := []JWK{}
+	for _, key := range ring.keys {
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			set = append(set, JWK{
+				Kty: "RSA", Kid: key.kid, Use: "sig", Alg: key.method.Alg(),
+				N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set = append(set, JWK{
+				Kty: "OKP", Kid: key.kid, Use: "sig", Alg: key.method.Alg(),
+				Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Kid < set[j].Kid })
+	return set, nil
+}
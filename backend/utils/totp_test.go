@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The RFC 4226 and RFC 6238 test secret, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTPRFC4226(t *testing.T) {
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotp(key, int64(counter)); got != code {
+			t.Errorf("hotp(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// RFC 6238 appendix B (SHA-1), cut to the last six of its eight digits.
+func TestValidateTOTPRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("ValidateTOTP(%s at %d) rejected", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP(%s at %d) step = %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	at := time.Unix(1234567890, 0) // code 005924, step 41152263
+	tests := []struct {
+		name   string
+		offset time.Duration
+		ok     bool
+	}{
+		{"same step", 0, true},
+		{"one step later", 30 * time.Second, true},
+		{"one step earlier", -30 * time.Second, true},
+		{"two steps later", 60 * time.Second, false},
+		{"two steps earlier", -60 * time.Second, false},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfcSecret, "005924", at.Add(tt.offset))
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+		if ok && step != 41152263 {
+			t.Errorf("%s: step = %d, want the step the code belongs to", tt.name, step)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfcSecret, "005925"},
+		{"short code", rfcSecret, "05924"},
+		{"long code", rfcSecret, "0005924"},
+		{"empty code", rfcSecret, ""},
+		{"invalid secret", "not base32!", "005924"},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, at); ok {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v; want 20", secret, len(key), err)
+	}
+	if uri := TOTPURI("Bank", "a@b.c", secret); !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("TOTPURI = %s, missing the secret", uri)
+	}
+}
@@ -1,36 +1,57 @@
 package utils
 import (
+    "errors"
     "time"
     "github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("BankSecretKeyzcfsdwgy6euiiw10") // Replace with your own secret key
-func GenerateJWT(userID uint, roleName string) (string, error) {
+// TokenClaims is what an access token says about its bearer. Permissions
+// are not in the token; they are resolved from the session on each request
+// so role changes apply immediately.
+type TokenClaims struct {
+    UserID    uint
+    Roles     []string
+    SessionID uint
+}
+
+// AccessTokenTTL is the lifetime of access tokens; clients renew them with
+// their refresh token. It stays at a day because the web client does not
+// renew yet; lower it once it does.
+func AccessTokenTTL() time.Duration {
+    return GetEnvDuration("ACCESS_TOKEN_TTL", 24*time.Hour)
+}
+
+func GenerateJWT(userID uint, roles []string, sessionID uint) (string, error) {
     claims := jwt.MapClaims{
         "user_id": userID,
-         "role":roleName,
-         "exp":     time.Now().Add(time.Hour * 24).Unix(),
+         "roles":   roles,
+         "sid":     sessionID,
+         "exp":     time.Now().Add(AccessTokenTTL()).Unix(),
     }
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString(jwtKey)
+    return signToken(claims)
 }
 
 
-func ValidateToken(tokenString string) (uint, string, error) {
-    token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-        return jwtKey, nil
-    })
-
+func ValidateToken(tokenString string) (*TokenClaims, error) {
+    claims, err := parseToken(tokenString)
     if err != nil {
-        return 0,"", err
+        return nil, err
     }
 
-    if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-        userID := uint(claims["user_id"].(float64))
-        role := claims["role"].(string)
-        return userID, role, nil
+    userID, _ := claims["user_id"].(float64)
+    var roles []string
+    if list, ok := claims["roles"].([]interface{}); ok {
+        for _, r := range list {
+            if name, ok := r.(string); ok {
+                roles = append(roles, name)
+            }
+        }
     }
-
-    return 0,"", err
-}
\ No newline at end of file
+    sid, _ := claims["sid"].(float64)
+    // Tokens from before sessions existed cannot be revoked
+    if sid == 0 {
+        return nil, errors.New("token has no session")
+    }
+    return &TokenClaims{UserID: uint(userID), Roles: roles, SessionID: uint(sid)}, nil
+}
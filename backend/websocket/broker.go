@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Broker carries notifications between API instances. Each instance
+// subscribes once and hands what it receives to its own hub, so a user is
+// reached whichever instance their connections landed on.
+type Broker interface {
+	Publish(msg NotificationMessage) error
+	// Subscribe calls deliver for every notification published from now on.
+	Subscribe(deliver func(NotificationMessage)) error
+	Close() error
+}
+
+// NewBroker builds the broker named by kind:
+//
+//	postgres (or empty)  PostgresBroker over LISTEN/NOTIFY, for any number of instances
+//	memory               MemoryBroker, for a single instance and tests
+//
+// backlog loads the notifications a PostgresBroker is told about.
+func NewBroker(kind string, db *sql.DB, dsn string, backlog Backlog) (Broker, error) {
+	switch kind {
+	case "", "postgres":
+		return NewPostgresBroker(db, dsn, backlog), nil
+	case "memory":
+		return NewMemoryBroker(), nil
+	default:
+		return nil, fmt.Errorf("unknown notification broker %q", kind)
+	}
+}
+
+// MemoryBroker delivers notifications within the process.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers []func(NotificationMessage)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(msg NotificationMessage) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, deliver := range b.subscribers {
+		deliver(msg)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(deliver func(NotificationMessage)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, deliver)
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+// notifyChannel is the Postgres channel notifications are published on.
+const notifyChannel = "bank_notifications"
+
+// notifyRef is what goes over NOTIFY, whose payloads must stay below 8000
+// bytes: just enough for the receiving instance to load the notification.
+type notifyRef struct {
+	ID     uint `json:"id"`
+	UserID uint `json:"user_id"`
+}
+
+// PostgresBroker publishes with pg_notify and receives on a dedicated
+// LISTEN connection, so every instance sharing the database sees every
+// notification. Messages published while the listener is reconnecting are
+// not redelivered; clients get them from the backlog when they reconnect.
+type PostgresBroker struct {
+	db       *sql.DB
+	dsn      string
+	backlog  Backlog
+	listener *pq.Listener
+}
+
+func NewPostgresBroker(db *sql.DB, dsn string, backlog Backlog) *PostgresBroker {
+	return &PostgresBroker{db: db, dsn: dsn, backlog: backlog}
+}
+
+// Publish sends only the id of msg; it has to be stored already.
+func (b *PostgresBroker) Publish(msg NotificationMessage) error {
+	payload, err := json.Marshal(notifyRef{ID: msg.ID, UserID: msg.UserID})
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.Exec(`SELECT pg_notify($1, $2)`, notifyChannel, string(payload))
+	return err
+}
+
+func (b *PostgresBroker) Subscribe(deliver func(NotificationMessage)) error {
+	listener := pq.NewListener(b.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("websocket: notification listener: %v", err)
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return err
+	}
+	b.listener = listener
+
+	go func() {
+		for n := range listener.Notify {
+			// nil signals the connection was re-established
+			if n == nil {
+				continue
+			}
+
+			var ref notifyRef
+			if err := json.Unmarshal([]byte(n.Extra), &ref); err != nil {
+				log.Printf("websocket: decoding published notification: %v", err)
+				continue
+			}
+			msg, err := b.backlog.Load(ref.UserID, ref.ID)
+			if err != nil {
+				log.Printf("websocket: loading notification %d: %v", ref.ID, err)
+				continue
+			}
+			// Gone or not shown in the app
+			if msg == nil {
+				continue
+			}
+			deliver(*msg)
+		}
+	}()
+	return nil
+}
+
+func (b *PostgresBroker) Close() error {
+	if b.listener == nil {
+		return nil
+	}
+	return b.listener.Close()
+}
@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong from the peer.
+	pongWait = 60 * time.Second
+
+	// Pings are sent often enough that a healthy peer answers within pongWait.
+	pingPeriod = pongWait * 9 / 10
+
+	// Clients only send acknowledgements; anything larger is refused.
+	maxMessageSize = 4096
+
+	// Messages queued per connection before it is considered too slow.
+	sendQueueSize = 32
+)
+
+// Client is a single WebSocket connection of an authenticated user.
+type Client struct {
+	UserID uint
+
+	hub     *Hub
+	conn    *websocket.Conn
+	send    chan NotificationMessage
+	backlog Backlog
+
+	// Notifications missed while disconnected, written before anything
+	// from send.
+	replay []NotificationMessage
+}
+
+// clientFrame is a message sent by the client. The only action is "ack",
+// which marks the listed notifications delivered, and read when Read is set.
+type clientFrame struct {
+	Action string `json:"action"`
+	IDs    []uint `json:"ids"`
+	Read   bool   `json:"read"`
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, userID uint, backlog Backlog) *Client {
+	return &Client{
+		UserID:  userID,
+		hub:     hub,
+		conn:    conn,
+		send:    make(chan NotificationMessage, sendQueueSize),
+		backlog: backlog,
+	}
+}
+
+// readPump handles acknowledgements and keeps the read side alive so pongs
+// and close frames are processed. It unregisters the client once the
+// connection goes away.
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var frame clientFrame
+		if err := json.Unmarshal(data, &frame); err != nil || frame.Action != "ack" {
+			continue
+		}
+		if len(frame.IDs) == 0 {
+			continue
+		}
+		if err := c.backlog.Ack(c.UserID, frame.IDs, frame.Read); err != nil {
+			log.Printf("websocket: recording ack of user %d: %v", c.UserID, err)
+		}
+	}
+}
+
+// writePump is the only goroutine writing to the connection. It drains the
+// send queue and pings the peer so dead connections are noticed.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	replayed := make(map[uint]bool, len(c.replay))
+	for _, message := range c.replay {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.conn.WriteJSON(message); err != nil {
+			return
+		}
+		replayed[message.ID] = true
+	}
+	c.replay = nil
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the queue
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if replayed[message.ID] {
+				continue
+			}
+			if err := c.conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,13 +1,37 @@
 package websocket
 
+import "log"
 
+// Notifications waiting to be published. Senders never wait on the broker:
+// when the queue is full the push is dropped, and since every notification
+// is stored first the client still receives it when it next reconnects.
+const dispatchQueueSize = 1024
 
-func StartDispatcher() {
-	go func() {
-		for {
-			noti := <-NotifyChan
-			SendToClient(noti)
+var queue = make(chan NotificationMessage, dispatchQueueSize)
+
+// Notify queues msg for delivery to every connection of msg.UserID, on
+// whichever instance it is. It never blocks.
+func Notify(msg NotificationMessage) {
+	select {
+	case queue <- msg:
+	default:
+		log.Printf("websocket: dispatch queue full, dropping push of notification %d", msg.ID)
+	}
+}
 
+// StartDispatcher delivers what broker receives to DefaultHub and publishes
+// queued notifications through it.
+func StartDispatcher(broker Broker) error {
+	if err := broker.Subscribe(DefaultHub.Send); err != nil {
+		return err
+	}
+
+	go func() {
+		for msg := range queue {
+			if err := broker.Publish(msg); err != nil {
+				log.Printf("websocket: publishing notification %d: %v", msg.ID, err)
+			}
 		}
 	}()
+	return nil
 }
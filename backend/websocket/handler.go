@@ -1,82 +1,171 @@
 package websocket
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-type Client struct {
-	Conn   *websocket.Conn
-	UserID uint
-}
-
-var Clients = make(map[uint]*Client)
-var NotifyChan = make(chan NotificationMessage)
-var Lock = sync.Mutex{}
+// Time a client that did not send an Authorization header has to send its
+// auth frame after the upgrade.
+const authWait = 10 * time.Second
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin: allowedOrigin,
+}
+
+// allowedOrigin lets browsers connect only from the origins listed, comma
+// separated, in WS_ALLOWED_ORIGINS. Requests without an Origin header don't
+// come from a browser page and only need their token.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
 		return true
-	},
+	}
+	allowed := os.Getenv("WS_ALLOWED_ORIGINS")
+	if allowed == "" {
+		allowed = "http://localhost:3000"
+	}
+	for _, o := range strings.Split(allowed, ",") {
+		if strings.EqualFold(strings.TrimSpace(o), origin) {
+			return true
+		}
+	}
+	return false
 }
 
 type NotificationMessage struct {
+	ID      uint   `json:"id"`
 	UserID  uint   `json:"user_id"`
+	Type    string `json:"type"`
 	Message string `json:"message"`
+	// Data the message was rendered from; its fields depend on Type
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
 }
 
-func WebSocketHandler(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	id, _ := strconv.ParseUint(userIDStr, 10, 32)
-	userID := uint(id)
+// Backlog gives access to stored notifications: what a client missed while
+// disconnected, and recording what it acknowledged.
+type Backlog interface {
+	// Missed returns the user's notifications after lastSeenID in id order,
+	// or those never acknowledged when lastSeenID is zero.
+	Missed(userID, lastSeenID uint) ([]NotificationMessage, error)
+	// Load returns one notification of userID, or nil if there is no such
+	// in-app notification.
+	Load(userID, id uint) (*NotificationMessage, error)
+	// Ack marks notifications of userID as delivered, and as read when read
+	// is set.
+	Ack(userID uint, ids []uint, read bool) error
+}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		return
-	}
+// Authenticator resolves an access token to the user it was issued to.
+type Authenticator func(token string) (uint, error)
 
-	Lock.Lock()
-	Clients[userID] = &Client{Conn: conn, UserID: userID}
-	Lock.Unlock()
+// authFrame is the first frame of a client that authenticates after the
+// upgrade.
+type authFrame struct {
+	Action     string `json:"action"`
+	Token      string `json:"token"`
+	LastSeenID uint   `json:"last_seen_id"`
+}
 
-	go func() {
-		defer conn.Close()
-		for {
-			_, _, err := conn.ReadMessage()
+// Handler registers connections of authenticated users with hub. Clients
+// that can set headers send their access token as a bearer Authorization
+// header. Browsers cannot, so they connect without one and send
+// {"action": "auth", "token": ...} as their first frame; the token is never
+// put in the URL, where it would end up in logs. Clients resuming after a
+// disconnect pass the last notification id they saw as "last_seen_id", in
+// the query or the auth frame, and are sent everything newer before live
+// notifications.
+func Handler(hub *Hub, authenticate Authenticator, backlog Backlog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var userID uint
+		var err error
+		token := bearerToken(c)
+		if token != "" {
+			userID, err = authenticate(token)
 			if err != nil {
-				Lock.Lock()
-				delete(Clients, userID)
-				Lock.Unlock()
-				break
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				return
+			}
+		}
+
+		var lastSeenID uint64
+		if v := c.Query("last_seen_id"); v != "" {
+			lastSeenID, err = strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_seen_id"})
+				return
 			}
 		}
-	}()
-}
 
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
 
+		if token == "" {
+			frame, err := readAuthFrame(conn)
+			if err == nil {
+				userID, err = authenticate(frame.Token)
+			}
+			if err != nil {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Invalid token"), time.Now().Add(writeWait))
+				conn.Close()
+				return
+			}
+			if frame.LastSeenID != 0 {
+				lastSeenID = uint64(frame.LastSeenID)
+			}
+		}
 
+		// Register before loading the backlog so nothing created in between
+		// is lost; the client skips live copies of replayed notifications.
+		client := newClient(hub, conn, userID, backlog)
+		hub.register(client)
 
-func SendToClient(msg NotificationMessage) {
-	Lock.Lock()
-	defer Lock.Unlock()
+		missed, err := backlog.Missed(userID, uint(lastSeenID))
+		if err != nil {
+			log.Printf("websocket: loading missed notifications of user %d: %v", userID, err)
+		}
+		client.replay = missed
 
-	client, ok := Clients[msg.UserID]
-	if !ok {
-		fmt.Printf("No WebSocket client connected for UserID=%d\n", msg.UserID)
-		return
+		go client.writePump()
+		go client.readPump()
 	}
+}
 
-	fmt.Printf("Sending notification to UserID=%d: %s\n", msg.UserID, msg.Message)
+func bearerToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return ""
+}
 
-	err := client.Conn.WriteJSON(msg)
+// readAuthFrame waits up to authWait for the client's auth frame.
+func readAuthFrame(conn *websocket.Conn) (*authFrame, error) {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(authWait))
+	_, data, err := conn.ReadMessage()
 	if err != nil {
-		fmt.Printf("Failed to send message to UserID=%d: %v\n", msg.UserID, err)
-		client.Conn.Close()
-		delete(Clients, msg.UserID)
+		return nil, err
+	}
+
+	var frame authFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return nil, err
+	}
+	if frame.Action != "auth" || frame.Token == "" {
+		return nil, errors.New("expected an auth frame")
 	}
+	return &frame, nil
 }
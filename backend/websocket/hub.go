@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"log"
+	"sync"
+)
+
+// Hub keeps track of the open connections of every user. A user may be
+// connected from several tabs or devices at once; each gets every message.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[uint]map[*Client]struct{}
+}
+
+// DefaultHub is the hub the notification dispatcher delivers to.
+var DefaultHub = NewHub()
+
+func NewHub() *Hub {
+	return &Hub{clients: make(map[uint]map[*Client]struct{})}
+}
+
+func (h *Hub) register(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns, ok := h.clients[client.UserID]
+	if !ok {
+		conns = make(map[*Client]struct{})
+		h.clients[client.UserID] = conns
+	}
+	conns[client] = struct{}{}
+}
+
+// unregister removes client and closes its send queue; it is safe to call
+// more than once.
+func (h *Hub) unregister(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns, ok := h.clients[client.UserID]
+	if !ok {
+		return
+	}
+	if _, ok := conns[client]; !ok {
+		return
+	}
+	delete(conns, client)
+	if len(conns) == 0 {
+		delete(h.clients, client.UserID)
+	}
+	close(client.send)
+}
+
+// Connections returns how many connections userID currently has open.
+func (h *Hub) Connections(userID uint) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID])
+}
+
+// Send queues msg on every connection of msg.UserID. A connection whose
+// queue is full is too slow to keep up and is dropped rather than allowed
+// to hold up delivery to everyone else.
+func (h *Hub) Send(msg NotificationMessage) {
+	var slow []*Client
+	h.mu.RLock()
+	for client := range h.clients[msg.UserID] {
+		select {
+		case client.send <- msg:
+		default:
+			slow = append(slow, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range slow {
+		log.Printf("websocket: dropping slow connection of user %d", client.UserID)
+		h.unregister(client)
+	}
+}
@@ -4,6 +4,7 @@ import toast from 'react-hot-toast';
 import { FiEdit2, FiTrash2, FiPlus } from 'react-icons/fi';
 import { useSelector } from 'react-redux';
 import { useNavigate } from 'react-router-dom';
+import { formatAmount, toCents } from '../utils/money';
 
 const AccountRegistrationPage: React.FC = () => {
   const [accounts, setAccounts] = useState<AccountRegistration[]>([]);
@@ -13,7 +14,7 @@ const AccountRegistrationPage: React.FC = () => {
   const [editingAccount, setEditingAccount] = useState<AccountRegistration | null>(null);
   const [formData, setFormData] = useState({
     account_number: '',
-    balance: 0,
+    balance: '0',
     account_type_id: undefined as number | undefined,
   });
 
@@ -58,7 +59,12 @@ const AccountRegistrationPage: React.FC = () => {
       toast.error('Account number is required');
       return false;
     }
-    if (formData.balance < 0) {
+    const balance = toCents(formData.balance);
+    if (Number.isNaN(balance)) {
+      toast.error('Balance must be an amount with at most two decimals');
+      return false;
+    }
+    if (balance < 0) {
       toast.error('Balance cannot be negative');
       return false;
     }
@@ -97,7 +103,7 @@ const AccountRegistrationPage: React.FC = () => {
       setEditingAccount(null);
       setFormData({
         account_number: '',
-        balance: 0,
+        balance: '0',
         account_type_id: undefined,
       });
       fetchAccounts();
@@ -144,7 +150,7 @@ const AccountRegistrationPage: React.FC = () => {
             setEditingAccount(null);
             setFormData({
               account_number: '',
-              balance: 0,
+              balance: '0',
               account_type_id: undefined,
             });
             setIsModalOpen(true);
@@ -177,7 +183,7 @@ const AccountRegistrationPage: React.FC = () => {
                   <td className="px-6 py-4 whitespace-nowrap">{account.name || 'N/A'}</td>
                   <td className="px-6 py-4 whitespace-nowrap">{account.account_number}</td>
                   <td className="px-6 py-4 whitespace-nowrap">{account.type_name || 'N/A'}</td>
-                  <td className="px-6 py-4 whitespace-nowrap">${account.balance.toFixed(2)}</td>  
+                  <td className="px-6 py-4 whitespace-nowrap">${formatAmount(account.balance)}</td>  
                   <td className="px-6 py-4 whitespace-nowrap">{account.currency || 'N/A'}</td>
                   <td className="px-6 py-4 whitespace-nowrap">{account.created_at ? new Date(account.created_at).toLocaleDateString() : 'N/A'}</td>
                   <td className="px-6 py-4 whitespace-nowrap text-sm font-medium">
@@ -226,7 +232,7 @@ const AccountRegistrationPage: React.FC = () => {
                 step="0.01"
                 min="0"
                 value={formData.balance}
-                onChange={(e) => setFormData({ ...formData, balance: parseFloat(e.target.value) || 0 })}
+                onChange={(e) => setFormData({ ...formData, balance: e.target.value })}
                 className="w-full px-4 py-2 border border-gray-300 rounded-lg shadow-sm focus:ring-2 focus:ring-blue-500 focus:outline-none"
                 required
                 placeholder="Enter initial balance"
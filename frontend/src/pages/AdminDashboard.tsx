@@ -16,6 +16,7 @@ import {
 import { Area, AreaChart, ResponsiveContainer, Tooltip, XAxis, YAxis } from "recharts";
 import { AccountRegistration, accountService } from '../services/accountService';
 import { adminDashboardService, AdminDashboardData, ChartData, Transaction } from '../services/dashboardServices';
+import { Amount, formatAmount, sumAmounts } from '../utils/money';
 
 interface DashboardCardProps {
     icon: React.ReactNode;
@@ -63,11 +64,9 @@ const AdminDashboard = () => {
         }
     }, [user, navigate]);
 
-    const formatCurrency = (value: number): string => `$${value}`;
+    const formatCurrency = (value: Amount | number): string => `$${formatAmount(value)}`;
 
-    const calculateTotalBalance = (): number => {
-        return accounts.reduce((total, account) => total + (account.balance || 0), 0);
-    };
+    const calculateTotalBalance = (): Amount => sumAmounts(accounts.map((account) => account.balance));
 
     const [accounts, setAccounts] = useState<AccountRegistration[]>([]);
     const [selectedAccount, setSelectedAccount] = useState<AccountRegistration | undefined>();
@@ -312,7 +311,7 @@ const AdminDashboard = () => {
                                                     {tx.transaction_type}
                                                 </span>
                                             </td>
-                                            <td className="table-cell">${tx.amount}</td>
+                                            <td className="table-cell">${formatAmount(tx.amount)}</td>
                                             <td className="table-cell">{tx.account_id}</td>
                                             <td className="table-cell">{tx.to_account_id}</td>
                                             <td className="table-cell">{tx.description}</td>
@@ -25,6 +25,10 @@ export default function Auth() {
     password: '',
   });
 
+  // Set when the password was right but the account also needs a 2FA code
+  const [challengeToken, setChallengeToken] = useState<string | null>(null);
+  const [code, setCode] = useState('');
+
   const [registerForm, setRegisterForm] = useState({
   
     password: '',
@@ -39,17 +43,47 @@ export default function Auth() {
 
     try {
       const response = await authService.login(loginForm);
+      if (response.mfa_required) {
+        setChallengeToken(response.challenge_token);
+        setCode('');
+        return;
+      }
       dispatch(setCredentials(response as any));
       toast.success('Login successful!');
       navigate(from, { replace: true });
     } catch (error: any) {
-      const errorMessage = error.response.data.error || 'Invalid credentials';
+      const errorMessage = error.response?.data?.error || 'Invalid credentials';
       toast.error(errorMessage);
     } finally {
       setIsLoading(false);
     }
   };
 
+  const handleSecondFactor = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!challengeToken) {
+      return;
+    }
+    setIsLoading(true);
+
+    try {
+      const response = await authService.completeLogin(challengeToken, code.trim());
+      dispatch(setCredentials(response as any));
+      setChallengeToken(null);
+      toast.success('Login successful!');
+      navigate(from, { replace: true });
+    } catch (error: any) {
+      const errorMessage = error.response?.data?.error || 'Invalid code';
+      toast.error(errorMessage);
+      // An expired or used-up challenge means starting over with the password
+      if (error.response?.status !== 401 || /challenge/i.test(errorMessage)) {
+        setChallengeToken(null);
+      }
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   const handleRegister = async (e: React.FormEvent) => {
     e.preventDefault();
     setIsLoading(true);
@@ -114,6 +148,50 @@ export default function Auth() {
 
           <Tab.Panels className="mt-6">
             <Tab.Panel>
+              {challengeToken ? (
+              <form onSubmit={handleSecondFactor} className="space-y-6">
+                <div>
+                  <label htmlFor="code" className="block text-sm font-medium text-gray-700">
+                    Authentication code
+                  </label>
+                  <div className="mt-1 relative rounded-md shadow-sm">
+                    <div className="absolute inset-y-0 left-0 pl-3 flex items-center pointer-events-none">
+                      <FiLock className="h-5 w-5 text-gray-400" />
+                    </div>
+                    <input
+                      id="code"
+                      name="code"
+                      type="text"
+                      inputMode="numeric"
+                      autoComplete="one-time-code"
+                      required
+                      autoFocus
+                      value={code}
+                      onChange={(e) => setCode(e.target.value)}
+                      className="block w-full pl-10 pr-3 py-2.5 border border-gray-300/50 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-blue-500 sm:text-sm bg-white/80 backdrop-blur-sm transition-all duration-200"
+                      placeholder="Code from your authenticator app, or a recovery code"
+                    />
+                  </div>
+                </div>
+
+                <div className="flex items-center justify-between">
+                  <button
+                    type="button"
+                    onClick={() => setChallengeToken(null)}
+                    className="text-sm font-medium text-blue-600 hover:text-blue-500 transition-colors duration-200"
+                  >
+                    Back
+                  </button>
+                  <button
+                    type="submit"
+                    disabled={isLoading}
+                    className="flex justify-center py-2.5 px-4 border border-transparent rounded-md shadow-sm text-sm font-medium text-white bg-gradient-to-r from-blue-600 to-indigo-600 hover:from-blue-700 hover:to-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500 disabled:opacity-50 transition-all duration-200"
+                  >
+                    Verify
+                  </button>
+                </div>
+              </form>
+              ) : (
               <form onSubmit={handleLogin} className="space-y-6">
                 <div>
                   <label htmlFor="username" className="block text-sm font-medium text-gray-700">
@@ -198,6 +276,7 @@ export default function Auth() {
                   </button>
                 </div>
               </form>
+              )}
             </Tab.Panel>
 
             <Tab.Panel>
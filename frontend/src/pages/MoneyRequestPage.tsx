@@ -9,6 +9,7 @@ import { selectIsAuthenticated } from '../store/features/auth/authSlice';
 import { Menu } from '@headlessui/react';
 import { EllipsisVerticalIcon } from '@heroicons/react/24/solid';
 import useDebounce from '../hooks/useDebounce';
+import { formatAmount } from '../utils/money';
 
 const MoneyRequestPage: React.FC = () => {
   const [isModalOpen, setIsModalOpen] = useState(false);
@@ -102,7 +103,7 @@ const MoneyRequestPage: React.FC = () => {
         user_id: user.id,
         requester_id: requester_id,
         recipient_id: recipient_id,
-        amount: parseFloat(amount),
+        amount: amount.trim(),
         description,
       });
       toast.success('Money request created successfully!');
@@ -194,7 +195,7 @@ const MoneyRequestPage: React.FC = () => {
                 {new Date(request.RequesteAt).toLocaleDateString()}
               </td>
               <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-600">
-                ${request.Amount ? request.Amount.toFixed(2) : '0.00'}
+                ${formatAmount(request.Amount)}
               </td>
               <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-600">{request.requester_id}</td>
               <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-600">{request.recipient_id}</td>
@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useSearchParams } from 'react-router-dom';
 import { transactionService, Transaction } from '../services/transactionService';
+import { Amount, amountToNumber } from '../utils/money';
 // Assuming you will use react-router-dom to get walletId from URL
 // import { useParams } from 'react-router-dom';
 
@@ -49,11 +50,11 @@ const TransactionHistoryPage: React.FC = () => {
         });
     };
 
-    const formatAmount = (amount: number) => {
+    const formatAmount = (amount: Amount) => {
         return new Intl.NumberFormat('en-US', {
             style: 'currency',
             currency: 'USD'
-        }).format(amount);
+        }).format(amountToNumber(amount));
     };
 
     if (loading) {
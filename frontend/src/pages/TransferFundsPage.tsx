@@ -8,6 +8,7 @@ import { transactionService, Transaction } from '../services/transactionService'
 import { RootState } from '../store/store';
 import { selectIsAuthenticated } from '../store/features/auth/authSlice';
 import useDebounce from '../hooks/useDebounce';
+import { formatAmount } from '../utils/money';
 
 const TransferFundsPage: React.FC = () => {
   const [isModalOpen, setIsModalOpen] = useState(false);
@@ -107,7 +108,7 @@ const TransferFundsPage: React.FC = () => {
         user_id: user.id,
         account_id: fromAccount,
         to_account_id: recipient,
-        amount: parseFloat(amount),
+        amount: amount.trim(),
         description: note,
       });
       toast.success('Transfer successful!');
@@ -185,7 +186,7 @@ const TransferFundsPage: React.FC = () => {
                       </span>
                     </td>
                     <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
-                      ${transaction.amount.toFixed(2)}
+                      ${formatAmount(transaction.amount)}
                     </td>
                     <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
                       {transaction.account_id}
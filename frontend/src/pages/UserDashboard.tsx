@@ -19,6 +19,7 @@ import { AccountRegistration, accountService } from '../services/accountService'
 import { userDashboardService, DashboardData, ChartData, Transaction } from '../services/dashboardServices';
 import { moneyRequestService, MoneyRequest } from '../services/moneyRequestService';
 import { toast } from 'react-hot-toast';
+import { Amount, formatAmount, sumAmounts } from '../utils/money';
 
 type RequestStatus = 'PENDING' | 'ACCEPTED' | 'REJECTED' | 'EXPIRED';
 
@@ -105,11 +106,9 @@ const UserDashboard = () => {
     const navigate = useNavigate();
     const user = useSelector((state: RootState) => state.auth.user);
 
-    const formatCurrency = (value: number): string => `$${value}`;
+    const formatCurrency = (value: Amount | number): string => `$${formatAmount(value)}`;
 
-    const calculateTotalBalance = (): number => {
-        return accounts.reduce((total, account) => total + (account.balance || 0), 0);
-    };
+    const calculateTotalBalance = (): Amount => sumAmounts(accounts.map((account) => account.balance));
 
     const [accounts, setAccounts] = useState<AccountRegistration[]>([]);
     const [selectedAccount, setSelectedAccount] = useState<AccountRegistration | undefined>();
@@ -381,7 +380,7 @@ const UserDashboard = () => {
                                                     <p className="text-black dark:text-white">{request.requester_id}</p>
                                                 </td>
                                                 <td className="border-b border-[#eee] py-5 px-4 dark:border-strokedark">
-                                                    <p className="text-black dark:text-white">${request.Amount.toFixed(2)}</p>
+                                                    <p className="text-black dark:text-white">${formatAmount(request.Amount)}</p>
                                                 </td>
                                                 <td className="border-b border-[#eee] py-5 px-4 dark:border-strokedark">
                                                     <span className={`inline-flex rounded-full bg-opacity-10 py-1 px-3 text-sm font-medium ${
@@ -458,7 +457,7 @@ const UserDashboard = () => {
                                                     {tx.transaction_type}
                                                 </span>
                                             </td>
-                                            <td className="table-cell">${tx.amount}</td>
+                                            <td className="table-cell">${formatAmount(tx.amount)}</td>
                                             <td className="table-cell">{tx.account_id}</td>
                                             <td className="table-cell">{tx.to_account_id}</td>
     
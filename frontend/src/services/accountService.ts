@@ -1,10 +1,11 @@
 import axiosInstance from './axios';
+import { Amount } from '../utils/money';
 
 export interface AccountRegistration {
   id?: string;
   user_id: number;
   account_number: string;
-  balance: number;
+  balance: Amount;
   account_type_id?: number;
   type_name?: string;
   Description?: string;
@@ -20,6 +20,14 @@ export const authService = {
     return response.data;
   },
 
+  // Second login step for users with 2FA: the challenge from login plus an
+  // authenticator or recovery code
+  async completeLogin(challenge_token: string, code: string) {
+    const response = await axiosInstance.post('/login/2fa', { challenge_token, code });
+
+    return response.data;
+  },
+
   async register(credentials: RegisterCredentials) {
     const response = await axiosInstance.post('/register', credentials);
    
@@ -29,6 +37,7 @@ export const authService = {
   async logout() {
     await axiosInstance.post('/auth/logout');
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('user')
   },
 
@@ -1,13 +1,14 @@
 import axiosInstance from "./axios";
 import { MoneyRequest } from "./moneyRequestService";
+import { Amount, amountToNumber } from "../utils/money";
 
 // Common interfaces
 export interface DashboardData {
     total_transactions: number;
     pending_requests: number;
     total_transfers: number;
-    total_sent_amount: number;
-    total_received_amount: number;
+    total_sent_amount: Amount;
+    total_received_amount: Amount;
 }
 
 export interface ChartData {
@@ -15,10 +16,14 @@ export interface ChartData {
     total: number;
 }
 
+// Charts plot numbers; the API sends each total as an amount string.
+const toChartData = (data: unknown): ChartData[] =>
+    Array.isArray(data) ? data.map((d) => ({ name: d.name, total: amountToNumber(d.total) })) : [];
+
 export interface Transaction {
     transaction_date: string;
     transaction_type: 'DEBIT' | 'CREDIT';
-    amount: number;
+    amount: Amount;
     account_id: string;
     to_account_id: string;
     description: string;
@@ -29,7 +34,7 @@ export interface AdminDashboardData extends DashboardData {
     total_users: number;
     active_users: number;
     total_accounts: number;
-    system_balance: number;
+    system_balance: Amount;
 }
 
 export interface UserStats {
@@ -63,7 +68,7 @@ export const userDashboardService = {
 
     getMonthlyTransactions: async (): Promise<ChartData[]> => {
         const response = await axiosInstance.get("/api/user/dashboard/monthly-transactions");
-        return Array.isArray(response.data) ? response.data : [];
+        return toChartData(response.data);
     },
 
     getTransactionHistory: async (userId: string | number): Promise<Transaction[]> => {
@@ -86,7 +91,7 @@ export const adminDashboardService = {
 
     getMonthlyUserGrowth: async (): Promise<ChartData[]> => {
         const response = await axiosInstance.get("/api/admin/admindashboard/monthly-transactions");
-        return Array.isArray(response.data) ? response.data : [];
+        return toChartData(response.data);
     },
 
     getSystemTransactions: async (): Promise<Transaction[]> => {
@@ -1,11 +1,12 @@
 import axiosInstance from './axios';
+import { Amount } from '../utils/money';
 
 export interface MoneyRequest {
   ID: number;
   user_id: number;
   requester_id: string;
   recipient_id: string;
-  Amount: number;
+  Amount: Amount;
   Status: 'PENDING' | 'ACCEPTED' | 'REJECTED' | 'EXPIRED';
   ExpiresAt: string;
   RequesteAt: string;
@@ -17,7 +18,7 @@ export interface CreateMoneyRequestPayload {
   user_id: number;
   requester_id: string;
   recipient_id: string;
-  amount: number;
+  amount: Amount;
   description: string;
 }
 
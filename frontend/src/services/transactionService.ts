@@ -1,11 +1,12 @@
 import axiosInstance from './axios';
+import { Amount } from '../utils/money';
 
 export interface Transaction {
   id: number;
   user_id: number;
   account_id: string;
   to_account_id: string;
-  amount: number;
+  amount: Amount;
   description: string;
   transaction_date: string;
   transaction_type: 'DEBIT' | 'CREDIT';
@@ -1,10 +1,11 @@
 import axiosInstance from './axios';
+import { Amount } from '../utils/money';
 
 export interface TransferFundsPayload {
   user_id: number;
   account_id: string;
   to_account_id: string;
-  amount: number;
+  amount: Amount;
   description?: string;
 }
 
@@ -5,6 +5,9 @@ import { addNotification } from '../store/features/notifications/notificationsSl
 
 let socket: WebSocket | null = null;
 let reconnectAttempts = 0;
+// Id of the newest notification received, sent on reconnect so the server
+// replays anything missed in between
+let lastSeenId = 0;
 const MAX_RECONNECT_ATTEMPTS = 5;
 const RECONNECT_DELAY = 3000;
 
@@ -12,13 +15,17 @@ const RECONNECT_DELAY = 3000;
 
 export const websocketService = {
   connect: (userId: string) => {
-    const url = `ws://localhost:8080/ws?user_id=${userId}`;
-    console.log('Attempting to connect to WebSocket at:', url);
+    // The server identifies the user from the access token, not the id.
+    // The token goes in the first frame, never in the URL.
+    const token = localStorage.getItem('token') || '';
+    const url = 'ws://localhost:8080/ws';
+    console.log('Attempting to connect to WebSocket for user:', userId);
     
     try {
       socket = new WebSocket(url);
 
       socket.onopen = () => {
+        socket?.send(JSON.stringify({ action: 'auth', token, last_seen_id: lastSeenId }));
         console.log('WebSocket connected successfully');
         reconnectAttempts = 0;
       };
@@ -29,14 +36,19 @@ export const websocketService = {
           console.log('WebSocket message received:', data);
           
           if (data && data.message) {
+            if (data.id) {
+              lastSeenId = Math.max(lastSeenId, data.id);
+              socket?.send(JSON.stringify({ action: 'ack', ids: [data.id] }));
+            }
+
             // Show toast notification
             toast.success(data.message);
             
             // Add to Redux store
             store.dispatch(addNotification({
-              id: Date.now().toString(), // Generate unique ID
+              id: data.id ? data.id.toString() : Date.now().toString(),
               message: data.message,
-              createdAt: new Date().toISOString(),
+              createdAt: data.created_at || new Date().toISOString(),
               isNew: true,
               userId: data.user_id
             }));
@@ -25,20 +25,25 @@ const authSlice = createSlice({
   reducers: {
     setCredentials: (
       state,
-      action: PayloadAction<{ user: AuthState['user']; token: string }>
+      action: PayloadAction<{ user: AuthState['user']; token: string; refresh_token?: string }>
     ) => {
-      const { user, token } = action.payload;
+      const { user, token, refresh_token } = action.payload;
       state.user = user;
       state.token = token;
       state.isAuthenticated = true;
       localStorage.setItem('token', token);
       localStorage.setItem('user', JSON.stringify(user));
+      // Kept for renewing the session; the access token itself expires
+      if (refresh_token) {
+        localStorage.setItem('refresh_token', refresh_token);
+      }
     },
     logout: (state) => {
       state.user = null;
       state.token = null;
       state.isAuthenticated = false;
       localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
       localStorage.removeItem('user')
     },
   },
@@ -0,0 +1,44 @@
+// The API sends amounts as decimal strings ("12.50") so that no cent is lost
+// to floating point. Add them up in integer cents and only turn them into
+// numbers for charts.
+export type Amount = string;
+
+const amountPattern = /^\s*([+-]?)(\d*)(?:\.(\d{0,2}))?\s*$/;
+
+export function toCents(value: Amount | number | null | undefined): number {
+    if (value === null || value === undefined || value === "") {
+        return 0;
+    }
+    if (typeof value === "number") {
+        return Math.round(value * 100);
+    }
+    const match = amountPattern.exec(value);
+    if (!match || (match[2] === "" && !match[3])) {
+        return NaN;
+    }
+    const cents = Number(match[2] || "0") * 100 + Number((match[3] || "").padEnd(2, "0"));
+    return match[1] === "-" ? -cents : cents;
+}
+
+export function formatCents(cents: number): string {
+    if (Number.isNaN(cents)) {
+        return "—";
+    }
+    const sign = cents < 0 ? "-" : "";
+    const abs = Math.abs(cents);
+    return `${sign}${Math.floor(abs / 100)}.${String(abs % 100).padStart(2, "0")}`;
+}
+
+// formatAmount renders an amount with exactly two decimals.
+export function formatAmount(value: Amount | number | null | undefined): string {
+    return formatCents(toCents(value));
+}
+
+export function sumAmounts(values: Array<Amount | number | null | undefined>): Amount {
+    return formatCents(values.reduce<number>((total, value) => total + toCents(value), 0));
+}
+
+// amountToNumber is for charts only; never do arithmetic on its result.
+export function amountToNumber(value: Amount | number | null | undefined): number {
+    return toCents(value) / 100;
+}